@@ -0,0 +1,61 @@
+package ttheader
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// keys in strInfo for the biz status, compatible with kitex
+const (
+	StrKeyBizStatus  = "biz-status"
+	StrKeyBizMessage = "biz-message"
+	StrKeyBizExtra   = "biz-extra" // json encoded map[string]string
+)
+
+// BizError is the business error carried by the biz-* keys in strInfo
+type BizError struct {
+	StatusCode int32
+	Message    string
+	Extra      map[string]string
+}
+
+// NewBizError returns a new BizError
+func NewBizError(statusCode int32, message string, extra map[string]string) *BizError {
+	return &BizError{StatusCode: statusCode, Message: message, Extra: extra}
+}
+
+func (e *BizError) Error() string {
+	return fmt.Sprintf("biz error: status=%d, message=%s", e.StatusCode, e.Message)
+}
+
+// readBizError returns the BizError in the header, or nil if the biz status is absent or zero
+func readBizError(h *Header) error {
+	status, ok := h.GetStrKey(StrKeyBizStatus)
+	if !ok {
+		return nil
+	}
+	code, err := strconv.ParseInt(status, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid biz status %q: %w", status, err)
+	}
+	if code == 0 {
+		return nil
+	}
+	bizErr := &BizError{StatusCode: int32(code)}
+	bizErr.Message, _ = h.GetStrKey(StrKeyBizMessage)
+	if extra, ok := h.GetStrKey(StrKeyBizExtra); ok && extra != "" {
+		_ = json.Unmarshal([]byte(extra), &bizErr.Extra) // extra is informative, ignore malformed ones
+	}
+	return bizErr
+}
+
+// writeBizError sets the biz-* keys of the BizError in the header
+func writeBizError(h *Header, e *BizError) {
+	h.SetStrKey(StrKeyBizStatus, strconv.Itoa(int(e.StatusCode)))
+	h.SetStrKey(StrKeyBizMessage, e.Message)
+	if len(e.Extra) > 0 {
+		extra, _ := json.Marshal(e.Extra) // never fails for map[string]string
+		h.SetStrKey(StrKeyBizExtra, string(extra))
+	}
+}
@@ -0,0 +1,61 @@
+package ttheader
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBizError_Error(t *testing.T) {
+	err := NewBizError(100, "message", nil)
+	assert(t, err.Error() == "biz error: status=100, message=message", err.Error())
+}
+
+func Test_readBizError(t *testing.T) {
+	t.Run("absent", func(t *testing.T) {
+		assert(t, readBizError(NewHeader()) == nil)
+	})
+	t.Run("zero", func(t *testing.T) {
+		h := NewHeaderWithInfo(nil, map[string]string{StrKeyBizStatus: "0"})
+		assert(t, readBizError(h) == nil)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		h := NewHeaderWithInfo(nil, map[string]string{StrKeyBizStatus: "x"})
+		err := readBizError(h)
+		assert(t, err != nil, err)
+		_, ok := err.(*BizError)
+		assert(t, !ok, err)
+	})
+	t.Run("normal", func(t *testing.T) {
+		h := NewHeaderWithInfo(nil, map[string]string{
+			StrKeyBizStatus:  "100",
+			StrKeyBizMessage: "message",
+			StrKeyBizExtra:   `{"k":"v"}`,
+		})
+		err := readBizError(h)
+		bizErr, ok := err.(*BizError)
+		assert(t, ok, err)
+		assert(t, reflect.DeepEqual(bizErr, NewBizError(100, "message", map[string]string{"k": "v"})), bizErr)
+	})
+	t.Run("malformed-extra", func(t *testing.T) {
+		h := NewHeaderWithInfo(nil, map[string]string{StrKeyBizStatus: "1", StrKeyBizExtra: "{"})
+		bizErr, ok := readBizError(h).(*BizError)
+		assert(t, ok)
+		assert(t, bizErr.StatusCode == 1 && len(bizErr.Extra) == 0, bizErr)
+	})
+}
+
+func Test_writeBizError(t *testing.T) {
+	h := NewHeader()
+	writeBizError(h, NewBizError(100, "message", map[string]string{"k": "v"}))
+	assert(t, reflect.DeepEqual(h.StrInfo(), map[string]string{
+		StrKeyBizStatus:  "100",
+		StrKeyBizMessage: "message",
+		StrKeyBizExtra:   `{"k":"v"}`,
+	}), h.StrInfo())
+	assert(t, reflect.DeepEqual(readBizError(h), NewBizError(100, "message", map[string]string{"k": "v"})))
+
+	h = NewHeader()
+	writeBizError(h, NewBizError(1, "", nil))
+	_, ok := h.GetStrKey(StrKeyBizExtra)
+	assert(t, !ok)
+}
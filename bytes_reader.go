@@ -2,9 +2,12 @@ package ttheader
 
 import (
 	"encoding/binary"
+	"errors"
 	"io"
 )
 
+var ErrInvalidVarint = errors.New("invalid varint")
+
 // bytesReader provides a no-copy way to read from []byte
 type bytesReader struct {
 	buf []byte
@@ -40,6 +43,16 @@ func (r *bytesReader) ReadBytes(n int) ([]byte, error) {
 	return r.buf[prevIndex:r.idx], nil
 }
 
+// Next returns the next n bytes (which may be empty) without copying
+// Note: unlike ReadBytes, it returns io.ErrUnexpectedEOF if there are less than n bytes, without consuming them
+func (r *bytesReader) Next(n int) ([]byte, error) {
+	if n < 0 || r.idx+n > r.len {
+		return nil, io.ErrUnexpectedEOF
+	}
+	r.idx += n
+	return r.buf[r.idx-n : r.idx], nil
+}
+
 func (r *bytesReader) ReadUint16() (uint16, error) {
 	if r.idx+2 > r.len {
 		return 0, io.EOF
@@ -58,6 +71,15 @@ func (r *bytesReader) ReadUint32() (uint32, error) {
 	return v, nil
 }
 
+func (r *bytesReader) ReadUint64() (uint64, error) {
+	if r.idx+8 > r.len {
+		return 0, io.EOF
+	}
+	v := binary.BigEndian.Uint64(r.buf[r.idx : r.idx+8])
+	r.idx += 8
+	return v, nil
+}
+
 func (r *bytesReader) ReadInt32() (int32, error) {
 	v, err := r.ReadUint32()
 	return int32(v), err
@@ -71,3 +93,28 @@ func (r *bytesReader) ReadString(size int) (string, error) {
 	r.idx += size
 	return v, nil
 }
+
+// Skip skips n bytes
+func (r *bytesReader) Skip(n int) error {
+	if n < 0 || r.idx+n > r.len {
+		return io.EOF
+	}
+	r.idx += n
+	return nil
+}
+
+// ReadUvarint reads a base 128 varint, as used by thrift compact and protobuf
+// Note: it returns io.EOF if there's no more bytes, or io.ErrUnexpectedEOF if the varint is truncated
+func (r *bytesReader) ReadUvarint() (uint64, error) {
+	if r.idx >= r.len {
+		return 0, io.EOF
+	}
+	v, n := binary.Uvarint(r.buf[r.idx:r.len])
+	if n == 0 {
+		return 0, io.ErrUnexpectedEOF
+	} else if n < 0 {
+		return 0, ErrInvalidVarint
+	}
+	r.idx += n
+	return v, nil
+}
@@ -160,3 +160,57 @@ func Test_bytesReader_ReadUint16(t *testing.T) {
 		assert(t, err == io.EOF)
 	})
 }
+
+func Test_bytesReader_Skip(t *testing.T) {
+	br := newBytesReader([]byte{1, 2, 3})
+	assert(t, br.Skip(2) == nil)
+	assert(t, br.idx == 2, br.idx)
+	assert(t, br.Skip(2) == io.EOF)
+	assert(t, br.Skip(-1) == io.EOF)
+	assert(t, br.Skip(1) == nil)
+	assert(t, br.idx == 3, br.idx)
+}
+
+func Test_bytesReader_Next(t *testing.T) {
+	br := newBytesReader([]byte{1, 2, 3})
+	buf, err := br.Next(2)
+	assert(t, err == nil && string(buf) == "\x01\x02", buf, err)
+	_, err = br.Next(2)
+	assert(t, err == io.ErrUnexpectedEOF, err)
+	assert(t, br.idx == 2, br.idx)
+	buf, err = br.Next(1)
+	assert(t, err == nil && len(buf) == 1, buf, err)
+	buf, err = br.Next(0)
+	assert(t, err == nil && len(buf) == 0, buf, err)
+	_, err = br.Next(-1)
+	assert(t, err == io.ErrUnexpectedEOF, err)
+}
+
+func Test_bytesReader_ReadUint64(t *testing.T) {
+	br := newBytesReader([]byte{0, 0, 0, 0, 0, 0, 1, 2, 3})
+	v, err := br.ReadUint64()
+	assert(t, err == nil && v == 0x102, v, err)
+	_, err = br.ReadUint64()
+	assert(t, err == io.EOF, err)
+}
+
+func Test_bytesReader_ReadUvarint(t *testing.T) {
+	t.Run("normal", func(t *testing.T) {
+		br := newBytesReader([]byte{0xac, 0x02, 0x01})
+		v, err := br.ReadUvarint()
+		assert(t, err == nil && v == 300, v, err)
+		v, err = br.ReadUvarint()
+		assert(t, err == nil && v == 1, v, err)
+		_, err = br.ReadUvarint()
+		assert(t, err == io.EOF, err)
+	})
+	t.Run("truncated", func(t *testing.T) {
+		_, err := newBytesReader([]byte{0x80}).ReadUvarint()
+		assert(t, err == io.ErrUnexpectedEOF, err)
+	})
+	t.Run("overflow", func(t *testing.T) {
+		buf := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}
+		_, err := newBytesReader(buf).ReadUvarint()
+		assert(t, err == ErrInvalidVarint, err)
+	})
+}
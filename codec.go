@@ -0,0 +1,188 @@
+package ttheader
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+)
+
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// readChunkSize limits the memory allocated ahead of the data received, when reading a size from the wire
+const readChunkSize = 64 * 1024
+
+// Codec reads and writes frames in a specific framing, so that the same code can serve
+// TTHeader, Framed and unframed clients, and convert frames between them, e.g.
+// reading with FramedCodec and writing with TTHeaderCodec.
+// Frames read by codecs without ttheader have a header with only SeqID and ProtocolID set (if known),
+// and codecs without ttheader drop the header when writing.
+type Codec interface {
+	// ReadFrame reads a frame; it returns io.EOF only if the reader ends before the frame starts
+	ReadFrame(reader io.Reader) (*Frame, error)
+	// WriteFrame writes a frame
+	WriteFrame(writer io.Writer, f *Frame) error
+}
+
+var (
+	_ Codec = TTHeaderCodec{}
+	_ Codec = FramedCodec{}
+	_ Codec = UnframedBinaryCodec{}
+)
+
+// TTHeaderCodec reads and writes frames in TTHeader: size(4) + ttheader + payload
+type TTHeaderCodec struct{}
+
+// ReadFrame implements Codec
+func (c TTHeaderCodec) ReadFrame(reader io.Reader) (*Frame, error) {
+	return ReadFrame(reader)
+}
+
+// WriteFrame implements Codec
+func (c TTHeaderCodec) WriteFrame(writer io.Writer, f *Frame) error {
+	_, err := f.WriteTo(writer)
+	return err
+}
+
+// FramedCodec reads and writes frames in Framed: size(4) + payload
+type FramedCodec struct {
+	// MaxFrameSize limits the size of frames to read; <= 0 means no limit
+	MaxFrameSize int
+}
+
+// ReadFrame implements Codec
+func (c FramedCodec) ReadFrame(reader io.Reader) (*Frame, error) {
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return nil, err
+	}
+	size := int(binary.BigEndian.Uint32(buf))
+	if size < 0 || size > int32max || (c.MaxFrameSize > 0 && size > c.MaxFrameSize) {
+		return nil, ErrFrameTooLarge
+	}
+	payload, err := appendFull(reader, make([]byte, 0, minInt(size, readChunkSize)), size)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	f := NewFrame(NewHeader(), payload)
+	f.size = size
+	if isThriftCompact(payload) {
+		f.header.SetProtocolID(ProtocolIDThriftCompact)
+	}
+	if msg, _, err := ReadMessageBegin(payload, f.header.ProtocolID()); err == nil {
+		f.header.SetSeqID(msg.SeqID)
+	}
+	return f, nil
+}
+
+// WriteFrame implements Codec
+func (c FramedCodec) WriteFrame(writer io.Writer, f *Frame) error {
+	if len(f.payload) > int32max {
+		return ErrFrameTooLarge
+	}
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, uint32(len(f.payload)))
+	buffers := net.Buffers{buf, f.payload}
+	_, err := buffers.WriteTo(writer)
+	return err
+}
+
+// UnframedBinaryCodec reads and writes frames in unframed thrift binary, i.e. the bare message.
+// Since there's no size, the end of a message is found by skipping the message, reading small pieces
+// from the reader, so the reader should be buffered (e.g. a bufio.Reader) for better performance.
+type UnframedBinaryCodec struct {
+	// MaxFrameSize limits the size of messages to read; <= 0 means no limit
+	MaxFrameSize int
+}
+
+// ReadFrame implements Codec
+func (c UnframedBinaryCodec) ReadFrame(reader io.Reader) (*Frame, error) {
+	capture := &captureReader{reader: reader, maxSize: c.MaxFrameSize}
+	seqID, err := skipThriftBinaryMessage(capture)
+	if err != nil {
+		return nil, err
+	}
+	f := NewFrame(NewHeader(), capture.buf)
+	f.size = len(capture.buf)
+	f.header.SetSeqID(seqID)
+	return f, nil
+}
+
+// WriteFrame implements Codec
+func (c UnframedBinaryCodec) WriteFrame(writer io.Writer, f *Frame) error {
+	if protocolID := f.Header().ProtocolID(); protocolID != ProtocolIDThriftBinary {
+		return ErrProtocolNotSupported
+	}
+	_, err := writer.Write(f.payload)
+	return err
+}
+
+// captureReader reads exactly the bytes needed from the reader, keeping all bytes read in buf
+type captureReader struct {
+	reader  io.Reader
+	buf     []byte
+	maxSize int
+}
+
+func (r *captureReader) next(n int) ([]byte, error) {
+	start := len(r.buf)
+	if r.maxSize > 0 && start+n > r.maxSize {
+		return nil, ErrFrameTooLarge
+	}
+	buf, err := appendFull(r.reader, r.buf, n)
+	if err != nil {
+		r.buf = buf[:start]
+		if start > 0 { // the message has started
+			err = unexpectedEOF(err)
+		}
+		return nil, err
+	}
+	r.buf = buf
+	return r.buf[start:], nil
+}
+
+// appendFull reads exactly n bytes from the reader and appends them to buf
+// The buffer grows by chunks as data arrives, so that a huge size from the wire doesn't allocate the memory up front.
+func appendFull(reader io.Reader, buf []byte, n int) ([]byte, error) {
+	for read := 0; read < n; {
+		start := len(buf)
+		buf = growBuffer(buf, minInt(n-read, readChunkSize))
+		m, err := io.ReadFull(reader, buf[start:])
+		read += m
+		if err != nil {
+			if read > 0 {
+				err = unexpectedEOF(err)
+			}
+			return buf[:start+m], err
+		}
+	}
+	return buf, nil
+}
+
+func (r *captureReader) ReadByte() (byte, error) {
+	buf, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return buf[0], nil
+}
+
+func (r *captureReader) ReadUint32() (uint32, error) {
+	buf, err := r.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(buf), nil
+}
+
+func (r *captureReader) Skip(n int) error {
+	_, err := r.next(n)
+	return err
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,143 @@
+package ttheader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"testing"
+)
+
+// testAllocated returns the bytes allocated by fn
+func testAllocated(fn func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestTTHeaderCodec(t *testing.T) {
+	h := NewHeader()
+	h.SetSeqID(1)
+	h.SetToken("token")
+	buf := &bytes.Buffer{}
+	err := TTHeaderCodec{}.WriteFrame(buf, NewFrame(h, []byte{1, 2, 3}))
+	assert(t, err == nil, err)
+
+	f, err := TTHeaderCodec{}.ReadFrame(buf)
+	assert(t, err == nil, err)
+	assert(t, f.Header().SeqID() == 1, f.Header().SeqID())
+	assert(t, f.Header().Token() == "token", f.Header().Token())
+	assert(t, bytes.Equal(f.Payload(), []byte{1, 2, 3}), f.Payload())
+}
+
+func TestFramedCodec(t *testing.T) {
+	t.Run("binary", func(t *testing.T) {
+		payload := testThriftMessage(100)
+		buf := &bytes.Buffer{}
+		err := FramedCodec{}.WriteFrame(buf, NewFrame(NewHeader(), payload))
+		assert(t, err == nil, err)
+		assert(t, binary.BigEndian.Uint32(buf.Bytes()) == uint32(len(payload)))
+
+		f, err := FramedCodec{}.ReadFrame(buf)
+		assert(t, err == nil, err)
+		assert(t, f.Header().SeqID() == 100, f.Header().SeqID())
+		assert(t, f.Header().ProtocolID() == ProtocolIDThriftBinary, f.Header().ProtocolID())
+		assert(t, bytes.Equal(f.Payload(), payload))
+	})
+	t.Run("compact", func(t *testing.T) {
+		buf := bytes.NewBuffer([]byte{0, 0, 0, 2, 0x82, 0x21})
+		f, err := FramedCodec{}.ReadFrame(buf)
+		assert(t, err == nil, err)
+		assert(t, f.Header().ProtocolID() == ProtocolIDThriftCompact, f.Header().ProtocolID())
+	})
+	t.Run("too-large", func(t *testing.T) {
+		buf := bytes.NewBuffer([]byte{0, 0, 1, 0})
+		_, err := FramedCodec{MaxFrameSize: 255}.ReadFrame(buf)
+		assert(t, err == ErrFrameTooLarge, err)
+	})
+	t.Run("huge-size", func(t *testing.T) {
+		var err error
+		allocated := testAllocated(func() {
+			_, err = FramedCodec{}.ReadFrame(bytes.NewBuffer([]byte{0x7f, 0xff, 0xff, 0xff, 0}))
+		})
+		assert(t, err == io.ErrUnexpectedEOF, err)
+		assert(t, allocated < 1<<20, "not allocated up front", allocated)
+	})
+	t.Run("eof", func(t *testing.T) {
+		_, err := FramedCodec{}.ReadFrame(&bytes.Buffer{})
+		assert(t, err == io.EOF, err)
+		_, err = FramedCodec{}.ReadFrame(bytes.NewBuffer([]byte{0, 0, 0, 2, 0}))
+		assert(t, err == io.ErrUnexpectedEOF, err)
+	})
+}
+
+func TestUnframedBinaryCodec(t *testing.T) {
+	t.Run("multiple-messages", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		for i := 1; i <= 2; i++ {
+			f := NewFrame(NewHeader(), testThriftMessage(int32(i)))
+			err := UnframedBinaryCodec{}.WriteFrame(buf, f)
+			assert(t, err == nil, err)
+		}
+		reader := bufio.NewReader(buf)
+		for i := 1; i <= 2; i++ {
+			f, err := UnframedBinaryCodec{}.ReadFrame(reader)
+			assert(t, err == nil, err)
+			assert(t, f.Header().SeqID() == int32(i), f.Header().SeqID())
+			assert(t, bytes.Equal(f.Payload(), testThriftMessage(int32(i))))
+		}
+		_, err := UnframedBinaryCodec{}.ReadFrame(reader)
+		assert(t, err == io.EOF, err)
+	})
+	t.Run("truncated", func(t *testing.T) {
+		payload := testThriftMessage(1)
+		_, err := UnframedBinaryCodec{}.ReadFrame(bytes.NewReader(payload[:len(payload)-1]))
+		assert(t, err == io.ErrUnexpectedEOF, err)
+	})
+	t.Run("huge-string", func(t *testing.T) {
+		payload := appendThriftString(nil, "method")
+		payload = append(payload, 0x1)
+		payload = appendI32(payload, 1)
+		payload = appendI16(append(payload, thriftTypeBinary), 1)
+		payload = appendI32(payload, 0x7fffffff)
+		var err error
+		allocated := testAllocated(func() {
+			_, err = UnframedBinaryCodec{}.ReadFrame(bytes.NewReader(payload))
+		})
+		assert(t, err == io.ErrUnexpectedEOF, err)
+		assert(t, allocated < 1<<20, "not allocated up front", allocated)
+	})
+	t.Run("too-large", func(t *testing.T) {
+		payload := testThriftMessage(1)
+		_, err := UnframedBinaryCodec{MaxFrameSize: 10}.ReadFrame(bytes.NewReader(payload))
+		assert(t, err == ErrFrameTooLarge, err)
+	})
+	t.Run("write:unsupported-protocol", func(t *testing.T) {
+		h := NewHeader()
+		h.SetProtocolID(ProtocolIDThriftCompact)
+		err := UnframedBinaryCodec{}.WriteFrame(&bytes.Buffer{}, NewFrame(h, nil))
+		assert(t, err == ErrProtocolNotSupported, err)
+	})
+}
+
+func TestCodec_Convert(t *testing.T) {
+	payload := testThriftMessage(100)
+	framed := &bytes.Buffer{}
+	err := FramedCodec{}.WriteFrame(framed, NewFrame(NewHeader(), payload))
+	assert(t, err == nil, err)
+
+	var src, dst Codec = FramedCodec{}, TTHeaderCodec{}
+	f, err := src.ReadFrame(framed)
+	assert(t, err == nil, err)
+	converted := &bytes.Buffer{}
+	err = dst.WriteFrame(converted, f)
+	assert(t, err == nil, err)
+
+	f, err = ReadFrame(converted)
+	assert(t, err == nil, err)
+	assert(t, f.Header().SeqID() == 100, f.Header().SeqID())
+	assert(t, bytes.Equal(f.Payload(), payload))
+}
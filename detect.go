@@ -0,0 +1,222 @@
+package ttheader
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"sync"
+	"time"
+)
+
+// Protocol is the wire protocol detected from the first bytes of a connection
+type Protocol int
+
+const (
+	ProtocolUnknown       Protocol = iota
+	ProtocolTTHeader               // framed size(4) + ttheader
+	ProtocolFramed                 // framed size(4) + thrift binary/compact message, without ttheader
+	ProtocolThriftBinary           // unframed thrift binary message (strict)
+	ProtocolThriftCompact          // unframed thrift compact message
+	ProtocolHTTP2                  // HTTP/2 with prior knowledge, starting with the client preface
+)
+
+const (
+	thriftCompactProtocolID  = 0x82
+	thriftCompactVersion     = 1
+	thriftCompactVersionMask = 0x1f
+
+	sizeFramedDetect = 4 + 2 // framed size(4) + magic(2)
+
+	// DefaultDetectTimeout is the default max duration for receiving enough bytes to detect the protocol
+	DefaultDetectTimeout = 5 * time.Second
+)
+
+var http2Preface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+
+func (p Protocol) String() string {
+	switch p {
+	case ProtocolTTHeader:
+		return "TTHeader"
+	case ProtocolFramed:
+		return "Framed"
+	case ProtocolThriftBinary:
+		return "ThriftBinary"
+	case ProtocolThriftCompact:
+		return "ThriftCompact"
+	case ProtocolHTTP2:
+		return "HTTP2"
+	default:
+		return "Unknown"
+	}
+}
+
+// Detect detects the protocol by the prefix of a connection, returning the protocol and the number of bytes
+// needed to decide. If the protocol is ProtocolUnknown and the returned size is larger than len(prefix),
+// more bytes are needed; otherwise the protocol is not recognized.
+// Note: only strict thrift binary (starting with the version) is recognized, for both unframed and framed;
+// non-strict messages, which start with the length of the method name, are ProtocolUnknown.
+func Detect(prefix []byte) (Protocol, int) {
+	if len(prefix) < 1 {
+		return ProtocolUnknown, 1
+	}
+	switch prefix[0] {
+	case thriftMagic >> 8:
+		if len(prefix) < 2 {
+			return ProtocolUnknown, 2
+		}
+		if isThriftBinary(prefix) {
+			return ProtocolThriftBinary, 2
+		}
+		return ProtocolUnknown, 2
+	case thriftCompactProtocolID:
+		if len(prefix) < 2 {
+			return ProtocolUnknown, 2
+		}
+		if isThriftCompact(prefix) {
+			return ProtocolThriftCompact, 2
+		}
+		return ProtocolUnknown, 2
+	case http2Preface[0]:
+		if len(prefix) < len(http2Preface) && bytes.HasPrefix(http2Preface, prefix) {
+			return ProtocolUnknown, len(http2Preface)
+		}
+		if bytes.HasPrefix(prefix, http2Preface) {
+			return ProtocolHTTP2, len(http2Preface)
+		}
+		// not HTTP/2, but it's still possible to be a (very large) framed message
+	}
+	if len(prefix) < sizeFramedDetect {
+		return ProtocolUnknown, sizeFramedDetect
+	}
+	if IsMagic(prefix[4:]) {
+		return ProtocolTTHeader, sizeFramedDetect
+	}
+	if isThriftBinary(prefix[4:]) || isThriftCompact(prefix[4:]) {
+		return ProtocolFramed, sizeFramedDetect
+	}
+	return ProtocolUnknown, sizeFramedDetect
+}
+
+func isThriftBinary(buf []byte) bool {
+	return len(buf) >= 2 && buf[0] == thriftMagic>>8 && buf[1] == thriftMagic&0xff
+}
+
+func isThriftCompact(buf []byte) bool {
+	return len(buf) >= 2 && buf[0] == thriftCompactProtocolID && buf[1]&thriftCompactVersionMask == thriftCompactVersion
+}
+
+// ConnHandler serves a connection after its protocol is detected
+// The bytes read for detection are not consumed, i.e. the handler reads the connection from the very beginning.
+type ConnHandler func(conn net.Conn)
+
+// ProtocolRouter accepts connections from a net.Listener, detects their protocols and routes them to
+// the handlers registered for each protocol, which is useful for serving mixed protocols on one port.
+type ProtocolRouter struct {
+	listener      net.Listener
+	detectTimeout time.Duration
+
+	mu       sync.RWMutex
+	handlers map[Protocol]ConnHandler
+}
+
+// NewProtocolRouter returns a new ProtocolRouter accepting connections from the given listener
+func NewProtocolRouter(listener net.Listener) *ProtocolRouter {
+	return &ProtocolRouter{
+		listener:      listener,
+		detectTimeout: DefaultDetectTimeout,
+		handlers:      make(map[Protocol]ConnHandler),
+	}
+}
+
+// Handle registers the handler for the protocol
+// The handler for ProtocolUnknown, if registered, serves connections not matching any other handler;
+// otherwise these connections are closed.
+func (r *ProtocolRouter) Handle(protocol Protocol, handler ConnHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[protocol] = handler
+}
+
+// SetDetectTimeout sets the max duration for receiving enough bytes to detect the protocol; <= 0 means no limit
+// Note: it should be called before Serve
+func (r *ProtocolRouter) SetDetectTimeout(timeout time.Duration) {
+	r.detectTimeout = timeout
+}
+
+// Serve accepts connections and serves each of them in a new goroutine, until the listener fails
+func (r *ProtocolRouter) Serve() error {
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return err
+		}
+		go r.serveConn(conn)
+	}
+}
+
+// Close closes the listener, which makes Serve return
+func (r *ProtocolRouter) Close() error {
+	return r.listener.Close()
+}
+
+func (r *ProtocolRouter) serveConn(conn net.Conn) {
+	if r.detectTimeout > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(r.detectTimeout)); err != nil {
+			_ = conn.Close()
+			return
+		}
+	}
+	reader := bufio.NewReader(conn)
+	protocol, err := detectReader(reader)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	if r.detectTimeout > 0 {
+		if err = conn.SetReadDeadline(time.Time{}); err != nil {
+			_ = conn.Close()
+			return
+		}
+	}
+	handler := r.handler(protocol)
+	if handler == nil {
+		_ = conn.Close()
+		return
+	}
+	handler(&detectedConn{Conn: conn, reader: reader})
+}
+
+func (r *ProtocolRouter) handler(protocol Protocol) ConnHandler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if handler, ok := r.handlers[protocol]; ok {
+		return handler
+	}
+	return r.handlers[ProtocolUnknown]
+}
+
+// detectReader peeks the reader until the protocol can be decided
+func detectReader(reader *bufio.Reader) (Protocol, error) {
+	need := 1
+	for {
+		prefix, err := reader.Peek(need)
+		protocol, size := Detect(prefix)
+		if protocol != ProtocolUnknown || size <= len(prefix) {
+			return protocol, nil
+		}
+		if err != nil {
+			return ProtocolUnknown, err
+		}
+		need = size
+	}
+}
+
+// detectedConn replays the peeked bytes before reading from the connection
+type detectedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *detectedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
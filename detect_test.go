@@ -0,0 +1,109 @@
+package ttheader
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDetect(t *testing.T) {
+	ttheaderFrame, err := NewFrame(NewHeader(), []byte{1}).Bytes()
+	assert(t, err == nil, err)
+	exception, err := NewException("method", 1, "message", 0).Bytes()
+	assert(t, err == nil, err)
+	framed := append([]byte{0, 0, 0, byte(len(exception))}, exception...)
+
+	tests := []struct {
+		name     string
+		prefix   []byte
+		protocol Protocol
+		size     int
+	}{
+		{"empty", nil, ProtocolUnknown, 1},
+		{"ttheader", ttheaderFrame, ProtocolTTHeader, 6},
+		{"ttheader:partial", ttheaderFrame[:5], ProtocolUnknown, 6},
+		{"framed:binary", framed, ProtocolFramed, 6},
+		{"framed:compact", []byte{0, 0, 0, 10, 0x82, 0x21}, ProtocolFramed, 6},
+		{"binary", exception, ProtocolThriftBinary, 2},
+		{"binary:partial", exception[:1], ProtocolUnknown, 2},
+		{"binary:invalid", []byte{0x80, 0x02}, ProtocolUnknown, 2},
+		{"binary:non-strict", append(appendThriftString(nil, "method"), 0x1), ProtocolUnknown, 6},
+		{"compact", []byte{0x82, 0x21}, ProtocolThriftCompact, 2},
+		{"compact:partial", []byte{0x82}, ProtocolUnknown, 2},
+		{"compact:invalid-version", []byte{0x82, 0x22}, ProtocolUnknown, 2},
+		{"http2", http2Preface, ProtocolHTTP2, 24},
+		{"http2:partial", http2Preface[:3], ProtocolUnknown, 24},
+		{"http2:mismatch", []byte("PRI * HTTP/1.1\r\n\r\nSM\r\n\r\n"), ProtocolUnknown, 6},
+		{"unknown", []byte("GET / HTTP/1.1\r\n"), ProtocolUnknown, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			protocol, size := Detect(tt.prefix)
+			assert(t, protocol == tt.protocol, protocol)
+			assert(t, size == tt.size, size)
+		})
+	}
+}
+
+func TestProtocol_String(t *testing.T) {
+	assert(t, ProtocolTTHeader.String() == "TTHeader")
+	assert(t, ProtocolHTTP2.String() == "HTTP2")
+	assert(t, Protocol(100).String() == "Unknown")
+}
+
+func TestProtocolRouter(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert(t, err == nil, err)
+	router := NewProtocolRouter(listener)
+	router.SetDetectTimeout(time.Second)
+
+	type routed struct {
+		protocol Protocol
+		data     []byte
+	}
+	results := make(chan routed, 4)
+	newHandler := func(protocol Protocol) ConnHandler {
+		return func(conn net.Conn) {
+			defer conn.Close()
+			data, _ := io.ReadAll(conn)
+			results <- routed{protocol: protocol, data: data}
+		}
+	}
+	router.Handle(ProtocolTTHeader, newHandler(ProtocolTTHeader))
+	router.Handle(ProtocolThriftBinary, newHandler(ProtocolThriftBinary))
+	router.Handle(ProtocolUnknown, newHandler(ProtocolUnknown))
+	go router.Serve()
+	defer router.Close()
+
+	send := func(data []byte) {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		assert(t, err == nil, err)
+		for _, b := range data { // one byte per write to exercise partial detection
+			_, err = conn.Write([]byte{b})
+			assert(t, err == nil, err)
+		}
+		assert(t, conn.(*net.TCPConn).CloseWrite() == nil)
+		defer conn.Close()
+	}
+
+	ttheaderFrame, err := NewFrame(NewHeader(), []byte{1}).Bytes()
+	assert(t, err == nil, err)
+	exception, err := NewException("method", 1, "message", 0).Bytes()
+	assert(t, err == nil, err)
+	tests := []routed{
+		{ProtocolTTHeader, ttheaderFrame},
+		{ProtocolThriftBinary, exception},
+		{ProtocolUnknown, []byte("GET / HTTP/1.1\r\n\r\n")}, // fallback handler
+	}
+	for _, tt := range tests {
+		send(tt.data)
+		select {
+		case result := <-results:
+			assert(t, result.protocol == tt.protocol, result.protocol)
+			assert(t, string(result.data) == string(tt.data), result.data) // detected bytes are replayed
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for", tt.protocol)
+		}
+	}
+}
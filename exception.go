@@ -3,6 +3,8 @@ package ttheader
 import (
 	"encoding/binary"
 	"errors"
+	"io"
+	"strconv"
 )
 
 // implementation of the thrift.TApplicationException
@@ -14,6 +16,12 @@ import (
 // - Message:        field_type(0x0b, binary) + field_id(1) + length(4 bytes) + value(var-length)
 // - Exception Type: field_type(0x08, int32) + field_id(1) + value(4 bytes)
 
+// kitex protobuf exception:
+// MAGIC|Message Type: 0x9001_0003 (4 bytes)
+// Method:             length(4 bytes) + value(var-length)
+// SeqID:              (4 bytes)
+// Payload:            protobuf message ErrorProto { int32 TypeID = 1; string Message = 2; }
+
 const (
 	sizeMagic         = 2
 	sizeMessageType   = 2
@@ -25,6 +33,8 @@ const (
 	sizeFixed         = sizeMagic + sizeMessageType + sizeMethodLength + sizeSeqID + sizeMessageMeta + sizeExceptionType + sizeStop
 
 	thriftMagic                = 0x8001
+	kitexProtobufMagic         = 0x90010000
+	kitexProtobufMagicMask     = 0xffff0000
 	thriftMessageTypeException = 0x3
 
 	thriftStop       = 0
@@ -33,8 +43,60 @@ const (
 
 	fieldIDMessage       = 1
 	fieldIDExceptionType = 2
+
+	protoFieldIDExceptionType = 1
+	protoFieldIDMessage       = 2
+)
+
+// ExceptionType is the type of TApplicationException
+// It implements error, so that it can be used as the target of errors.Is to match an *Exception of the type.
+type ExceptionType int
+
+// standard types of TApplicationException
+const (
+	ExceptionTypeUnknown               ExceptionType = 0
+	ExceptionTypeUnknownMethod         ExceptionType = 1
+	ExceptionTypeInvalidMessageType    ExceptionType = 2
+	ExceptionTypeWrongMethodName       ExceptionType = 3
+	ExceptionTypeBadSequenceID         ExceptionType = 4
+	ExceptionTypeMissingResult         ExceptionType = 5
+	ExceptionTypeInternalError         ExceptionType = 6
+	ExceptionTypeProtocolError         ExceptionType = 7
+	ExceptionTypeInvalidTransform      ExceptionType = 8
+	ExceptionTypeInvalidProtocol       ExceptionType = 9
+	ExceptionTypeUnsupportedClientType ExceptionType = 10
 )
 
+// ExceptionTypeCanceled is not a standard type, but used by this package for canceled (reset) streams
+const ExceptionTypeCanceled ExceptionType = 1001
+
+var exceptionTypeNames = map[ExceptionType]string{
+	ExceptionTypeUnknown:               "unknown application exception",
+	ExceptionTypeUnknownMethod:         "unknown method",
+	ExceptionTypeInvalidMessageType:    "invalid message type",
+	ExceptionTypeWrongMethodName:       "wrong method name",
+	ExceptionTypeBadSequenceID:         "bad sequence id",
+	ExceptionTypeMissingResult:         "missing result",
+	ExceptionTypeInternalError:         "internal error",
+	ExceptionTypeProtocolError:         "protocol error",
+	ExceptionTypeInvalidTransform:      "invalid transform",
+	ExceptionTypeInvalidProtocol:       "invalid protocol",
+	ExceptionTypeUnsupportedClientType: "unsupported client type",
+	ExceptionTypeCanceled:              "canceled",
+}
+
+func (t ExceptionType) String() string {
+	if name, ok := exceptionTypeNames[t]; ok {
+		return name
+	}
+	return "exception type " + strconv.Itoa(int(t))
+}
+
+// Error implements error, which makes errors.Is(err, ExceptionTypeXXX) work
+func (t ExceptionType) Error() string {
+	return t.String()
+}
+
 var (
 	ErrInvalidThriftMagic       = errors.New("invalid thrift magic")
 	ErrInvalidThriftMessageType = errors.New("invalid thrift message type")
@@ -56,6 +118,35 @@ func NewException(methodName string, seqID int32, message string, typeID int) *E
 	}
 }
 
+// NewExceptionWithType is the same as NewException, but with a typed ExceptionType
+func NewExceptionWithType(methodName string, seqID int32, message string, tp ExceptionType) *Exception {
+	return NewException(methodName, seqID, message, int(tp))
+}
+
+// Type returns the ExceptionType of the exception
+func (e *Exception) Type() ExceptionType {
+	return ExceptionType(e.ExceptionType)
+}
+
+// Error implements error, returning the message, or the type if the message is empty
+func (e *Exception) Error() string {
+	if e.Message == "" {
+		return e.Type().String()
+	}
+	return e.Message
+}
+
+// Is reports whether the target is the same type of exception, i.e. an ExceptionType or an *Exception
+func (e *Exception) Is(target error) bool {
+	switch t := target.(type) {
+	case ExceptionType:
+		return e.Type() == t
+	case *Exception:
+		return t != nil && e.ExceptionType == t.ExceptionType
+	}
+	return false
+}
+
 func (e *Exception) BytesLength() int {
 	return sizeFixed + len(e.MethodName) + len(e.Message)
 }
@@ -70,6 +161,63 @@ func (e *Exception) Bytes() ([]byte, error) {
 	return buf, nil
 }
 
+// encode encodes the exception in the given protocol
+func (e *Exception) encode(protocolID uint8) ([]byte, error) {
+	switch protocolID {
+	case ProtocolIDThriftBinary:
+		return e.Bytes()
+	case ProtocolIDThriftCompact, ProtocolIDThriftCompactV2:
+		return e.BytesCompact()
+	case ProtocolIDKitexProtobuf:
+		return e.BytesKitexProtobuf()
+	default:
+		return nil, ErrProtocolNotSupported
+	}
+}
+
+// BytesCompact encodes the exception in thrift compact protocol
+func (e *Exception) BytesCompact() ([]byte, error) {
+	// max size: header(2) + seqID(5) + method(5+len) + message(1+5+len) + type(1+5) + stop(1)
+	buf := make([]byte, 0, 25+len(e.MethodName)+len(e.Message))
+	buf = appendCompactMessageBegin(buf, e.MethodName, thriftMessageTypeException, e.SeqID)
+	buf = appendCompactFieldBegin(buf, compactTypeBinary, fieldIDMessage, 0)
+	buf = appendCompactString(buf, e.Message)
+	buf = appendCompactFieldBegin(buf, compactTypeInt32, fieldIDExceptionType, fieldIDMessage)
+	buf = appendUvarint(buf, zigzag(int64(int32(e.ExceptionType))))
+	return append(buf, compactTypeStop), nil
+}
+
+// BytesKitexProtobuf encodes the exception in kitex protobuf
+func (e *Exception) BytesKitexProtobuf() ([]byte, error) {
+	// max size: magic(4) + method(4+len) + seqID(4) + type(1+10) + message(1+5+len)
+	buf := make([]byte, 0, 29+len(e.MethodName)+len(e.Message))
+	buf = appendUint32(buf, kitexProtobufMagic|thriftMessageTypeException)
+	buf = appendUint32(buf, uint32(len(e.MethodName)))
+	buf = append(buf, e.MethodName...)
+	buf = appendUint32(buf, uint32(e.SeqID))
+	buf = appendProtoVarintField(buf, protoFieldIDExceptionType, uint64(int64(int32(e.ExceptionType))))
+	if e.Message != "" { // proto3 omits default values
+		buf = appendProtoStringField(buf, protoFieldIDMessage, e.Message)
+	}
+	return buf, nil
+}
+
+// isExceptionPayload checks whether the payload is an exception message in the given protocol
+func isExceptionPayload(protocolID uint8, payload []byte) bool {
+	switch protocolID {
+	case ProtocolIDThriftBinary:
+		return len(payload) >= sizeMagic+sizeMessageType &&
+			binary.BigEndian.Uint16(payload) == thriftMagic &&
+			binary.BigEndian.Uint16(payload[sizeMagic:]) == thriftMessageTypeException
+	case ProtocolIDThriftCompact, ProtocolIDThriftCompactV2:
+		return isThriftCompact(payload) && payload[1]>>thriftCompactTypeShift == thriftMessageTypeException
+	case ProtocolIDKitexProtobuf:
+		return len(payload) >= 4 && binary.BigEndian.Uint32(payload) == kitexProtobufMagic|thriftMessageTypeException
+	default:
+		return false
+	}
+}
+
 func writeExceptionHeader(buf []byte) int {
 	binary.BigEndian.PutUint16(buf[0:], thriftMagic)
 	binary.BigEndian.PutUint16(buf[2:], thriftMessageTypeException)
@@ -143,9 +291,82 @@ func (e *Exception) readFields(reader *bytesReader) (err error) {
 			if err != nil {
 				return err
 			}
+			e.ExceptionType = int(int32(value))
+		} else if err = skipThriftBinary(reader, tp, 1); err != nil { // ignore other fields
+			return err
+		}
+	}
+}
+
+func (e *Exception) readCompact(reader *bytesReader) (err error) {
+	var msgType byte
+	if e.MethodName, msgType, e.SeqID, err = readCompactMessageBegin(reader); err != nil {
+		return err
+	}
+	if msgType != thriftMessageTypeException {
+		return ErrInvalidThriftMessageType
+	}
+	var lastID int16
+	for {
+		tp, id, err := readCompactFieldBegin(reader, lastID)
+		if err != nil {
+			return err
+		} else if tp == compactTypeStop {
+			return nil
+		}
+		if tp == compactTypeBinary && id == fieldIDMessage {
+			if e.Message, err = readCompactString(reader); err != nil {
+				return err
+			}
+		} else if tp == compactTypeInt32 && id == fieldIDExceptionType {
+			value, err := readCompactInt32(reader)
+			if err != nil {
+				return err
+			}
 			e.ExceptionType = int(value)
-		} else {
-			continue // ignore other fields
+		} else if err = skipThriftCompact(reader, tp, 1); err != nil { // ignore other fields
+			return err
+		}
+		lastID = id
+	}
+}
+
+func (e *Exception) readKitexProtobuf(reader *bytesReader) (err error) {
+	magic, err := reader.ReadUint32()
+	if err != nil {
+		return err
+	}
+	if magic&kitexProtobufMagicMask != kitexProtobufMagic {
+		return ErrInvalidThriftMagic
+	}
+	if magic&^kitexProtobufMagicMask != thriftMessageTypeException {
+		return ErrInvalidThriftMessageType
+	}
+	if e.MethodName, err = readMethod(reader); err != nil {
+		return err
+	}
+	if e.SeqID, err = reader.ReadInt32(); err != nil {
+		return err
+	}
+	for {
+		num, wireType, err := readProtoTag(reader)
+		if err == io.EOF { // a protobuf message ends with the payload
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if num == protoFieldIDExceptionType && wireType == protoWireVarint {
+			value, err := reader.ReadUvarint()
+			if err != nil {
+				return err
+			}
+			e.ExceptionType = int(int32(value))
+		} else if num == protoFieldIDMessage && wireType == protoWireBytes {
+			if e.Message, err = readProtoString(reader); err != nil {
+				return err
+			}
+		} else if err = skipProtoValue(reader, num, wireType, 1); err != nil { // ignore other fields
+			return err
 		}
 	}
 }
@@ -1,6 +1,10 @@
 package ttheader
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
 	"testing"
 )
 
@@ -12,3 +16,176 @@ func Test_exception_BytesLength(t *testing.T) {
 	assert(t, err == nil)
 	assert(t, len(length) == sizeFixed+len(exc.Message)+len(exc.MethodName))
 }
+
+func Test_exception_read(t *testing.T) {
+	header := appendUint32(nil, thriftVersion1|thriftMessageTypeException)
+	header = appendThriftString(header, "method")
+	header = appendI32(header, 100)
+
+	t.Run("normal", func(t *testing.T) {
+		buf, err := NewException("method", 100, "message", 1).Bytes()
+		assert(t, err == nil, err)
+		exc := &Exception{}
+		err = exc.read(newBytesReader(buf))
+		assert(t, err == nil, err)
+		assert(t, reflect.DeepEqual(exc, NewException("method", 100, "message", 1)), exc)
+	})
+	t.Run("unknown-fields", func(t *testing.T) {
+		buf := append([]byte(nil), header...)
+		buf = appendI32(appendFieldBegin(buf, thriftTypeInt32, fieldIDMessage), 1) // unexpected type
+		buf = appendThriftString(appendFieldBegin(buf, thriftTypeBinary, 3), "extra")
+		buf = append(appendFieldBegin(buf, thriftTypeList, 4), thriftTypeBinary)
+		buf = appendThriftString(appendI32(buf, 1), "elem")
+		buf = append(appendFieldBegin(buf, thriftTypeStruct, 5), testThriftStruct()...)
+		buf = appendThriftString(appendFieldBegin(buf, thriftTypeBinary, fieldIDMessage), "message")
+		buf = appendI32(appendFieldBegin(buf, thriftTypeInt32, fieldIDExceptionType), 6)
+		buf = append(buf, thriftStop)
+
+		exc := &Exception{}
+		err := exc.read(newBytesReader(buf))
+		assert(t, err == nil, err)
+		assert(t, reflect.DeepEqual(exc, NewException("method", 100, "message", 6)), exc)
+	})
+	t.Run("unknown-fields:invalid", func(t *testing.T) {
+		buf := append(appendFieldBegin(append([]byte(nil), header...), 0x1, 3), thriftStop)
+		err := (&Exception{}).read(newBytesReader(buf))
+		assert(t, err == ErrInvalidThriftType, err)
+	})
+	t.Run("unknown-fields:truncated", func(t *testing.T) {
+		buf := appendFieldBegin(append([]byte(nil), header...), thriftTypeInt64, 3)
+		err := (&Exception{}).read(newBytesReader(append(buf, 0, 0)))
+		assert(t, err == io.EOF, err)
+	})
+	t.Run("invalid-magic", func(t *testing.T) {
+		err := (&Exception{}).read(newBytesReader([]byte{0, 0, 0, 3}))
+		assert(t, err == ErrInvalidThriftMagic, err)
+	})
+	t.Run("invalid-message-type", func(t *testing.T) {
+		err := (&Exception{}).read(newBytesReader(appendUint32(nil, thriftVersion1|0x2)))
+		assert(t, err == ErrInvalidThriftMessageType, err)
+	})
+}
+
+func TestExceptionType_String(t *testing.T) {
+	assert(t, ExceptionTypeUnknownMethod.String() == "unknown method", ExceptionTypeUnknownMethod.String())
+	assert(t, ExceptionTypeUnsupportedClientType.String() == "unsupported client type")
+	assert(t, ExceptionTypeCanceled.String() == "canceled")
+	assert(t, ExceptionType(100).String() == "exception type 100", ExceptionType(100).String())
+	assert(t, ExceptionTypeInternalError.Error() == "internal error")
+}
+
+func TestException_Type(t *testing.T) {
+	typeID := 6 // an int, as before ExceptionType was added
+	exc := NewException("method", 1, "message", typeID)
+	assert(t, exc.ExceptionType == typeID && exc.Type() == ExceptionTypeInternalError, exc)
+	exc = NewExceptionWithType("method", 1, "message", ExceptionTypeUnknownMethod)
+	assert(t, exc.ExceptionType == 1 && exc.Type() == ExceptionTypeUnknownMethod, exc)
+}
+
+func TestException_Error(t *testing.T) {
+	var err error = NewExceptionWithType("method", 1, "message", ExceptionTypeInternalError)
+	assert(t, err.Error() == "message", err.Error())
+	err = NewExceptionWithType("method", 1, "", ExceptionTypeBadSequenceID)
+	assert(t, err.Error() == "bad sequence id", err.Error())
+}
+
+func TestException_Is(t *testing.T) {
+	var err error = NewExceptionWithType("method", 1, "message", ExceptionTypeUnknownMethod)
+	assert(t, errors.Is(err, ExceptionTypeUnknownMethod))
+	assert(t, !errors.Is(err, ExceptionTypeInternalError))
+	assert(t, errors.Is(err, &Exception{ExceptionType: int(ExceptionTypeUnknownMethod)}))
+	assert(t, !errors.Is(err, &Exception{ExceptionType: int(ExceptionTypeUnknown)}))
+	assert(t, !errors.Is(err, (*Exception)(nil)))
+	assert(t, !errors.Is(err, io.EOF))
+
+	wrapped := fmt.Errorf("call failed: %w", err)
+	assert(t, errors.Is(wrapped, ExceptionTypeUnknownMethod))
+	var exc *Exception
+	assert(t, errors.As(wrapped, &exc) && exc.Message == "message", exc)
+}
+
+func TestException_BytesCompact(t *testing.T) {
+	buf, err := NewExceptionWithType("m", 1, "x", ExceptionTypeUnknownMethod).BytesCompact()
+	assert(t, err == nil, err)
+	expected := []byte{0x82, 0x61, 0x01, 0x01, 'm', 0x18, 0x01, 'x', 0x15, 0x02, 0x00}
+	assert(t, reflect.DeepEqual(buf, expected), buf)
+}
+
+func Test_exception_readCompact(t *testing.T) {
+	t.Run("round-trip", func(t *testing.T) {
+		expected := NewExceptionWithType("method", -100, "message", ExceptionTypeInternalError)
+		buf, err := expected.BytesCompact()
+		assert(t, err == nil, err)
+		exc := &Exception{}
+		err = exc.readCompact(newBytesReader(buf))
+		assert(t, err == nil, err)
+		assert(t, reflect.DeepEqual(exc, expected), exc)
+	})
+	t.Run("unknown-fields", func(t *testing.T) {
+		buf := appendCompactMessageBegin(nil, "method", thriftMessageTypeException, 1)
+		buf = appendUvarint(appendCompactFieldBegin(buf, compactTypeInt32, fieldIDMessage, 0), 1)
+		buf = append(appendCompactFieldBegin(buf, compactTypeStruct, 3, 1), testCompactStruct()...)
+		buf = appendCompactString(appendCompactFieldBegin(buf, compactTypeBinary, fieldIDMessage, 3), "message")
+		buf = appendUvarint(appendCompactFieldBegin(buf, compactTypeInt32, fieldIDExceptionType, 1), zigzag(7))
+		buf = append(buf, compactTypeStop)
+		exc := &Exception{}
+		err := exc.readCompact(newBytesReader(buf))
+		assert(t, err == nil, err)
+		assert(t, reflect.DeepEqual(exc, NewExceptionWithType("method", 1, "message", ExceptionTypeProtocolError)), exc)
+	})
+	t.Run("invalid-message-type", func(t *testing.T) {
+		buf := appendCompactMessageBegin(nil, "method", 2, 1)
+		err := (&Exception{}).readCompact(newBytesReader(buf))
+		assert(t, err == ErrInvalidThriftMessageType, err)
+	})
+}
+
+func TestException_BytesKitexProtobuf(t *testing.T) {
+	buf, err := NewExceptionWithType("m", 1, "x", ExceptionTypeUnknownMethod).BytesKitexProtobuf()
+	assert(t, err == nil, err)
+	expected := []byte{0x90, 0x01, 0x00, 0x03, 0, 0, 0, 1, 'm', 0, 0, 0, 1, 0x08, 0x01, 0x12, 0x01, 'x'}
+	assert(t, reflect.DeepEqual(buf, expected), buf)
+}
+
+func Test_exception_readKitexProtobuf(t *testing.T) {
+	header := appendUint32(nil, kitexProtobufMagic|thriftMessageTypeException)
+	header = appendThriftString(header, "method")
+	header = appendI32(header, 1)
+
+	t.Run("round-trip", func(t *testing.T) {
+		for _, expected := range []*Exception{
+			NewExceptionWithType("method", 1, "message", ExceptionTypeInternalError),
+			NewException("", -1, "", -1),
+		} {
+			buf, err := expected.BytesKitexProtobuf()
+			assert(t, err == nil, err)
+			exc := &Exception{}
+			err = exc.readKitexProtobuf(newBytesReader(buf))
+			assert(t, err == nil, err)
+			assert(t, reflect.DeepEqual(exc, expected), exc)
+		}
+	})
+	t.Run("unknown-fields", func(t *testing.T) {
+		buf := appendProtoStringField(append([]byte(nil), header...), protoFieldIDExceptionType, "x") // unexpected type
+		buf = appendProtoVarintField(buf, 3, 1)
+		buf = appendProtoStringField(buf, protoFieldIDMessage, "message")
+		buf = appendProtoVarintField(buf, protoFieldIDExceptionType, 7)
+		exc := &Exception{}
+		err := exc.readKitexProtobuf(newBytesReader(buf))
+		assert(t, err == nil, err)
+		assert(t, reflect.DeepEqual(exc, NewExceptionWithType("method", 1, "message", ExceptionTypeProtocolError)), exc)
+	})
+	t.Run("truncated", func(t *testing.T) {
+		buf := appendProtoTag(append([]byte(nil), header...), protoFieldIDMessage, protoWireBytes)
+		err := (&Exception{}).readKitexProtobuf(newBytesReader(append(buf, 5, 'a')))
+		assert(t, err == io.EOF, err)
+	})
+	t.Run("invalid-magic", func(t *testing.T) {
+		err := (&Exception{}).readKitexProtobuf(newBytesReader(appendUint32(nil, thriftVersion1|3)))
+		assert(t, err == ErrInvalidThriftMagic, err)
+	})
+	t.Run("invalid-message-type", func(t *testing.T) {
+		err := (&Exception{}).readKitexProtobuf(newBytesReader(appendUint32(nil, kitexProtobufMagic|2)))
+		assert(t, err == ErrInvalidThriftMessageType, err)
+	})
+}
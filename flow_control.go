@@ -0,0 +1,171 @@
+package ttheader
+
+import (
+	"context"
+	"strconv"
+)
+
+const (
+	// StrKeyWindowUpdate is the key in strInfo of meta frames for flow control,
+	// whose value is the increment (in bytes of data frame payloads) of the receiver's window
+	StrKeyWindowUpdate = "window-update"
+
+	// DefaultStreamWindowSize is the default window size of a stream for flow control
+	DefaultStreamWindowSize = 64 * 1024
+	// DefaultConnWindowSize is the default window size of a connection for flow control
+	DefaultConnWindowSize = 16 * DefaultStreamWindowSize
+)
+
+// Flow control in ttheader streaming is credit-based, per stream and per connection:
+//   - each side starts with the peer's windows, i.e. the initial credits in bytes of data frame payloads;
+//   - a data frame is sent only when both the stream and the connection have positive credits, which are then
+//     reduced by the payload size; a frame larger than the credits is allowed, so that large messages never block;
+//   - the receiver returns credits by meta frames with StrKeyWindowUpdate (seqID 0 for the connection)
+//     after at least half of the window has been consumed, i.e. read by the application;
+//   - window updates can be sent after the trailer (see Stream), since the peer may be still sending.
+//
+// Note: window sizes are not negotiated, so both sides must enable flow control with the same sizes.
+
+// NewWindowUpdateFrame creates a meta frame returning the credits to the peer; seqID 0 is for the connection
+func NewWindowUpdateFrame(seqID int32, increment int) *Frame {
+	return NewMetaFrame(seqID, map[string]string{StrKeyWindowUpdate: strconv.Itoa(increment)}, nil)
+}
+
+// WindowUpdate returns the increment of the window if the frame is a valid window update
+func (f *Frame) WindowUpdate() (int, bool) {
+	if f.header == nil || f.Type() != FrameKindMeta {
+		return 0, false
+	}
+	value, ok := f.header.GetStrKey(StrKeyWindowUpdate)
+	if !ok {
+		return 0, false
+	}
+	increment, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || increment <= 0 {
+		return 0, false
+	}
+	return int(increment), true
+}
+
+// WithMuxFlowControl enables flow control with the window sizes; sizes <= 0 mean the default ones
+// Note: the peer must enable it with the same sizes.
+func WithMuxFlowControl(streamWindow, connWindow int) MuxOption {
+	return func(m *Mux) {
+		if streamWindow <= 0 {
+			streamWindow = DefaultStreamWindowSize
+		}
+		if connWindow <= 0 {
+			connWindow = DefaultConnWindowSize
+		}
+		m.streamWindow, m.connWindow = streamWindow, connWindow
+	}
+}
+
+// flowControl reports whether flow control is enabled
+func (m *Mux) flowControl() bool {
+	return m.streamWindow > 0
+}
+
+// updateWindow adds the credits from the peer; the caller should hold the lock
+func (m *Mux) updateWindow(seqID int32, increment int) {
+	if seqID == 0 {
+		m.sendWindow += increment
+	} else if s, ok := m.streams[seqID]; ok {
+		s.sendWindow += increment
+	} else {
+		return
+	}
+	m.notifyWindow()
+}
+
+// notifyWindow wakes up all writers waiting for credits; the caller should hold the lock
+func (m *Mux) notifyWindow() {
+	close(m.windowCh)
+	m.windowCh = make(chan struct{})
+}
+
+// consume records the received data consumed (or discarded), and returns the credits to the peer if necessary
+// s is nil for data not belonging to any active stream.
+func (m *Mux) consume(s *MuxStream, n int) {
+	if !m.flowControl() || n == 0 {
+		return
+	}
+	var updates []*Frame
+	m.mu.Lock()
+	m.recvConsumed += n
+	if m.recvConsumed >= m.connWindow/2 {
+		updates = append(updates, NewWindowUpdateFrame(0, m.recvConsumed))
+		m.recvConsumed = 0
+	}
+	if s != nil && s.state.RecvState() != StreamStateClosed { // no more data after the trailer
+		s.recvConsumed += n
+		if s.recvConsumed >= m.streamWindow/2 {
+			updates = append(updates, NewWindowUpdateFrame(s.SeqID(), s.recvConsumed))
+			s.recvConsumed = 0
+		}
+	}
+	m.mu.Unlock()
+	for _, f := range updates {
+		if m.writeFrame(f) != nil {
+			return
+		}
+	}
+}
+
+// consumeAsync records the discarded data in the reader goroutine, which should never block on writing
+func (m *Mux) consumeAsync(n int) {
+	if m.flowControl() && n > 0 {
+		go m.consume(nil, n)
+	}
+}
+
+// acquireWindow waits until both the stream and the connection have positive credits, and takes n bytes
+// Note: if the stream ends normally while waiting, it returns nil without taking credits, leaving the error
+// to the state machine.
+func (s *MuxStream) acquireWindow(ctx context.Context, n int) error {
+	m := s.mux
+	for {
+		m.mu.Lock()
+		if err := m.err; err != nil {
+			m.mu.Unlock()
+			return unexpectedEOF(err)
+		}
+		if s.sendWindow > 0 && m.sendWindow > 0 {
+			s.sendWindow -= n
+			m.sendWindow -= n
+			m.mu.Unlock()
+			return nil
+		}
+		windowCh := m.windowCh
+		m.mu.Unlock()
+		select {
+		case <-windowCh:
+		case <-m.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.ctx.Done():
+			s.mu.Lock()
+			err := s.err
+			s.mu.Unlock()
+			return err
+		}
+	}
+}
+
+// releaseWindow gives back the credits taken for a frame which is not sent
+func (s *MuxStream) releaseWindow(n int) {
+	m := s.mux
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.sendWindow += n
+	m.sendWindow += n
+	m.notifyWindow()
+}
+
+// dataSize returns the payload size of data frames, i.e. the size counted by flow control
+func dataSize(f *Frame) int {
+	if f.Type() != FrameKindData {
+		return 0
+	}
+	return len(f.payload)
+}
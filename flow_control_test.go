@@ -0,0 +1,208 @@
+package ttheader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestFlowControlMuxPair(t *testing.T, streamWindow, connWindow int) (client, server *Mux) {
+	c, s := net.Pipe()
+	client = NewClientMux(c, WithMuxFlowControl(streamWindow, connWindow))
+	server = NewServerMux(s, WithMuxFlowControl(streamWindow, connWindow))
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	return client, server
+}
+
+// writeAsync writes the frame in another goroutine, returning a channel of the result
+func writeAsync(s *MuxStream, f *Frame) <-chan error {
+	ch := make(chan error, 1)
+	go func() {
+		ch <- s.WriteFrame(f)
+	}()
+	return ch
+}
+
+func assertBlocked(t *testing.T, ch <-chan error) {
+	select {
+	case err := <-ch:
+		t.Fatal("not blocked", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func assertUnblocked(t *testing.T, ctx context.Context, ch <-chan error) {
+	select {
+	case err := <-ch:
+		assert(t, err == nil, err)
+	case <-ctx.Done():
+		t.Fatal("still blocked")
+	}
+}
+
+func TestNewWindowUpdateFrame(t *testing.T) {
+	f := NewWindowUpdateFrame(0, 100)
+	assert(t, f.Type() == FrameKindMeta && f.Header().IsStreaming(), f.Header())
+	increment, ok := f.WindowUpdate()
+	assert(t, ok && increment == 100, increment)
+
+	for _, value := range []string{"0", "-1", "x", "4294967296"} {
+		_, ok = NewMetaFrame(1, map[string]string{StrKeyWindowUpdate: value}, nil).WindowUpdate()
+		assert(t, !ok, value)
+	}
+	_, ok = NewMetaFrame(1, nil, nil).WindowUpdate()
+	assert(t, !ok)
+	_, ok = NewTrailerFrame(1, map[string]string{StrKeyWindowUpdate: "1"}, nil).WindowUpdate()
+	assert(t, !ok, "not a meta frame")
+	_, ok = NewFrame(nil, nil).WindowUpdate()
+	assert(t, !ok)
+}
+
+func TestWithMuxFlowControl(t *testing.T) {
+	m := &Mux{}
+	WithMuxFlowControl(0, 0)(m)
+	assert(t, m.streamWindow == DefaultStreamWindowSize && m.connWindow == DefaultConnWindowSize, m.streamWindow, m.connWindow)
+	WithMuxFlowControl(1, 2)(m)
+	assert(t, m.streamWindow == 1 && m.connWindow == 2, m.streamWindow, m.connWindow)
+}
+
+func TestMux_FlowControl(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 8)
+
+	t.Run("stream-window", func(t *testing.T) {
+		ctx := testContext(t)
+		client, server := newTestFlowControlMuxPair(t, 10, 1000)
+		s, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		assert(t, s.WriteFrame(NewHeaderFrame(s.SeqID(), nil, nil)) == nil)
+		assert(t, s.WriteFrame(NewDataFrame(s.SeqID(), payload)) == nil)
+		assert(t, s.WriteFrame(NewDataFrame(s.SeqID(), payload)) == nil, "credits (2) are positive")
+		ch := writeAsync(s, NewDataFrame(s.SeqID(), payload))
+		assertBlocked(t, ch)
+		assert(t, s.WriteFrame(NewMetaFrame(s.SeqID(), nil, nil)) == nil, "only data frames are blocked")
+
+		other, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		assert(t, other.WriteFrame(NewHeaderFrame(other.SeqID(), nil, nil)) == nil)
+		assert(t, other.WriteFrame(NewDataFrame(other.SeqID(), payload)) == nil, "other streams are not blocked")
+
+		ss, err := server.Accept(ctx)
+		assert(t, err == nil, err)
+		_, err = ss.ReadFrame(ctx) // header
+		assert(t, err == nil, err)
+		assertBlocked(t, ch)
+		f, err := ss.ReadFrame(ctx) // data, which returns 8 bytes of credits
+		assert(t, err == nil && f.Type() == FrameKindData, f, err)
+		assertUnblocked(t, ctx, ch)
+	})
+
+	t.Run("conn-window", func(t *testing.T) {
+		ctx := testContext(t)
+		client, server := newTestFlowControlMuxPair(t, 1000, 10)
+		s1, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		assert(t, s1.WriteFrame(NewHeaderFrame(s1.SeqID(), nil, nil)) == nil)
+		assert(t, s1.WriteFrame(NewDataFrame(s1.SeqID(), payload)) == nil)
+		assert(t, s1.WriteFrame(NewDataFrame(s1.SeqID(), payload)) == nil)
+
+		s2, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		assert(t, s2.WriteFrame(NewHeaderFrame(s2.SeqID(), nil, nil)) == nil)
+		ch := writeAsync(s2, NewDataFrame(s2.SeqID(), payload))
+		assertBlocked(t, ch)
+
+		ss, err := server.Accept(ctx)
+		assert(t, err == nil, err)
+		for i := 0; i < 2; i++ {
+			_, err = ss.ReadFrame(ctx)
+			assert(t, err == nil, err)
+		}
+		assertUnblocked(t, ctx, ch)
+	})
+
+	t.Run("discarded-by-cancel", func(t *testing.T) {
+		ctx := testContext(t)
+		client, server := newTestFlowControlMuxPair(t, 1000, 10)
+		s1, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		assert(t, s1.WriteFrame(NewHeaderFrame(s1.SeqID(), nil, nil)) == nil)
+		assert(t, s1.WriteFrame(NewDataFrame(s1.SeqID(), payload)) == nil)
+		assert(t, s1.WriteFrame(NewDataFrame(s1.SeqID(), payload)) == nil)
+		s2, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		assert(t, s2.WriteFrame(NewHeaderFrame(s2.SeqID(), nil, nil)) == nil)
+		ch := writeAsync(s2, NewDataFrame(s2.SeqID(), payload))
+		assertBlocked(t, ch)
+
+		ss, err := server.Accept(ctx)
+		assert(t, err == nil, err)
+		// credits of data queued (or arriving after canceled) are returned
+		assert(t, ss.Cancel() == nil)
+		assertUnblocked(t, ctx, ch)
+	})
+
+	t.Run("canceled-while-blocked", func(t *testing.T) {
+		ctx := testContext(t)
+		client, _ := newTestFlowControlMuxPair(t, 10, 1000)
+		s, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		assert(t, s.WriteFrame(NewHeaderFrame(s.SeqID(), nil, nil)) == nil)
+		assert(t, s.WriteFrame(NewDataFrame(s.SeqID(), bytes.Repeat([]byte("x"), 100))) == nil, "large frames are allowed")
+		ch := writeAsync(s, NewDataFrame(s.SeqID(), payload))
+		assertBlocked(t, ch)
+		assert(t, s.Cancel() == nil)
+		select {
+		case err = <-ch:
+			assert(t, errors.Is(err, ExceptionTypeCanceled), err)
+		case <-ctx.Done():
+			t.Fatal("still blocked")
+		}
+	})
+
+	t.Run("window-update-after-trailer", func(t *testing.T) {
+		ctx := testContext(t)
+		client, server := newTestFlowControlMuxPair(t, 10, 1000)
+		s, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		assert(t, s.WriteFrame(NewHeaderFrame(s.SeqID(), nil, nil)) == nil)
+		assert(t, s.WriteFrame(NewTrailerFrame(s.SeqID(), nil, nil)) == nil)
+
+		ss, err := server.Accept(ctx)
+		assert(t, err == nil, err)
+		assert(t, ss.WriteFrame(NewHeaderFrame(ss.SeqID(), nil, nil)) == nil)
+		assert(t, ss.WriteFrame(NewDataFrame(ss.SeqID(), payload)) == nil)
+		assert(t, ss.WriteFrame(NewDataFrame(ss.SeqID(), payload)) == nil)
+		ch := writeAsync(ss, NewDataFrame(ss.SeqID(), payload))
+		assertBlocked(t, ch)
+		for i := 0; i < 2; i++ {
+			_, err = s.ReadFrame(ctx)
+			assert(t, err == nil, err)
+		}
+		assertUnblocked(t, ctx, ch)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		ctx := testContext(t)
+		client, _ := newTestMuxPair(t)
+		s, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		assert(t, s.WriteFrame(NewHeaderFrame(s.SeqID(), nil, nil)) == nil)
+		ch := make(chan error, 1)
+		go func() {
+			for i := 0; i < 10; i++ {
+				if err := s.WriteFrame(NewDataFrame(s.SeqID(), bytes.Repeat([]byte("x"), DefaultStreamWindowSize))); err != nil {
+					ch <- err
+					return
+				}
+			}
+			ch <- nil
+		}()
+		assertUnblocked(t, ctx, ch)
+	})
+}
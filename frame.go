@@ -4,9 +4,12 @@ import (
 	"encoding/binary"
 	"errors"
 	"io"
+	"net"
 	"strconv"
 )
 
+var ErrInvalidFrameSize = errors.New("invalid frame size")
+
 // Frame is a framed message, including size, header and payload
 type Frame struct {
 	size    int
@@ -36,15 +39,65 @@ func (f *Frame) Payload() []byte {
 	return f.payload
 }
 
+// PayloadAsException decodes the payload as an exception, in the protocol specified by Header.ProtocolID
+// Note: payloads with unknown protocols are decoded in thrift binary for compatibility
 func (f *Frame) PayloadAsException() (exception *Exception, err error) {
 	if len(f.payload) == 0 {
 		return nil, nil
 	}
 	exc := &Exception{}
-	err = exc.read(newBytesReader(f.payload))
+	reader := newBytesReader(f.payload)
+	switch f.protocolID() {
+	case ProtocolIDThriftCompact, ProtocolIDThriftCompactV2:
+		err = exc.readCompact(reader)
+	case ProtocolIDKitexProtobuf:
+		err = exc.readKitexProtobuf(reader)
+	default:
+		err = exc.read(reader)
+	}
 	return exc, err
 }
 
+func (f *Frame) protocolID() uint8 {
+	if f.header == nil {
+		return ProtocolIDThriftBinary
+	}
+	return f.header.ProtocolID()
+}
+
+// PayloadMessage decodes the message envelope (method name, message type and seqID) at the beginning
+// of the payload, in the protocol specified by Header.ProtocolID
+// If the envelope's seqID differs from Header.SeqID, the envelope is returned together with ErrSeqIDMismatch.
+func (f *Frame) PayloadMessage() (*MessageBegin, error) {
+	msg, _, err := ReadMessageBegin(f.payload, f.protocolID())
+	if err != nil {
+		return nil, err
+	}
+	if f.header != nil && msg.SeqID != f.header.SeqID() {
+		return msg, ErrSeqIDMismatch
+	}
+	return msg, nil
+}
+
+// Err returns the error carried by the frame in one call:
+// (1) an *Exception, if the payload is an exception;
+// (2) a *BizError, if the biz status in strInfo is set and non-zero;
+// (3) otherwise nil.
+// An error decoding the exception or biz status is returned as is.
+func (f *Frame) Err() error {
+	if f.header == nil {
+		return nil
+	}
+	if isExceptionPayload(f.header.ProtocolID(), f.payload) {
+		exc, err := f.PayloadAsException()
+		if err != nil {
+			return err
+		}
+		return exc
+	}
+	return readBizError(f.header)
+}
+
 // Bytes encodes the frame to bytes
 func (f *Frame) Bytes() ([]byte, error) {
 	headerSize, err := f.Header().BytesLength()
@@ -82,21 +135,129 @@ func (f *Frame) WriteHeader(buf []byte, headerSize, payloadSize int) error {
 	return f.header.WriteWithSize(buf[4:4+headerSize], headerSize)
 }
 
+// WriteTo writes the frame to io.Writer, implementing io.WriterTo
+// The size and header are encoded into a small buffer, and the payload is written as is by a vectored write
+// (writev, if supported by the writer, e.g. *net.TCPConn), so there's no copy of the payload
+func (f *Frame) WriteTo(writer io.Writer) (int64, error) {
+	headerSize, err := f.Header().BytesLength()
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 4+headerSize)
+	if err = f.WriteHeader(buf, headerSize, len(f.payload)); err != nil {
+		return 0, err
+	}
+	buffers := net.Buffers{buf}
+	if len(f.payload) > 0 {
+		buffers = append(buffers, f.payload)
+	}
+	return buffers.WriteTo(writer)
+}
+
+// WriteFrames writes the frames to io.Writer with one vectored write, without copying the payloads
+func WriteFrames(writer io.Writer, frames ...*Frame) (int64, error) {
+	headerSizes := make([]int, len(frames))
+	total := 0
+	for i, f := range frames {
+		headerSize, err := f.Header().BytesLength()
+		if err != nil {
+			return 0, err
+		}
+		headerSizes[i] = headerSize
+		total += 4 + headerSize
+	}
+	buf := make([]byte, total) // all headers share one allocation
+	buffers := make(net.Buffers, 0, 2*len(frames))
+	idx := 0
+	for i, f := range frames {
+		size := 4 + headerSizes[i]
+		if err := f.WriteHeader(buf[idx:idx+size], headerSizes[i], len(f.payload)); err != nil {
+			return 0, err
+		}
+		buffers = append(buffers, buf[idx:idx+size])
+		if len(f.payload) > 0 {
+			buffers = append(buffers, f.payload)
+		}
+		idx += size
+	}
+	return buffers.WriteTo(writer)
+}
+
 // Read decodes the frame from io.Reader
 // it reads 4 bytes first to get the frame size and then read the full frame
 func (f *Frame) Read(reader io.Reader) error {
+	return f.read(reader, 0)
+}
+
+// read is Read with a limit of the frame size (<= 0 means no limit), returning ErrFrameTooLarge if exceeded;
+// the buffer grows as data arrives (see appendFull), instead of by the size declared by the peer
+func (f *Frame) read(reader io.Reader, maxSize int) error {
 	buf := make([]byte, 4)
 	if _, err := io.ReadFull(reader, buf); err != nil {
 		return err
 	}
 	size := int(binary.BigEndian.Uint32(buf))
-	buf = make([]byte, size)
-	if _, err := io.ReadFull(reader, buf); err != nil {
+	if maxSize > 0 && size > maxSize {
+		return ErrFrameTooLarge
+	}
+	buf, err := appendFull(reader, make([]byte, 0, minInt(size, readChunkSize)), size)
+	if err != nil {
 		return err
 	}
 	return f.ReadWithSize(buf, size)
 }
 
+// ReadHeader decodes the frame size and header from io.Reader, leaving the payload unread
+// The payload can be streamed by the returned PayloadReader, which is limited to the declared frame size.
+// Note: the caller MUST read the PayloadReader until io.EOF or Close it before reading the next frame
+// from the same io.Reader; Close discards the unread payload so that the reader is positioned at the next frame.
+// If the header fails to decode, the payload is discarded as well, so the caller may move on to the next frame;
+// for other errors (e.g. ErrInvalidMagic, ErrInvalidFrameSize) the io.Reader is unusable.
+func (f *Frame) ReadHeader(reader io.Reader) (*PayloadReader, error) {
+	buf := make([]byte, 4+OffsetProtocol)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return nil, err
+	}
+	size := int(binary.BigEndian.Uint32(buf))
+	fixed := buf[4:]
+	if !IsMagic(fixed[OffsetMagic : OffsetMagic+2]) {
+		return nil, ErrInvalidMagic
+	}
+	headerSize := OffsetProtocol + int(binary.BigEndian.Uint16(fixed[OffsetSize:OffsetSize+2]))*PaddingSize
+	if headerSize < OffsetVariable || headerSize > size {
+		return nil, ErrInvalidFrameSize
+	}
+	headerBuf := make([]byte, headerSize)
+	copy(headerBuf, fixed)
+	if _, err := io.ReadFull(reader, headerBuf[OffsetProtocol:]); err != nil {
+		return nil, err
+	}
+	f.size = size
+	f.payload = nil
+	if f.header == nil {
+		f.header = NewHeader()
+	}
+	payloadReader := newPayloadReader(reader, size-headerSize)
+	if err := f.header.Read(headerBuf); err != nil {
+		if closeErr := payloadReader.Close(); closeErr != nil {
+			return nil, closeErr
+		}
+		return nil, err
+	}
+	return payloadReader, nil
+}
+
+// ReadFrameHeader reads the frame size and header from io.Reader, returning the frame without payload
+// and a PayloadReader for streaming the payload; see Frame.ReadHeader
+func ReadFrameHeader(reader io.Reader) (*Frame, *PayloadReader, error) {
+	f := &Frame{}
+	payloadReader, err := f.ReadHeader(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, payloadReader, nil
+}
+
 // ReadWithSize decodes the frame from bytes with given frame size
 // Note: the given buf should starts after the 4-byte frame size
 func (f *Frame) ReadWithSize(buf []byte, size int) error {
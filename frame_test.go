@@ -3,7 +3,10 @@ package ttheader
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"io"
 	"reflect"
+	"strconv"
 	"testing"
 )
 
@@ -124,6 +127,13 @@ func TestFrame_Read(t *testing.T) {
 		_, err := ReadFrame(bytes.NewReader(buf))
 		assert(t, err != nil, err)
 	})
+	t.Run("invalid-frame:huge-size", func(t *testing.T) {
+		buf := []byte{0xff, 0xff, 0xff, 0xff, 1}
+		f := &Frame{}
+		assert(t, f.read(bytes.NewReader(buf), 1024) == ErrFrameTooLarge)
+		_, err := ReadFrame(bytes.NewReader(buf)) // not allocating 4GB
+		assert(t, err == io.ErrUnexpectedEOF, err)
+	})
 	t.Run("normal", func(t *testing.T) {
 		h := NewHeader()
 		h.SetToken("token")
@@ -154,3 +164,218 @@ func TestFrame_Read(t *testing.T) {
 		assert(t, reflect.DeepEqual(fr.Payload(), payload), fr.Payload())
 	})
 }
+
+// vectorWriter records the net.Buffers passed by a vectored write
+type vectorWriter struct {
+	bytes.Buffer
+	vectors [][][]byte
+}
+
+// Write is called once per segment by net.Buffers.WriteTo, since it's not a net.Conn
+func (w *vectorWriter) Write(p []byte) (int, error) {
+	w.vectors = append(w.vectors, [][]byte{p})
+	return w.Buffer.Write(p)
+}
+
+func TestFrame_WriteTo(t *testing.T) {
+	t.Run("header-length:err", func(t *testing.T) {
+		h := NewHeader()
+		h.SetToken(string(make([]byte, 65536)))
+		_, err := NewFrame(h, nil).WriteTo(&bytes.Buffer{})
+		assert(t, err != nil, err)
+	})
+	t.Run("normal", func(t *testing.T) {
+		h := NewHeader()
+		h.SetSeqID(1)
+		payload := []byte{1, 2, 3, 4}
+		f := NewFrame(h, payload)
+		expected, err := f.Bytes()
+		assert(t, err == nil, err)
+
+		w := &vectorWriter{}
+		n, err := f.WriteTo(w)
+		assert(t, err == nil, err)
+		assert(t, n == int64(len(expected)), n)
+		assert(t, bytes.Equal(w.Bytes(), expected), w.Bytes())
+		assert(t, len(w.vectors) == 2, len(w.vectors))
+		assert(t, &w.vectors[1][0][0] == &payload[0]) // no copy of the payload
+	})
+	t.Run("empty-payload", func(t *testing.T) {
+		f := NewFrame(NewHeader(), nil)
+		w := &vectorWriter{}
+		_, err := f.WriteTo(w)
+		assert(t, err == nil, err)
+		assert(t, len(w.vectors) == 1, len(w.vectors))
+	})
+}
+
+func TestWriteFrames(t *testing.T) {
+	t.Run("header-length:err", func(t *testing.T) {
+		h := NewHeader()
+		h.SetToken(string(make([]byte, 65536)))
+		_, err := WriteFrames(&bytes.Buffer{}, NewFrame(NewHeader(), nil), NewFrame(h, nil))
+		assert(t, err != nil, err)
+	})
+	t.Run("normal", func(t *testing.T) {
+		var expected []byte
+		var frames []*Frame
+		for i := 0; i < 3; i++ {
+			h := NewHeader()
+			h.SetSeqID(int32(i))
+			f := NewFrame(h, []byte{byte(i)})
+			buf, err := f.Bytes()
+			assert(t, err == nil, err)
+			expected = append(expected, buf...)
+			frames = append(frames, f)
+		}
+		w := &vectorWriter{}
+		n, err := WriteFrames(w, frames...)
+		assert(t, err == nil, err)
+		assert(t, n == int64(len(expected)), n)
+		assert(t, bytes.Equal(w.Bytes(), expected))
+		assert(t, len(w.vectors) == 6, len(w.vectors))
+	})
+}
+
+func TestFrame_ReadHeader(t *testing.T) {
+	t.Run("invalid-frame:no-header", func(t *testing.T) {
+		buf := make([]byte, 8)
+		_, _, err := ReadFrameHeader(bytes.NewReader(buf))
+		assert(t, err != nil, err)
+	})
+	t.Run("invalid-magic", func(t *testing.T) {
+		buf := make([]byte, 32)
+		binary.BigEndian.PutUint32(buf, 28)
+		_, _, err := ReadFrameHeader(bytes.NewReader(buf))
+		assert(t, err == ErrInvalidMagic, err)
+	})
+	t.Run("invalid-header-size", func(t *testing.T) {
+		f := NewFrame(NewHeader(), nil)
+		buf, err := f.Bytes()
+		assert(t, err == nil, err)
+		binary.BigEndian.PutUint32(buf, 4) // less than the header size
+		_, _, err = ReadFrameHeader(bytes.NewReader(buf))
+		assert(t, err == ErrInvalidFrameSize, err)
+	})
+	t.Run("invalid-header:skip-payload", func(t *testing.T) {
+		h := NewHeader()
+		h.SetToken("token")
+		stream, err := NewFrame(h, bytes.Repeat([]byte{1}, 100)).Bytes()
+		assert(t, err == nil, err)
+		stream[4+OffsetVariable] = 0x7f // invalid info id
+		next, err := NewFrame(NewHeader(), []byte("next")).Bytes()
+		assert(t, err == nil, err)
+		reader := bytes.NewReader(append(stream, next...))
+
+		_, _, err = ReadFrameHeader(reader)
+		assert(t, err != nil, err)
+		f, payloadReader, err := ReadFrameHeader(reader)
+		assert(t, err == nil, "positioned at the next frame", err)
+		payload, err := io.ReadAll(payloadReader)
+		assert(t, err == nil && string(payload) == "next", f, payload, err)
+	})
+	t.Run("stream-payload", func(t *testing.T) {
+		var stream []byte
+		for i := 1; i <= 2; i++ {
+			h := NewHeader()
+			h.SetSeqID(int32(i))
+			h.SetToken("token")
+			buf, err := NewFrame(h, bytes.Repeat([]byte{byte(i)}, 100)).Bytes()
+			assert(t, err == nil, err)
+			stream = append(stream, buf...)
+		}
+		reader := bytes.NewReader(stream)
+
+		f, payloadReader, err := ReadFrameHeader(reader)
+		assert(t, err == nil, err)
+		assert(t, f.Header().SeqID() == 1, f.Header().SeqID())
+		assert(t, f.Header().Token() == "token", f.Header().Token())
+		assert(t, f.Payload() == nil)
+		assert(t, payloadReader.Remaining() == 100, payloadReader.Remaining())
+		partial := make([]byte, 10)
+		_, err = io.ReadFull(payloadReader, partial)
+		assert(t, err == nil, err)
+		assert(t, bytes.Equal(partial, bytes.Repeat([]byte{1}, 10)), partial)
+		assert(t, payloadReader.Close() == nil) // skip the rest
+
+		f, payloadReader, err = ReadFrameHeader(reader)
+		assert(t, err == nil, err)
+		assert(t, f.Header().SeqID() == 2, f.Header().SeqID())
+		payload, err := io.ReadAll(payloadReader)
+		assert(t, err == nil, err)
+		assert(t, bytes.Equal(payload, bytes.Repeat([]byte{2}, 100)), payload)
+		assert(t, reader.Len() == 0, reader.Len())
+	})
+}
+
+func TestFrame_Err(t *testing.T) {
+	t.Run("no-header", func(t *testing.T) {
+		assert(t, NewFrame(nil, nil).Err() == nil)
+	})
+	t.Run("normal-reply", func(t *testing.T) {
+		f := NewFrame(NewHeader(), testThriftMessage(1))
+		assert(t, f.Err() == nil)
+	})
+	t.Run("exception", func(t *testing.T) {
+		payload, err := NewException("method", 1, "message", 6).Bytes()
+		assert(t, err == nil, err)
+		err = NewFrame(NewHeader(), payload).Err()
+		exc, ok := err.(*Exception)
+		assert(t, ok, err)
+		assert(t, exc.Message == "message" && exc.ExceptionType == 6, exc)
+	})
+	t.Run("exception:malformed", func(t *testing.T) {
+		payload, err := NewException("method", 1, "message", 6).Bytes()
+		assert(t, err == nil, err)
+		err = NewFrame(NewHeader(), payload[:10]).Err()
+		_, ok := err.(*Exception)
+		assert(t, err != nil && !ok, err)
+	})
+	t.Run("biz-error", func(t *testing.T) {
+		h := NewHeaderWithInfo(nil, map[string]string{StrKeyBizStatus: "100", StrKeyBizMessage: "message"})
+		err := NewFrame(h, testThriftMessage(1)).Err()
+		bizErr, ok := err.(*BizError)
+		assert(t, ok, err)
+		assert(t, bizErr.StatusCode == 100 && bizErr.Message == "message", bizErr)
+	})
+}
+
+func TestFrame_PayloadAsException(t *testing.T) {
+	exc := NewExceptionWithType("method", 1, "message", ExceptionTypeInternalError)
+	t.Run("empty", func(t *testing.T) {
+		decoded, err := NewFrame(NewHeader(), nil).PayloadAsException()
+		assert(t, decoded == nil && err == nil, decoded, err)
+	})
+	for _, protocolID := range []uint8{ProtocolIDThriftBinary, ProtocolIDThriftCompact, ProtocolIDThriftCompactV2, ProtocolIDKitexProtobuf} {
+		t.Run("protocol-"+strconv.Itoa(int(protocolID)), func(t *testing.T) {
+			payload, err := exc.encode(protocolID)
+			assert(t, err == nil, err)
+			h := NewHeader()
+			h.SetProtocolID(protocolID)
+			f := NewFrame(h, payload)
+			decoded, err := f.PayloadAsException()
+			assert(t, err == nil, err)
+			assert(t, reflect.DeepEqual(decoded, exc), decoded)
+			assert(t, errors.Is(f.Err(), ExceptionTypeInternalError), f.Err())
+		})
+	}
+}
+
+func TestFrame_PayloadMessage(t *testing.T) {
+	h := NewHeader()
+	h.SetSeqID(100)
+	t.Run("normal", func(t *testing.T) {
+		msg, err := NewFrame(h, testThriftMessage(100)).PayloadMessage()
+		assert(t, err == nil, err)
+		assert(t, reflect.DeepEqual(msg, &MessageBegin{Name: "method", Type: MessageTypeCall, SeqID: 100}), msg)
+	})
+	t.Run("seqID-mismatch", func(t *testing.T) {
+		msg, err := NewFrame(h, testThriftMessage(1)).PayloadMessage()
+		assert(t, err == ErrSeqIDMismatch, err)
+		assert(t, msg != nil && msg.SeqID == 1, msg)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewFrame(h, nil).PayloadMessage()
+		assert(t, err == io.EOF, err)
+	})
+}
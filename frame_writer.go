@@ -0,0 +1,237 @@
+package ttheader
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFlushThreshold is the default buffered size which triggers an automatic flush
+	DefaultFlushThreshold = 64 * 1024
+
+	// buffers larger than this are released after flushing instead of being reused
+	maxRetainedBufferSize = 4 * 1024 * 1024
+)
+
+var ErrFrameWriterClosed = errors.New("frame writer closed")
+
+// FrameWriter encodes frames directly into an internal buffer, and writes them to the underlying
+// io.Writer in batches, so that several small frames can be sent with a single write syscall.
+// Buffered frames are written when:
+// (1) Flush is called;
+// (2) the buffered size reaches the flush threshold;
+// (3) the flush latency (if set) has elapsed since the first frame was buffered.
+// Payloads no smaller than the zero-copy threshold (if set) are not copied into the buffer, but referenced
+// and written together with the buffered bytes by a vectored write (writev).
+// It's safe for concurrent use by multiple goroutines; frames are written in the order WriteFrame is called.
+type FrameWriter struct {
+	writer            io.Writer
+	threshold         int
+	latency           time.Duration
+	zeroCopyThreshold int
+
+	mu       sync.Mutex
+	buf      []byte
+	bufs     net.Buffers // pending segments, only used when there's a zero-copy payload
+	mark     int         // buf[:mark] has been appended to bufs
+	buffered int         // total size of pending bytes, including referenced payloads
+	timer    *time.Timer
+	timerGen uint64
+	err      error // sticky error: the underlying stream is broken after a failed write
+}
+
+// FrameWriterOption customizes a FrameWriter
+type FrameWriterOption func(w *FrameWriter)
+
+// WithFlushThreshold sets the buffered size which triggers an automatic flush
+// Note: a threshold <= 0 makes every WriteFrame flush immediately
+func WithFlushThreshold(threshold int) FrameWriterOption {
+	return func(w *FrameWriter) {
+		w.threshold = threshold
+	}
+}
+
+// WithFlushLatency sets the max duration a frame may stay in the buffer before being flushed
+// Note: a latency <= 0 (the default) disables the timer, leaving the flush to the threshold or the caller
+func WithFlushLatency(latency time.Duration) FrameWriterOption {
+	return func(w *FrameWriter) {
+		w.latency = latency
+	}
+}
+
+// WithZeroCopyThreshold makes payloads with at least the given size be written without copying
+// Note: the caller MUST NOT modify such payloads until they're flushed;
+// a threshold <= 0 (the default) disables it, i.e. all payloads are copied
+func WithZeroCopyThreshold(threshold int) FrameWriterOption {
+	return func(w *FrameWriter) {
+		w.zeroCopyThreshold = threshold
+	}
+}
+
+// NewFrameWriter returns a new FrameWriter writing to the given io.Writer
+func NewFrameWriter(writer io.Writer, opts ...FrameWriterOption) *FrameWriter {
+	w := &FrameWriter{
+		writer:    writer,
+		threshold: DefaultFlushThreshold,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// WriteFrame encodes the frame into the buffer, and flushes it if the threshold is reached
+// Note: the payload is copied unless it reaches the zero-copy threshold, see WithZeroCopyThreshold
+func (w *FrameWriter) WriteFrame(f *Frame) error {
+	headerSize, err := f.Header().BytesLength()
+	if err != nil {
+		return err
+	}
+	payloadSize := len(f.payload)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	if w.zeroCopyThreshold > 0 && payloadSize >= w.zeroCopyThreshold {
+		err = w.appendHeader(f, headerSize, payloadSize)
+	} else {
+		err = w.appendFrame(f, headerSize, payloadSize)
+	}
+	if err != nil {
+		return err
+	}
+	w.buffered += 4 + headerSize + payloadSize
+	if w.buffered >= w.threshold {
+		return w.flush()
+	}
+	if w.latency > 0 && w.timer == nil {
+		w.timerGen++
+		gen := w.timerGen
+		w.timer = time.AfterFunc(w.latency, func() {
+			w.flushByTimer(gen)
+		})
+	}
+	return nil
+}
+
+// Flush writes all buffered frames to the underlying io.Writer
+func (w *FrameWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	return w.flush()
+}
+
+// Buffered returns the number of bytes buffered but not yet written, including referenced payloads
+func (w *FrameWriter) Buffered() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buffered
+}
+
+// Close flushes the buffered frames; any later write returns ErrFrameWriterClosed
+// Note: the underlying io.Writer is not closed
+func (w *FrameWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	err := w.flush()
+	if w.err == nil {
+		w.err = ErrFrameWriterClosed
+	}
+	return err
+}
+
+func (w *FrameWriter) flushByTimer(gen uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if gen != w.timerGen || w.timer == nil { // the buffer has been flushed by others
+		return
+	}
+	w.timer = nil
+	if w.err == nil {
+		_ = w.flush() // the error is kept and reported by the next call
+	}
+}
+
+// flush writes the buffer; the caller should hold the lock
+func (w *FrameWriter) flush() error {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if w.buffered == 0 {
+		return nil
+	}
+	var err error
+	if len(w.bufs) == 0 {
+		_, err = w.writer.Write(w.buf)
+	} else {
+		if w.mark < len(w.buf) {
+			w.bufs = append(w.bufs, w.buf[w.mark:])
+		}
+		bufs := w.bufs // WriteTo consumes the slice
+		_, err = bufs.WriteTo(w.writer)
+		for i := range w.bufs {
+			w.bufs[i] = nil // release referenced payloads
+		}
+		w.bufs = w.bufs[:0]
+	}
+	w.mark = 0
+	w.buffered = 0
+	if cap(w.buf) > maxRetainedBufferSize {
+		w.buf = nil
+	} else {
+		w.buf = w.buf[:0]
+	}
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
+
+// appendFrame encodes the whole frame into buf; the caller should hold the lock
+func (w *FrameWriter) appendFrame(f *Frame, headerSize, payloadSize int) error {
+	start := len(w.buf)
+	w.buf = growBuffer(w.buf, 4+headerSize+payloadSize)
+	if err := f.WriteWithSize(w.buf[start:], headerSize, payloadSize); err != nil {
+		w.buf = w.buf[:start] // drop the partially encoded frame
+		return err
+	}
+	return nil
+}
+
+// appendHeader encodes the size and header into buf, and references the payload without a copy;
+// the caller should hold the lock
+func (w *FrameWriter) appendHeader(f *Frame, headerSize, payloadSize int) error {
+	start := len(w.buf)
+	w.buf = growBuffer(w.buf, 4+headerSize)
+	if err := f.WriteHeader(w.buf[start:], headerSize, payloadSize); err != nil {
+		w.buf = w.buf[:start]
+		return err
+	}
+	// segments already in bufs stay valid even if buf is reallocated later, since they're never modified
+	w.bufs = append(w.bufs, w.buf[w.mark:], f.payload)
+	w.mark = len(w.buf)
+	return nil
+}
+
+// growBuffer extends the length of buf by n bytes, reallocating it if necessary
+func growBuffer(buf []byte, n int) []byte {
+	size := len(buf)
+	if cap(buf)-size >= n {
+		return buf[:size+n]
+	}
+	newBuf := make([]byte, size+n, 2*cap(buf)+n)
+	copy(newBuf, buf)
+	return newBuf
+}
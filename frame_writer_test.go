@@ -0,0 +1,218 @@
+package ttheader
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingWriter records the bytes and the number of Write calls
+type countingWriter struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	writes int
+	err    error
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.writes++
+	return w.buf.Write(p)
+}
+
+func (w *countingWriter) Writes() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.writes
+}
+
+func (w *countingWriter) Bytes() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]byte(nil), w.buf.Bytes()...)
+}
+
+func newTestFrame(seqID int32, payload []byte) *Frame {
+	h := NewHeader()
+	h.SetSeqID(seqID)
+	return NewFrame(h, payload)
+}
+
+func TestFrameWriter_WriteFrame(t *testing.T) {
+	t.Run("coalesce", func(t *testing.T) {
+		cw := &countingWriter{}
+		w := NewFrameWriter(cw)
+		for i := 1; i <= 3; i++ {
+			err := w.WriteFrame(newTestFrame(int32(i), []byte{1, 2, 3}))
+			assert(t, err == nil, err)
+		}
+		assert(t, cw.Writes() == 0, cw.Writes())
+		assert(t, w.Buffered() > 0)
+
+		err := w.Flush()
+		assert(t, err == nil, err)
+		assert(t, cw.Writes() == 1, cw.Writes())
+		assert(t, w.Buffered() == 0)
+
+		reader := bytes.NewReader(cw.Bytes())
+		for i := 1; i <= 3; i++ {
+			f, err := ReadFrame(reader)
+			assert(t, err == nil, err)
+			assert(t, f.Header().SeqID() == int32(i), f.Header().SeqID())
+			assert(t, bytes.Equal(f.Payload(), []byte{1, 2, 3}), f.Payload())
+		}
+		assert(t, reader.Len() == 0, reader.Len())
+	})
+	t.Run("threshold", func(t *testing.T) {
+		cw := &countingWriter{}
+		w := NewFrameWriter(cw, WithFlushThreshold(100))
+		err := w.WriteFrame(newTestFrame(1, make([]byte, 10)))
+		assert(t, err == nil, err)
+		assert(t, cw.Writes() == 0, cw.Writes())
+		err = w.WriteFrame(newTestFrame(2, make([]byte, 100)))
+		assert(t, err == nil, err)
+		assert(t, cw.Writes() == 1, cw.Writes())
+		assert(t, w.Buffered() == 0)
+	})
+	t.Run("zero-threshold", func(t *testing.T) {
+		cw := &countingWriter{}
+		w := NewFrameWriter(cw, WithFlushThreshold(0))
+		err := w.WriteFrame(newTestFrame(1, nil))
+		assert(t, err == nil, err)
+		assert(t, cw.Writes() == 1, cw.Writes())
+	})
+	t.Run("latency", func(t *testing.T) {
+		cw := &countingWriter{}
+		w := NewFrameWriter(cw, WithFlushLatency(10*time.Millisecond))
+		err := w.WriteFrame(newTestFrame(1, nil))
+		assert(t, err == nil, err)
+		err = w.WriteFrame(newTestFrame(2, nil))
+		assert(t, err == nil, err)
+		deadline := time.Now().Add(time.Second)
+		for cw.Writes() == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		assert(t, cw.Writes() == 1, cw.Writes())
+		assert(t, w.Buffered() == 0)
+	})
+	t.Run("encode-err", func(t *testing.T) {
+		cw := &countingWriter{}
+		w := NewFrameWriter(cw)
+		h := NewHeader()
+		h.SetToken(string(make([]byte, 65536)))
+		err := w.WriteFrame(NewFrame(h, nil))
+		assert(t, err != nil, err)
+		assert(t, w.Buffered() == 0)
+
+		err = w.WriteFrame(newTestFrame(1, nil)) // not sticky
+		assert(t, err == nil, err)
+	})
+	t.Run("write-err:sticky", func(t *testing.T) {
+		writeErr := errors.New("write error")
+		cw := &countingWriter{err: writeErr}
+		w := NewFrameWriter(cw)
+		err := w.WriteFrame(newTestFrame(1, nil))
+		assert(t, err == nil, err)
+		err = w.Flush()
+		assert(t, err == writeErr, err)
+		err = w.WriteFrame(newTestFrame(2, nil))
+		assert(t, err == writeErr, err)
+	})
+	t.Run("closed", func(t *testing.T) {
+		cw := &countingWriter{}
+		w := NewFrameWriter(cw)
+		err := w.WriteFrame(newTestFrame(1, nil))
+		assert(t, err == nil, err)
+		err = w.Close()
+		assert(t, err == nil, err)
+		assert(t, cw.Writes() == 1, cw.Writes())
+		err = w.WriteFrame(newTestFrame(2, nil))
+		assert(t, err == ErrFrameWriterClosed, err)
+	})
+	t.Run("concurrent", func(t *testing.T) {
+		cw := &countingWriter{}
+		w := NewFrameWriter(cw, WithFlushThreshold(256), WithFlushLatency(time.Millisecond))
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					if err := w.WriteFrame(newTestFrame(int32(i*100+j), []byte{byte(i), byte(j)})); err != nil {
+						t.Error(err) // t.Fatal should not be called from a non-test goroutine
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		err := w.Flush()
+		assert(t, err == nil, err)
+
+		reader := bytes.NewReader(cw.Bytes())
+		count := 0
+		for reader.Len() > 0 {
+			f, err := ReadFrame(reader)
+			assert(t, err == nil, err)
+			seqID := f.Header().SeqID()
+			assert(t, bytes.Equal(f.Payload(), []byte{byte(seqID / 100), byte(seqID % 100)}), f.Payload())
+			count++
+		}
+		assert(t, count == 400, count)
+	})
+}
+
+func Test_growBuffer(t *testing.T) {
+	buf := growBuffer(nil, 3)
+	assert(t, len(buf) == 3, len(buf))
+	copy(buf, "abc")
+	buf = growBuffer(buf, 5)
+	assert(t, len(buf) == 8, len(buf))
+	assert(t, string(buf[:3]) == "abc", buf)
+	buf = growBuffer(buf[:0], 2)
+	assert(t, len(buf) == 2 && cap(buf) >= 8, len(buf), cap(buf))
+}
+
+func TestFrameWriter_ZeroCopy(t *testing.T) {
+	t.Run("referenced", func(t *testing.T) {
+		cw := &countingWriter{}
+		w := NewFrameWriter(cw, WithZeroCopyThreshold(8))
+		small := []byte{1, 2}
+		large := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+		assert(t, w.WriteFrame(newTestFrame(1, small)) == nil)
+		assert(t, w.WriteFrame(newTestFrame(2, large)) == nil)
+		assert(t, w.WriteFrame(newTestFrame(3, small)) == nil)
+		assert(t, w.Buffered() > len(large)+2*len(small), w.Buffered())
+
+		small[0], large[0] = 9, 9 // small payloads are copied, large ones are referenced
+		assert(t, w.Flush() == nil)
+		assert(t, len(w.bufs) == 0, len(w.bufs))
+
+		reader := bytes.NewReader(cw.Bytes())
+		for i := 1; i <= 3; i++ {
+			f, err := ReadFrame(reader)
+			assert(t, err == nil, err)
+			assert(t, f.Header().SeqID() == int32(i), f.Header().SeqID())
+			if i == 2 {
+				assert(t, f.Payload()[0] == 9, f.Payload())
+			} else {
+				assert(t, f.Payload()[0] == 1, f.Payload())
+			}
+		}
+		assert(t, reader.Len() == 0, reader.Len())
+	})
+	t.Run("threshold-includes-payload", func(t *testing.T) {
+		cw := &countingWriter{}
+		w := NewFrameWriter(cw, WithZeroCopyThreshold(8), WithFlushThreshold(64))
+		assert(t, w.WriteFrame(newTestFrame(1, make([]byte, 64))) == nil)
+		assert(t, w.Buffered() == 0, w.Buffered())
+		f, err := ReadFrame(bytes.NewReader(cw.Bytes()))
+		assert(t, err == nil, err)
+		assert(t, len(f.Payload()) == 64, len(f.Payload()))
+	})
+}
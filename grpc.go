@@ -0,0 +1,263 @@
+package ttheader
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// keys in strInfo for the gRPC status of a streaming trailer frame, encoded as in gRPC over HTTP/2:
+// grpc-message is percent-encoded, and grpc-status-details-bin is base64 encoded (a serialized google.rpc.Status)
+const (
+	StrKeyGRPCStatus        = "grpc-status"
+	StrKeyGRPCMessage       = "grpc-message"
+	StrKeyGRPCStatusDetails = "grpc-status-details-bin"
+)
+
+// GRPCCode is the status code of gRPC
+type GRPCCode uint32
+
+const (
+	GRPCCodeOK                 GRPCCode = 0
+	GRPCCodeCanceled           GRPCCode = 1
+	GRPCCodeUnknown            GRPCCode = 2
+	GRPCCodeInvalidArgument    GRPCCode = 3
+	GRPCCodeDeadlineExceeded   GRPCCode = 4
+	GRPCCodeNotFound           GRPCCode = 5
+	GRPCCodeAlreadyExists      GRPCCode = 6
+	GRPCCodePermissionDenied   GRPCCode = 7
+	GRPCCodeResourceExhausted  GRPCCode = 8
+	GRPCCodeFailedPrecondition GRPCCode = 9
+	GRPCCodeAborted            GRPCCode = 10
+	GRPCCodeOutOfRange         GRPCCode = 11
+	GRPCCodeUnimplemented      GRPCCode = 12
+	GRPCCodeInternal           GRPCCode = 13
+	GRPCCodeUnavailable        GRPCCode = 14
+	GRPCCodeDataLoss           GRPCCode = 15
+	GRPCCodeUnauthenticated    GRPCCode = 16
+)
+
+var grpcCodeNames = map[GRPCCode]string{
+	GRPCCodeOK:                 "OK",
+	GRPCCodeCanceled:           "Canceled",
+	GRPCCodeUnknown:            "Unknown",
+	GRPCCodeInvalidArgument:    "InvalidArgument",
+	GRPCCodeDeadlineExceeded:   "DeadlineExceeded",
+	GRPCCodeNotFound:           "NotFound",
+	GRPCCodeAlreadyExists:      "AlreadyExists",
+	GRPCCodePermissionDenied:   "PermissionDenied",
+	GRPCCodeResourceExhausted:  "ResourceExhausted",
+	GRPCCodeFailedPrecondition: "FailedPrecondition",
+	GRPCCodeAborted:            "Aborted",
+	GRPCCodeOutOfRange:         "OutOfRange",
+	GRPCCodeUnimplemented:      "Unimplemented",
+	GRPCCodeInternal:           "Internal",
+	GRPCCodeUnavailable:        "Unavailable",
+	GRPCCodeDataLoss:           "DataLoss",
+	GRPCCodeUnauthenticated:    "Unauthenticated",
+}
+
+func (c GRPCCode) String() string {
+	if name, ok := grpcCodeNames[c]; ok {
+		return name
+	}
+	return "Code(" + strconv.Itoa(int(c)) + ")"
+}
+
+// exceptionTypeToGRPCCode maps exception types to gRPC codes; unlisted types are mapped to GRPCCodeInternal
+var exceptionTypeToGRPCCode = map[ExceptionType]GRPCCode{
+	ExceptionTypeUnknown:               GRPCCodeUnknown,
+	ExceptionTypeUnknownMethod:         GRPCCodeUnimplemented,
+	ExceptionTypeUnsupportedClientType: GRPCCodeUnimplemented,
+	ExceptionTypeCanceled:              GRPCCodeCanceled,
+}
+
+// grpcCodeToExceptionType maps gRPC codes to exception types; unlisted codes are mapped to ExceptionTypeInternalError
+var grpcCodeToExceptionType = map[GRPCCode]ExceptionType{
+	GRPCCodeUnknown:       ExceptionTypeUnknown,
+	GRPCCodeUnimplemented: ExceptionTypeUnknownMethod,
+	GRPCCodeCanceled:      ExceptionTypeCanceled,
+}
+
+// GRPCStatus is the status of gRPC, which is an error if the code is not OK
+type GRPCStatus struct {
+	Code    GRPCCode
+	Message string
+	// Details is the serialized google.rpc.Status, which is opaque to this package
+	Details []byte
+}
+
+func (s *GRPCStatus) Error() string {
+	return fmt.Sprintf("grpc error: code = %s desc = %s", s.Code, s.Message)
+}
+
+// Exception returns the exception for the status, or nil if the code is OK
+// Note: the mapping is lossy, e.g. most codes are mapped to ExceptionTypeInternalError.
+func (s *GRPCStatus) Exception() *Exception {
+	if s.Code == GRPCCodeOK {
+		return nil
+	}
+	tp, ok := grpcCodeToExceptionType[s.Code]
+	if !ok {
+		tp = ExceptionTypeInternalError
+	}
+	return NewExceptionWithType("", 0, s.Message, tp)
+}
+
+// GRPCStatusFromError returns the gRPC status for the error:
+// (1) OK for nil;
+// (2) the *GRPCStatus itself (by errors.As);
+// (3) the mapped code for an *Exception, and Unknown for a *BizError;
+// (4) Canceled or DeadlineExceeded for errors of context;
+// (5) Unknown for other errors.
+func GRPCStatusFromError(err error) *GRPCStatus {
+	if err == nil {
+		return &GRPCStatus{Code: GRPCCodeOK}
+	}
+	var status *GRPCStatus
+	if errors.As(err, &status) {
+		return status
+	}
+	var exc *Exception
+	if errors.As(err, &exc) {
+		code, ok := exceptionTypeToGRPCCode[exc.Type()]
+		if !ok {
+			code = GRPCCodeInternal
+		}
+		return &GRPCStatus{Code: code, Message: exc.Message}
+	}
+	var bizErr *BizError
+	if errors.As(err, &bizErr) {
+		return &GRPCStatus{Code: GRPCCodeUnknown, Message: bizErr.Message}
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return &GRPCStatus{Code: GRPCCodeCanceled, Message: err.Error()}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &GRPCStatus{Code: GRPCCodeDeadlineExceeded, Message: err.Error()}
+	}
+	return &GRPCStatus{Code: GRPCCodeUnknown, Message: err.Error()}
+}
+
+// SetGRPCStatus sets the grpc-* keys of the status in strInfo, replacing any existing status;
+// grpc-message and grpc-status-details-bin are omitted (i.e. deleted) if empty
+func (h *Header) SetGRPCStatus(status *GRPCStatus) {
+	h.SetStrKey(StrKeyGRPCStatus, strconv.FormatUint(uint64(status.Code), 10))
+	if status.Message != "" {
+		h.SetStrKey(StrKeyGRPCMessage, encodeGRPCMessage(status.Message))
+	} else {
+		delete(h.strInfo, StrKeyGRPCMessage)
+	}
+	if len(status.Details) > 0 {
+		h.SetStrKey(StrKeyGRPCStatusDetails, base64.RawStdEncoding.EncodeToString(status.Details))
+	} else {
+		delete(h.strInfo, StrKeyGRPCStatusDetails)
+	}
+}
+
+// GetGRPCStatus returns the status by the grpc-* keys in strInfo, or nil if grpc-status is absent
+func (h *Header) GetGRPCStatus() (*GRPCStatus, error) {
+	value, ok := h.GetStrKey(StrKeyGRPCStatus)
+	if !ok {
+		return nil, nil
+	}
+	code, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %w", StrKeyGRPCStatus, value, err)
+	}
+	status := &GRPCStatus{Code: GRPCCode(code)}
+	if message, ok := h.GetStrKey(StrKeyGRPCMessage); ok {
+		status.Message = decodeGRPCMessage(message)
+	}
+	if details, ok := h.GetStrKey(StrKeyGRPCStatusDetails); ok {
+		decoded, err := decodeBinaryMetadata(details)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", StrKeyGRPCStatusDetails, err)
+		}
+		status.Details = []byte(decoded)
+	}
+	return status, nil
+}
+
+// NewGRPCHeaderFrame creates a streaming header frame carrying the gRPC metadata, see Header.SetMetadata
+func NewGRPCHeaderFrame(seqID int32, intInfo map[uint16]string, md map[string][]string) *Frame {
+	f := NewHeaderFrame(seqID, intInfo, nil)
+	f.Header().SetMetadata(md)
+	return f
+}
+
+// NewGRPCTrailerFrame creates a streaming trailer frame carrying the gRPC status and trailer metadata
+// Besides the grpc-* keys, the status is also conveyed as an exception for TTHeader peers (see NewErrorTrailerFrame),
+// and a status of Canceled is sent as a cancel frame (see NewCancelFrame).
+func NewGRPCTrailerFrame(seqID int32, protocolID uint8, status *GRPCStatus, md map[string][]string) (*Frame, error) {
+	var f *Frame
+	if status.Code == GRPCCodeCanceled {
+		f = NewCancelFrame(seqID, status.Message)
+		f.Header().SetProtocolID(protocolID)
+	} else {
+		var exc error // not a typed nil for OK
+		if e := status.Exception(); e != nil {
+			exc = e
+		}
+		var err error
+		if f, err = NewErrorTrailerFrame(seqID, protocolID, exc); err != nil {
+			return nil, err
+		}
+	}
+	f.Header().SetGRPCStatus(status)
+	f.Header().SetMetadata(md)
+	return f, nil
+}
+
+// GRPCStatus returns the gRPC status of a trailer frame: by the grpc-* keys if present,
+// otherwise mapped from Frame.TrailerErr by GRPCStatusFromError
+func (f *Frame) GRPCStatus() (*GRPCStatus, error) {
+	if f.header != nil {
+		if status, err := f.header.GetGRPCStatus(); status != nil || err != nil {
+			return status, err
+		}
+	}
+	err := f.TrailerErr()
+	var exc *Exception
+	var bizErr *BizError
+	if err != nil && !errors.As(err, &exc) && !errors.As(err, &bizErr) { // failed to decode the status
+		return nil, err
+	}
+	return GRPCStatusFromError(err), nil
+}
+
+// encodeGRPCMessage percent-encodes the message as gRPC does: bytes out of 0x20-0x7e, and '%'
+func encodeGRPCMessage(message string) string {
+	var sb strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+// decodeGRPCMessage decodes the percent-encoded message; invalid sequences are kept as is, as gRPC does
+func decodeGRPCMessage(message string) string {
+	if !strings.Contains(message, "%") {
+		return message
+	}
+	var sb strings.Builder
+	for i := 0; i < len(message); i++ {
+		if message[i] == '%' && i+2 < len(message) {
+			if v, err := strconv.ParseUint(message[i+1:i+3], 16, 8); err == nil {
+				sb.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+		}
+		sb.WriteByte(message[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,186 @@
+package ttheader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestGRPCCode_String(t *testing.T) {
+	assert(t, GRPCCodeOK.String() == "OK")
+	assert(t, GRPCCodeUnauthenticated.String() == "Unauthenticated")
+	assert(t, GRPCCode(100).String() == "Code(100)", GRPCCode(100).String())
+}
+
+func TestGRPCStatus(t *testing.T) {
+	t.Run("error", func(t *testing.T) {
+		s := &GRPCStatus{Code: GRPCCodeNotFound, Message: "no such key"}
+		assert(t, s.Error() == "grpc error: code = NotFound desc = no such key", s.Error())
+	})
+
+	t.Run("exception", func(t *testing.T) {
+		assert(t, (&GRPCStatus{Code: GRPCCodeOK}).Exception() == nil)
+		cases := map[GRPCCode]ExceptionType{
+			GRPCCodeCanceled:         ExceptionTypeCanceled,
+			GRPCCodeUnknown:          ExceptionTypeUnknown,
+			GRPCCodeUnimplemented:    ExceptionTypeUnknownMethod,
+			GRPCCodeDeadlineExceeded: ExceptionTypeInternalError,
+			GRPCCode(100):            ExceptionTypeInternalError,
+		}
+		for code, tp := range cases {
+			exc := (&GRPCStatus{Code: code, Message: "msg"}).Exception()
+			assert(t, exc.Type() == tp && exc.Message == "msg", code, exc)
+		}
+	})
+}
+
+func TestGRPCStatusFromError(t *testing.T) {
+	status := &GRPCStatus{Code: GRPCCodeAborted, Message: "aborted"}
+	cases := []struct {
+		err     error
+		code    GRPCCode
+		message string
+	}{
+		{nil, GRPCCodeOK, ""},
+		{fmt.Errorf("wrapped: %w", status), GRPCCodeAborted, "aborted"},
+		{NewExceptionWithType("m", 1, "no method", ExceptionTypeUnknownMethod), GRPCCodeUnimplemented, "no method"},
+		{NewExceptionWithType("m", 1, "canceled", ExceptionTypeCanceled), GRPCCodeCanceled, "canceled"},
+		{NewExceptionWithType("m", 1, "bad", ExceptionTypeProtocolError), GRPCCodeInternal, "bad"},
+		{NewBizError(100, "biz", nil), GRPCCodeUnknown, "biz"},
+		{context.Canceled, GRPCCodeCanceled, context.Canceled.Error()},
+		{context.DeadlineExceeded, GRPCCodeDeadlineExceeded, context.DeadlineExceeded.Error()},
+		{errors.New("oops"), GRPCCodeUnknown, "oops"},
+	}
+	for _, c := range cases {
+		s := GRPCStatusFromError(c.err)
+		assert(t, s.Code == c.code && s.Message == c.message, c.err, s)
+	}
+	assert(t, GRPCStatusFromError(status) == status, "itself")
+}
+
+func TestHeader_GRPCStatus(t *testing.T) {
+	t.Run("round-trip", func(t *testing.T) {
+		status := &GRPCStatus{Code: GRPCCodeInvalidArgument, Message: "100% 无效\n", Details: []byte{0, 1, 0xff}}
+		h := NewHeader()
+		h.SetGRPCStatus(status)
+		message, _ := h.GetStrKey(StrKeyGRPCMessage)
+		assert(t, message == "100%25 %E6%97%A0%E6%95%88%0A", message)
+		details, _ := h.GetStrKey(StrKeyGRPCStatusDetails)
+		assert(t, details == "AAH/", details)
+		got, err := h.GetGRPCStatus()
+		assert(t, err == nil && reflect.DeepEqual(got, status), got, err)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		h := NewHeader()
+		h.SetGRPCStatus(&GRPCStatus{Code: GRPCCodeOK})
+		assert(t, reflect.DeepEqual(h.StrInfo(), map[string]string{StrKeyGRPCStatus: "0"}), h.StrInfo())
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		h := NewHeader()
+		h.SetGRPCStatus(&GRPCStatus{Code: GRPCCodeInternal, Message: "old", Details: []byte("old")})
+		h.SetGRPCStatus(&GRPCStatus{Code: GRPCCodeNotFound})
+		got, err := h.GetGRPCStatus()
+		assert(t, err == nil && reflect.DeepEqual(got, &GRPCStatus{Code: GRPCCodeNotFound}), got, err)
+		assert(t, len(h.StrInfo()) == 1, "no stale keys", h.StrInfo())
+	})
+
+	t.Run("absent", func(t *testing.T) {
+		status, err := NewHeader().GetGRPCStatus()
+		assert(t, status == nil && err == nil, status, err)
+	})
+
+	t.Run("lenient-message", func(t *testing.T) {
+		h := NewHeader()
+		h.SetStrKey(StrKeyGRPCStatus, "2")
+		h.SetStrKey(StrKeyGRPCMessage, "%zz %4")
+		status, err := h.GetGRPCStatus()
+		assert(t, err == nil && status.Message == "%zz %4", status, err)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for key, value := range map[string]string{StrKeyGRPCStatus: "x", StrKeyGRPCStatusDetails: "!"} {
+			h := NewHeader()
+			h.SetStrKey(StrKeyGRPCStatus, "2")
+			h.SetStrKey(key, value)
+			_, err := h.GetGRPCStatus()
+			assert(t, err != nil, key, value)
+		}
+	})
+}
+
+func TestNewGRPCHeaderFrame(t *testing.T) {
+	md := map[string][]string{"k": {"v1", "v2"}, "k-bin": {"\x00\x01"}}
+	f := NewGRPCHeaderFrame(1, map[uint16]string{IntKeyToMethod: "echo"}, md)
+	assert(t, f.Type() == FrameKindHeader && f.Header().SeqID() == 1, f.Header())
+	method, _ := f.Header().GetIntKey(IntKeyToMethod)
+	assert(t, method == "echo", method)
+	got, err := f.Header().GetMetadata()
+	assert(t, err == nil && reflect.DeepEqual(got, md), got, err)
+}
+
+func TestNewGRPCTrailerFrame(t *testing.T) {
+	md := map[string][]string{"k": {"v"}}
+
+	t.Run("ok", func(t *testing.T) {
+		f, err := NewGRPCTrailerFrame(1, ProtocolIDThriftBinary, &GRPCStatus{Code: GRPCCodeOK}, md)
+		assert(t, err == nil && f.Type() == FrameKindTrailer, f, err)
+		assert(t, f.TrailerErr() == nil, f.TrailerErr())
+		got, err := f.Header().GetMetadata()
+		assert(t, err == nil && reflect.DeepEqual(got, md), got, err)
+		status, err := f.GRPCStatus()
+		assert(t, err == nil && status.Code == GRPCCodeOK, status, err)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		status := &GRPCStatus{Code: GRPCCodeNotFound, Message: "not found", Details: []byte("details")}
+		f, err := NewGRPCTrailerFrame(1, ProtocolIDThriftBinary, status, nil)
+		assert(t, err == nil, err)
+		err = f.TrailerErr()
+		assert(t, errors.Is(err, ExceptionTypeInternalError) && err.Error() == "not found", "for TTHeader peers", err)
+		got, err := f.GRPCStatus()
+		assert(t, err == nil && reflect.DeepEqual(got, status), "faithful for gRPC", got, err)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		f, err := NewGRPCTrailerFrame(1, ProtocolIDThriftBinary, &GRPCStatus{Code: GRPCCodeCanceled}, nil)
+		assert(t, err == nil && f.IsCancel(), f, err)
+		assert(t, errors.Is(f.TrailerErr(), ExceptionTypeCanceled), f.TrailerErr())
+	})
+
+	t.Run("unsupported-protocol", func(t *testing.T) {
+		_, err := NewGRPCTrailerFrame(1, 0x01, &GRPCStatus{Code: GRPCCodeInternal}, nil) // unassigned
+		assert(t, err == ErrProtocolNotSupported, err)
+	})
+}
+
+func TestFrame_GRPCStatus(t *testing.T) {
+	t.Run("from-exception", func(t *testing.T) {
+		f, err := NewErrorTrailerFrame(1, ProtocolIDThriftBinary, NewExceptionWithType("", 1, "no method", ExceptionTypeUnknownMethod))
+		assert(t, err == nil, err)
+		status, err := f.GRPCStatus()
+		assert(t, err == nil && status.Code == GRPCCodeUnimplemented && status.Message == "no method", status, err)
+	})
+
+	t.Run("from-biz-error", func(t *testing.T) {
+		f, err := NewErrorTrailerFrame(1, ProtocolIDThriftBinary, NewBizError(100, "biz", nil))
+		assert(t, err == nil, err)
+		status, err := f.GRPCStatus()
+		assert(t, err == nil && status.Code == GRPCCodeUnknown && status.Message == "biz", status, err)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		status, err := NewTrailerFrame(1, nil, nil).GRPCStatus()
+		assert(t, err == nil && status.Code == GRPCCodeOK, status, err)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewTrailerFrame(1, map[string]string{StrKeyStatusCode: "x"}, nil).GRPCStatus()
+		assert(t, err != nil)
+		_, err = NewTrailerFrame(1, map[string]string{StrKeyGRPCStatus: "x"}, nil).GRPCStatus()
+		assert(t, err != nil)
+	})
+}
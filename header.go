@@ -35,14 +35,48 @@ const (
 	FrameTypeData    = "3"
 	FrameTypeTrailer = "4"
 
-	StrKeyMetaData  = "grpc-metadata"
-	IntKeyFrameType = 27
+	StrKeyMetaData = "grpc-metadata"
+
+	// int keys used by kitex
+	IntKeyTransportType   = 1
+	IntKeyLogID           = 2
+	IntKeyFromService     = 3
+	IntKeyFromCluster     = 4
+	IntKeyFromIDC         = 5
+	IntKeyToService       = 6
+	IntKeyToCluster       = 7
+	IntKeyToIDC           = 8
+	IntKeyToMethod        = 9
+	IntKeyEnv             = 10
+	IntKeyDestAddress     = 11
+	IntKeyRPCTimeout      = 12
+	IntKeyReadTimeout     = 13
+	IntKeyRingHashKey     = 14
+	IntKeyDDPTag          = 15
+	IntKeyWithMeshHeader  = 16
+	IntKeyConnectTimeout  = 17
+	IntKeySpanContext     = 18
+	IntKeyShortConnection = 19
+	IntKeyFromMethod      = 20
+	IntKeyStressTag       = 21
+	IntKeyMsgType         = 22
+	IntKeyHTTPContentType = 23
+	IntKeyRawRingHashKey  = 24
+	IntKeyLBType          = 25
+	IntKeyClusterShardID  = 26
+	IntKeyFrameType       = 27
+
+	ProtocolIDThriftBinary    uint8 = 0x00
+	ProtocolIDThriftCompact   uint8 = 0x02
+	ProtocolIDThriftCompactV2 uint8 = 0x03
+	ProtocolIDKitexProtobuf   uint8 = 0x04
 )
 
 var (
 	ErrMetaSizeTooLarge      = errors.New("meta size too large")
 	ErrInvalidMagic          = errors.New("invalid ttheader magic")
 	ErrTransformNotSupported = errors.New("transform not supported")
+	ErrProtocolNotSupported  = errors.New("protocol not supported")
 )
 
 type Header struct {
@@ -126,6 +160,14 @@ func (h *Header) GetIntKey(key uint16) (string, bool) {
 	return val, ok
 }
 
+// SetIntKey sets the value of the key in intInfo, allocating the map if necessary
+func (h *Header) SetIntKey(key uint16, value string) {
+	if h.intInfo == nil {
+		h.intInfo = make(map[uint16]string)
+	}
+	h.intInfo[key] = value
+}
+
 func (h *Header) SetIntInfo(intInfo map[uint16]string) {
 	h.intInfo = intInfo
 }
@@ -142,6 +184,14 @@ func (h *Header) GetStrKey(key string) (string, bool) {
 	return val, ok
 }
 
+// SetStrKey sets the value of the key in strInfo, allocating the map if necessary
+func (h *Header) SetStrKey(key, value string) {
+	if h.strInfo == nil {
+		h.strInfo = make(map[string]string)
+	}
+	h.strInfo[key] = value
+}
+
 func (h *Header) SetStrInfo(strInfo map[string]string) {
 	h.strInfo = strInfo
 }
@@ -445,3 +445,21 @@ func TestHeader_Read(t *testing.T) {
 		assert(t, err != nil, err)
 	})
 }
+
+func TestHeader_SetIntKey(t *testing.T) {
+	h := NewHeader()
+	h.SetIntKey(1, "a")
+	value, ok := h.GetIntKey(1)
+	assert(t, ok && value == "a", value)
+	h.SetIntKey(1, "b")
+	assert(t, reflect.DeepEqual(h.IntInfo(), map[uint16]string{1: "b"}), h.IntInfo())
+}
+
+func TestHeader_SetStrKey(t *testing.T) {
+	h := NewHeader()
+	h.SetStrKey("k", "a")
+	value, ok := h.GetStrKey("k")
+	assert(t, ok && value == "a", value)
+	h.SetStrKey("k", "b")
+	assert(t, reflect.DeepEqual(h.StrInfo(), map[string]string{"k": "b"}), h.StrInfo())
+}
@@ -0,0 +1,123 @@
+package ttheader
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// keys in strInfo of meta frames (with seqID 0) for heartbeats; the value of pong is the same as the ping
+const (
+	StrKeyPing = "ping"
+	StrKeyPong = "pong"
+)
+
+var ErrHeartbeatTimeout = errors.New("heartbeat timeout")
+
+// controlQueueSize limits pings and pongs waiting to be written; more are dropped, e.g. if the peer floods pings
+const controlQueueSize = 8
+
+// NewPingFrame creates a meta frame of ping, which the peer should reply with a pong of the same data
+func NewPingFrame(data string) *Frame {
+	return NewMetaFrame(0, map[string]string{StrKeyPing: data}, nil)
+}
+
+// NewPongFrame creates a meta frame of pong, replying the ping with the data
+func NewPongFrame(data string) *Frame {
+	return NewMetaFrame(0, map[string]string{StrKeyPong: data}, nil)
+}
+
+// Ping returns the data if the frame is a ping
+func (f *Frame) Ping() (string, bool) {
+	return f.connMeta(StrKeyPing)
+}
+
+// Pong returns the data if the frame is a pong
+func (f *Frame) Pong() (string, bool) {
+	return f.connMeta(StrKeyPong)
+}
+
+// connMeta returns the value of the key if the frame is a meta frame of the connection, i.e. with seqID 0
+func (f *Frame) connMeta(key string) (string, bool) {
+	if f.header == nil || f.header.SeqID() != 0 || f.Type() != FrameKindMeta {
+		return "", false
+	}
+	return f.header.GetStrKey(key)
+}
+
+// WithMuxHeartbeat enables heartbeats: a ping is sent if nothing is received for the interval, and the Mux fails
+// with ErrHeartbeatTimeout if still nothing is received within the timeout after the ping;
+// a timeout <= 0 means the same as the interval.
+// Note: pings from the peer are always replied, even if heartbeats are not enabled;
+// pongs are dropped if more than controlQueueSize frames are waiting to be written.
+func WithMuxHeartbeat(interval, timeout time.Duration) MuxOption {
+	return func(m *Mux) {
+		if timeout <= 0 {
+			timeout = interval
+		}
+		m.heartbeatInterval, m.heartbeatTimeout = interval, timeout
+	}
+}
+
+// touch records the time when a frame is received, for heartbeats
+func (m *Mux) touch() {
+	if m.heartbeatInterval > 0 {
+		atomic.StoreInt64(&m.lastRecv, time.Now().UnixNano())
+	}
+}
+
+func (m *Mux) lastRecvTime() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&m.lastRecv))
+}
+
+func (m *Mux) heartbeatLoop() {
+	ticker := time.NewTicker(m.heartbeatInterval)
+	defer ticker.Stop()
+	for seq := 1; ; seq++ {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+		}
+		if time.Since(m.lastRecvTime()) < m.heartbeatInterval { // the connection is active
+			continue
+		}
+		// the timeout doesn't wait for the ping to be written, which blocks if the peer stops reading
+		sentAt := time.Now()
+		m.sendControl(NewPingFrame(strconv.Itoa(seq)))
+		timer := time.NewTimer(m.heartbeatTimeout)
+		select {
+		case <-m.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if !m.lastRecvTime().After(sentAt) {
+			m.fail(ErrHeartbeatTimeout)
+			return
+		}
+	}
+}
+
+// sendControl queues a ping or pong for controlLoop without blocking; it's dropped if the queue is full
+func (m *Mux) sendControl(f *Frame) {
+	select {
+	case m.control <- f:
+	default:
+	}
+}
+
+// controlLoop writes pings and pongs, so that neither the reader nor heartbeatLoop is blocked by writes
+func (m *Mux) controlLoop() {
+	for {
+		select {
+		case <-m.done:
+			return
+		case f := <-m.control:
+			if m.writeFrame(f) != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package ttheader
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNewPingFrame(t *testing.T) {
+	f := NewPingFrame("1")
+	data, ok := f.Ping()
+	assert(t, ok && data == "1", data)
+	_, ok = f.Pong()
+	assert(t, !ok)
+
+	f = NewPongFrame("2")
+	data, ok = f.Pong()
+	assert(t, ok && data == "2", data)
+
+	_, ok = NewMetaFrame(1, map[string]string{StrKeyPing: "1"}, nil).Ping()
+	assert(t, !ok, "not for the connection")
+	_, ok = NewTrailerFrame(0, map[string]string{StrKeyPing: "1"}, nil).Ping()
+	assert(t, !ok, "not a meta frame")
+	_, ok = NewFrame(nil, nil).Ping()
+	assert(t, !ok)
+}
+
+func TestWithMuxHeartbeat(t *testing.T) {
+	m := &Mux{}
+	WithMuxHeartbeat(time.Second, 0)(m)
+	assert(t, m.heartbeatInterval == time.Second && m.heartbeatTimeout == time.Second, m.heartbeatTimeout)
+	WithMuxHeartbeat(time.Second, time.Minute)(m)
+	assert(t, m.heartbeatTimeout == time.Minute, m.heartbeatTimeout)
+}
+
+func TestMux_Heartbeat(t *testing.T) {
+	t.Run("alive", func(t *testing.T) {
+		c, s := net.Pipe()
+		client := NewClientMux(c, WithMuxHeartbeat(10*time.Millisecond, 20*time.Millisecond))
+		server := NewServerMux(s) // replies pings without heartbeats enabled
+		t.Cleanup(func() {
+			_ = client.Close()
+			_ = server.Close()
+		})
+		time.Sleep(100 * time.Millisecond)
+		assert(t, client.Err() == nil && server.Err() == nil, client.Err(), server.Err())
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		ctx := testContext(t)
+		c, conn := net.Pipe()
+		go func() {
+			_, _ = io.Copy(ioutil.Discard, conn) // never replies
+		}()
+		client := NewClientMux(c, WithMuxHeartbeat(10*time.Millisecond, 20*time.Millisecond))
+		t.Cleanup(func() { _ = client.Close() })
+		s, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+
+		select {
+		case <-client.Done():
+		case <-ctx.Done():
+			t.Fatal("not timed out")
+		}
+		assert(t, client.Err() == ErrHeartbeatTimeout, client.Err())
+		_, err = s.ReadFrame(ctx)
+		assert(t, err == ErrHeartbeatTimeout, err)
+	})
+
+	t.Run("timeout:peer-not-reading", func(t *testing.T) {
+		ctx := testContext(t)
+		c, _ := net.Pipe() // writes are blocked forever
+		client := NewClientMux(c, WithMuxHeartbeat(10*time.Millisecond, 20*time.Millisecond))
+		t.Cleanup(func() { _ = client.Close() })
+		s, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		ch := writeAsync(s, NewHeaderFrame(s.SeqID(), nil, nil))
+
+		select {
+		case <-client.Done():
+		case <-ctx.Done():
+			t.Fatal("not timed out")
+		}
+		assert(t, client.Err() == ErrHeartbeatTimeout, client.Err())
+		select {
+		case err = <-ch:
+			assert(t, err != nil, "the blocked write fails")
+		case <-ctx.Done():
+			t.Fatal("still blocked")
+		}
+	})
+
+	t.Run("ping-flood", func(t *testing.T) {
+		c, peer := net.Pipe()
+		server := NewServerMux(c)
+		t.Cleanup(func() {
+			_ = server.Close()
+			_ = peer.Close()
+		})
+		goroutines := runtime.NumGoroutine()
+		for i := 0; i < 1000; i++ { // pongs are never read
+			_, err := NewPingFrame(strconv.Itoa(i)).WriteTo(peer)
+			assert(t, err == nil, err)
+		}
+		assert(t, runtime.NumGoroutine() < goroutines+10, "pongs are dropped", runtime.NumGoroutine(), goroutines)
+		assert(t, server.Err() == nil, server.Err())
+	})
+}
@@ -0,0 +1,169 @@
+package ttheader
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// MessageType is the type of a thrift message
+type MessageType uint8
+
+const (
+	MessageTypeCall      MessageType = 1
+	MessageTypeReply     MessageType = 2
+	MessageTypeException MessageType = 3
+	MessageTypeOneway    MessageType = 4
+)
+
+var ErrSeqIDMismatch = errors.New("seqID mismatch between ttheader and payload")
+
+func (t MessageType) String() string {
+	switch t {
+	case MessageTypeCall:
+		return "call"
+	case MessageTypeReply:
+		return "reply"
+	case MessageTypeException:
+		return "exception"
+	case MessageTypeOneway:
+		return "oneway"
+	default:
+		return "message type " + strconv.Itoa(int(t))
+	}
+}
+
+func (t MessageType) valid() bool {
+	return t >= MessageTypeCall && t <= MessageTypeOneway
+}
+
+// MessageBegin is the envelope of a message: method name, message type and seqID
+// It's supported in thrift binary (strict and non-strict), thrift compact and kitex protobuf.
+type MessageBegin struct {
+	Name  string
+	Type  MessageType
+	SeqID int32
+	// NonStrict is the old-style thrift binary envelope without version, i.e. method + type + seqID
+	NonStrict bool
+}
+
+// ReadMessageBegin decodes the envelope at the beginning of the payload in the given protocol,
+// returning the envelope and its encoded size
+func ReadMessageBegin(payload []byte, protocolID uint8) (*MessageBegin, int, error) {
+	reader := newBytesReader(payload)
+	var msg *MessageBegin
+	var err error
+	switch protocolID {
+	case ProtocolIDThriftBinary, ProtocolIDKitexProtobuf:
+		msg, err = readBinaryMessageBegin(reader, protocolID)
+	case ProtocolIDThriftCompact:
+		msg = &MessageBegin{}
+		var msgType byte
+		msg.Name, msgType, msg.SeqID, err = readCompactMessageBegin(reader)
+		msg.Type = MessageType(msgType)
+	default:
+		return nil, 0, ErrProtocolNotSupported
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if !msg.Type.valid() {
+		return nil, 0, ErrInvalidThriftMessageType
+	}
+	return msg, reader.idx, nil
+}
+
+// readBinaryMessageBegin reads the envelope in thrift binary or kitex protobuf (with the same layout)
+func readBinaryMessageBegin(reader *bytesReader, protocolID uint8) (msg *MessageBegin, err error) {
+	first, err := reader.ReadUint32()
+	if err != nil {
+		return nil, err
+	}
+	msg = &MessageBegin{}
+	magic := uint32(thriftVersion1)
+	if protocolID == ProtocolIDKitexProtobuf {
+		magic = kitexProtobufMagic
+	}
+	if first&thriftVersionMask == magic { // strict: version|type + method + seqID
+		msg.Type = MessageType(first)
+		if msg.Name, err = readMethod(reader); err != nil {
+			return nil, err
+		}
+	} else if protocolID == ProtocolIDThriftBinary && int32(first) >= 0 { // non-strict: method + type + seqID
+		msg.NonStrict = true
+		if msg.Name, err = reader.ReadString(int(first)); err != nil {
+			return nil, err
+		}
+		msgType, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		msg.Type = MessageType(msgType)
+	} else {
+		return nil, ErrInvalidThriftMagic
+	}
+	if msg.SeqID, err = reader.ReadInt32(); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// BytesLength returns the size of the envelope encoded in the given protocol
+func (m *MessageBegin) BytesLength(protocolID uint8) (int, error) {
+	switch protocolID {
+	case ProtocolIDThriftBinary:
+		if m.NonStrict {
+			return sizeMethodLength + len(m.Name) + 1 + sizeSeqID, nil
+		}
+		return sizeMagic + sizeMessageType + sizeMethodLength + len(m.Name) + sizeSeqID, nil
+	case ProtocolIDKitexProtobuf:
+		return sizeMagic + sizeMessageType + sizeMethodLength + len(m.Name) + sizeSeqID, nil
+	case ProtocolIDThriftCompact:
+		return 2 + uvarintSize(uint64(uint32(m.SeqID))) + uvarintSize(uint64(len(m.Name))) + len(m.Name), nil
+	default:
+		return 0, ErrProtocolNotSupported
+	}
+}
+
+// Bytes encodes the envelope in the given protocol
+func (m *MessageBegin) Bytes(protocolID uint8) ([]byte, error) {
+	size, err := m.BytesLength(protocolID)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	_, err = WriteMessageBegin(buf, protocolID, m)
+	return buf, err
+}
+
+// WriteMessageBegin encodes the envelope into buf in the given protocol, returning the number of bytes written
+// Note: NonStrict only applies to thrift binary
+func WriteMessageBegin(buf []byte, protocolID uint8, msg *MessageBegin) (int, error) {
+	size, err := msg.BytesLength(protocolID)
+	if err != nil {
+		return 0, err
+	}
+	if len(buf) < size {
+		return 0, io.ErrShortWrite
+	}
+	switch protocolID {
+	case ProtocolIDThriftCompact:
+		appendCompactMessageBegin(buf[:0], msg.Name, byte(msg.Type), msg.SeqID) // in place, since len(buf) >= size
+		return size, nil
+	case ProtocolIDThriftBinary:
+		if msg.NonStrict {
+			idx := writeMethod(buf, msg.Name)
+			buf[idx] = byte(msg.Type)
+			writeSeqID(buf[idx+1:], msg.SeqID)
+			return size, nil
+		}
+		binary.BigEndian.PutUint32(buf, thriftVersion1|uint32(msg.Type))
+	case ProtocolIDKitexProtobuf:
+		binary.BigEndian.PutUint32(buf, kitexProtobufMagic|uint32(msg.Type))
+	}
+	idx := sizeMagic + sizeMessageType
+	idx += writeMethod(buf[idx:], msg.Name)
+	writeSeqID(buf[idx:], msg.SeqID)
+	return size, nil
+}
@@ -0,0 +1,97 @@
+package ttheader
+
+import (
+	"io"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestMessageType_String(t *testing.T) {
+	assert(t, MessageTypeCall.String() == "call")
+	assert(t, MessageTypeOneway.String() == "oneway")
+	assert(t, MessageType(5).String() == "message type 5")
+}
+
+func TestMessageBegin_Bytes(t *testing.T) {
+	t.Run("binary:strict", func(t *testing.T) {
+		buf, err := (&MessageBegin{Name: "m", Type: MessageTypeCall, SeqID: 1}).Bytes(ProtocolIDThriftBinary)
+		assert(t, err == nil, err)
+		assert(t, reflect.DeepEqual(buf, []byte{0x80, 0x01, 0, 1, 0, 0, 0, 1, 'm', 0, 0, 0, 1}), buf)
+	})
+	t.Run("binary:non-strict", func(t *testing.T) {
+		msg := &MessageBegin{Name: "m", Type: MessageTypeCall, SeqID: 1, NonStrict: true}
+		buf, err := msg.Bytes(ProtocolIDThriftBinary)
+		assert(t, err == nil, err)
+		assert(t, reflect.DeepEqual(buf, []byte{0, 0, 0, 1, 'm', 1, 0, 0, 0, 1}), buf)
+	})
+	t.Run("compact", func(t *testing.T) {
+		buf, err := (&MessageBegin{Name: "m", Type: MessageTypeReply, SeqID: 300}).Bytes(ProtocolIDThriftCompact)
+		assert(t, err == nil, err)
+		assert(t, reflect.DeepEqual(buf, []byte{0x82, 0x41, 0xac, 0x02, 1, 'm'}), buf)
+	})
+	t.Run("kitex-protobuf", func(t *testing.T) {
+		buf, err := (&MessageBegin{Name: "m", Type: MessageTypeCall, SeqID: 1}).Bytes(ProtocolIDKitexProtobuf)
+		assert(t, err == nil, err)
+		assert(t, reflect.DeepEqual(buf, []byte{0x90, 0x01, 0, 1, 0, 0, 0, 1, 'm', 0, 0, 0, 1}), buf)
+	})
+	t.Run("unsupported-protocol", func(t *testing.T) {
+		_, err := (&MessageBegin{}).Bytes(0xff)
+		assert(t, err == ErrProtocolNotSupported, err)
+	})
+	t.Run("short-write", func(t *testing.T) {
+		_, err := WriteMessageBegin(make([]byte, 3), ProtocolIDThriftBinary, &MessageBegin{})
+		assert(t, err == io.ErrShortWrite, err)
+	})
+}
+
+func TestReadMessageBegin(t *testing.T) {
+	messages := []*MessageBegin{
+		{Name: "method", Type: MessageTypeCall, SeqID: 1},
+		{Name: "", Type: MessageTypeOneway, SeqID: -1},
+	}
+	for _, protocolID := range []uint8{ProtocolIDThriftBinary, ProtocolIDThriftCompact, ProtocolIDKitexProtobuf} {
+		for _, msg := range messages {
+			t.Run("round-trip:"+strconv.Itoa(int(protocolID)), func(t *testing.T) {
+				buf, err := msg.Bytes(protocolID)
+				assert(t, err == nil, err)
+				decoded, size, err := ReadMessageBegin(append(buf, 0xff), protocolID)
+				assert(t, err == nil, err)
+				assert(t, size == len(buf), size)
+				assert(t, reflect.DeepEqual(decoded, msg), decoded)
+			})
+		}
+	}
+	t.Run("binary:non-strict", func(t *testing.T) {
+		msg := &MessageBegin{Name: "method", Type: MessageTypeReply, SeqID: 1, NonStrict: true}
+		buf, err := msg.Bytes(ProtocolIDThriftBinary)
+		assert(t, err == nil, err)
+		decoded, _, err := ReadMessageBegin(buf, ProtocolIDThriftBinary)
+		assert(t, err == nil, err)
+		assert(t, reflect.DeepEqual(decoded, msg), decoded)
+	})
+	t.Run("invalid-magic", func(t *testing.T) {
+		_, _, err := ReadMessageBegin(appendUint32(nil, 0x80020001), ProtocolIDThriftBinary)
+		assert(t, err == ErrInvalidThriftMagic, err)
+		_, _, err = ReadMessageBegin(appendUint32(nil, thriftVersion1|1), ProtocolIDKitexProtobuf)
+		assert(t, err == ErrInvalidThriftMagic, err)
+	})
+	t.Run("invalid-message-type", func(t *testing.T) {
+		buf, err := (&MessageBegin{Type: 5}).Bytes(ProtocolIDThriftBinary)
+		assert(t, err == nil, err)
+		_, _, err = ReadMessageBegin(buf, ProtocolIDThriftBinary)
+		assert(t, err == ErrInvalidThriftMessageType, err)
+	})
+	t.Run("truncated", func(t *testing.T) {
+		buf, err := messages[0].Bytes(ProtocolIDThriftBinary)
+		assert(t, err == nil, err)
+		for i := 0; i < len(buf); i++ {
+			_, _, err = ReadMessageBegin(buf[:i], ProtocolIDThriftBinary)
+			assert(t, err != nil, i)
+		}
+	})
+	t.Run("unsupported-protocol", func(t *testing.T) {
+		_, _, err := ReadMessageBegin(nil, 0xff)
+		assert(t, err == ErrProtocolNotSupported, err)
+	})
+}
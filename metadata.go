@@ -0,0 +1,85 @@
+package ttheader
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// binaryMetadataSuffix is the suffix of keys with binary values, which are base64 encoded as in gRPC
+const binaryMetadataSuffix = "-bin"
+
+// MetadataError is the error of a malformed grpc-metadata in strInfo
+type MetadataError struct {
+	Value string
+	Err   error
+}
+
+func (e *MetadataError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", StrKeyMetaData, e.Err)
+}
+
+func (e *MetadataError) Unwrap() error {
+	return e.Err
+}
+
+// GetMetadata returns the metadata in StrKeyMetaData, which is a json encoded map[string][]string as kitex does
+// Values of keys with the "-bin" suffix are base64 decoded, with or without padding.
+// Note: returns nil if the key is absent, and *MetadataError if the value is malformed.
+func (h *Header) GetMetadata() (map[string][]string, error) {
+	value, ok := h.GetStrKey(StrKeyMetaData)
+	if !ok {
+		return nil, nil
+	}
+	var md map[string][]string
+	if err := json.Unmarshal([]byte(value), &md); err != nil {
+		return nil, &MetadataError{Value: value, Err: err}
+	}
+	for key, values := range md {
+		if !strings.HasSuffix(key, binaryMetadataSuffix) {
+			continue
+		}
+		for i, v := range values {
+			decoded, err := decodeBinaryMetadata(v)
+			if err != nil {
+				return nil, &MetadataError{Value: value, Err: fmt.Errorf("key %s: %w", key, err)}
+			}
+			values[i] = decoded
+		}
+	}
+	return md, nil
+}
+
+// SetMetadata sets the metadata as json in StrKeyMetaData, or removes the key if md is empty
+// Values of keys with the "-bin" suffix are base64 encoded without padding, as gRPC does.
+// Note: md is not modified.
+func (h *Header) SetMetadata(md map[string][]string) {
+	if len(md) == 0 {
+		delete(h.strInfo, StrKeyMetaData)
+		return
+	}
+	encoded := make(map[string][]string, len(md))
+	for key, values := range md {
+		if strings.HasSuffix(key, binaryMetadataSuffix) {
+			binValues := make([]string, len(values))
+			for i, v := range values {
+				binValues[i] = base64.RawStdEncoding.EncodeToString([]byte(v))
+			}
+			values = binValues
+		}
+		encoded[key] = values
+	}
+	buf, _ := json.Marshal(encoded) // never fails for map[string][]string
+	h.SetStrKey(StrKeyMetaData, string(buf))
+}
+
+// decodeBinaryMetadata decodes the base64 value, padded or not
+func decodeBinaryMetadata(v string) (string, error) {
+	encoding := base64.RawStdEncoding
+	if len(v)%4 == 0 {
+		encoding = base64.StdEncoding
+	}
+	buf, err := encoding.DecodeString(v)
+	return string(buf), err
+}
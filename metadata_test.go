@@ -0,0 +1,74 @@
+package ttheader
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMetadataError(t *testing.T) {
+	err := error(&MetadataError{Value: "x", Err: errors.New("bad")})
+	assert(t, err.Error() == "invalid grpc-metadata: bad", err.Error())
+	assert(t, errors.Unwrap(err).Error() == "bad", errors.Unwrap(err))
+}
+
+func TestHeader_SetMetadata(t *testing.T) {
+	t.Run("kitex-shape", func(t *testing.T) {
+		h := NewHeader()
+		h.SetMetadata(map[string][]string{"b": {"1", "2"}, "a": {"x"}})
+		value, _ := h.GetStrKey(StrKeyMetaData)
+		assert(t, value == `{"a":["x"],"b":["1","2"]}`, value)
+	})
+	t.Run("binary", func(t *testing.T) {
+		h := NewHeader()
+		md := map[string][]string{"k-bin": {"\x00\xff"}}
+		h.SetMetadata(md)
+		value, _ := h.GetStrKey(StrKeyMetaData)
+		assert(t, value == `{"k-bin":["AP8"]}`, value)
+		assert(t, md["k-bin"][0] == "\x00\xff", "input is not modified")
+	})
+	t.Run("empty", func(t *testing.T) {
+		h := NewHeader()
+		h.SetMetadata(nil)
+		_, ok := h.GetStrKey(StrKeyMetaData)
+		assert(t, !ok)
+		h.SetMetadata(map[string][]string{"a": {"x"}})
+		h.SetMetadata(map[string][]string{})
+		_, ok = h.GetStrKey(StrKeyMetaData)
+		assert(t, !ok, "removed")
+	})
+}
+
+func TestHeader_GetMetadata(t *testing.T) {
+	t.Run("absent", func(t *testing.T) {
+		md, err := NewHeader().GetMetadata()
+		assert(t, md == nil && err == nil, md, err)
+	})
+	t.Run("round-trip", func(t *testing.T) {
+		expected := map[string][]string{"a": {"x", "y"}, "k-bin": {"\x00\xff", ""}}
+		h := NewHeader()
+		h.SetMetadata(expected)
+		md, err := h.GetMetadata()
+		assert(t, err == nil, err)
+		assert(t, reflect.DeepEqual(md, expected), md)
+	})
+	t.Run("padded-binary", func(t *testing.T) {
+		value, _ := json.Marshal(map[string][]string{"k-bin": {base64.StdEncoding.EncodeToString([]byte("a"))}})
+		h := NewHeader()
+		h.SetStrKey(StrKeyMetaData, string(value))
+		md, err := h.GetMetadata()
+		assert(t, err == nil, err)
+		assert(t, md["k-bin"][0] == "a", md)
+	})
+	t.Run("malformed", func(t *testing.T) {
+		for _, value := range []string{`{`, `{"a":"x"}`, `{"k-bin":["!"]}`} {
+			h := NewHeader()
+			h.SetStrKey(StrKeyMetaData, value)
+			_, err := h.GetMetadata()
+			var mdErr *MetadataError
+			assert(t, errors.As(err, &mdErr) && mdErr.Value == value, value, err)
+		}
+	})
+}
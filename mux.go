@@ -0,0 +1,532 @@
+package ttheader
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	ErrMuxClosed      = errors.New("mux closed")
+	ErrNotStreamFrame = errors.New("not a streaming frame")
+)
+
+// DefaultMuxMaxFrameSize is the default limit of the size of frames received by a Mux, see WithMuxMaxFrameSize
+const DefaultMuxMaxFrameSize = 16 * 1024 * 1024
+
+// Mux multiplexes ttheader streams over a single connection, keyed by Header.SeqID:
+//   - a single reader goroutine reads frames and dispatches them to the receive queues of streams;
+//   - frames are written by a FrameWriter, i.e. serialized;
+//   - a server Mux creates streams on incoming header frames, which are returned by Accept;
+//   - streams are removed when trailers are both sent and received, either side cancels it, or the connection fails.
+//
+// Frames of unknown streams (e.g. of removed ones) are dropped, except header frames for servers.
+// Meta frames with seqID 0 are for the connection, i.e. window updates (see WithMuxFlowControl)
+// and heartbeats (see WithMuxHeartbeat).
+// Note: the receive queues are unbounded; a stream which is not read keeps its frames in memory.
+type Mux struct {
+	lastRecv int64 // in UnixNano, accessed atomically; the first field for alignment on 32-bit platforms
+
+	conn         net.Conn
+	writer       *FrameWriter
+	server       bool
+	writeOpts    []FrameWriterOption
+	maxFrameSize int
+
+	// flow control, disabled if streamWindow is 0
+	streamWindow int
+	connWindow   int
+
+	// heartbeats, disabled if heartbeatInterval is 0
+	heartbeatInterval time.Duration
+	heartbeatTimeout  time.Duration
+	control           chan *Frame // pings and pongs, written by controlLoop
+
+	mu           sync.Mutex
+	streams      map[int32]*MuxStream
+	accepted     []*MuxStream
+	acceptCh     chan struct{} // notified when accepted is appended
+	nextSeqID    int32
+	err          error
+	done         chan struct{}
+	sendWindow   int           // credits of the connection
+	windowCh     chan struct{} // closed when credits are added
+	recvConsumed int           // consumed bytes not yet returned to the peer
+}
+
+// MuxOption customizes a Mux
+type MuxOption func(m *Mux)
+
+// WithMuxFrameWriterOptions sets options of the underlying FrameWriter
+// Note: by default every frame is flushed immediately; e.g. WithFlushLatency can be used for batching.
+func WithMuxFrameWriterOptions(opts ...FrameWriterOption) MuxOption {
+	return func(m *Mux) {
+		m.writeOpts = append(m.writeOpts, opts...)
+	}
+}
+
+// WithMuxMaxFrameSize limits the size of frames received; the Mux fails with ErrFrameTooLarge on larger frames
+// The default is DefaultMuxMaxFrameSize, and a size <= 0 means no limit.
+func WithMuxMaxFrameSize(size int) MuxOption {
+	return func(m *Mux) {
+		m.maxFrameSize = size
+	}
+}
+
+// NewClientMux returns a Mux for the client side of the connection, which opens streams by OpenStream
+func NewClientMux(conn net.Conn, opts ...MuxOption) *Mux {
+	return newMux(conn, false, opts)
+}
+
+// NewServerMux returns a Mux for the server side of the connection, which accepts streams by Accept
+func NewServerMux(conn net.Conn, opts ...MuxOption) *Mux {
+	return newMux(conn, true, opts)
+}
+
+func newMux(conn net.Conn, server bool, opts []MuxOption) *Mux {
+	m := &Mux{
+		conn:         conn,
+		server:       server,
+		writeOpts:    []FrameWriterOption{WithFlushThreshold(0)},
+		maxFrameSize: DefaultMuxMaxFrameSize,
+		streams:      map[int32]*MuxStream{},
+		acceptCh:     make(chan struct{}, 1),
+		done:         make(chan struct{}),
+		windowCh:     make(chan struct{}),
+		control:      make(chan *Frame, controlQueueSize),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.sendWindow = m.connWindow
+	m.writer = NewFrameWriter(conn, m.writeOpts...)
+	go m.readLoop()
+	go m.controlLoop()
+	if m.heartbeatInterval > 0 {
+		m.touch()
+		go m.heartbeatLoop()
+	}
+	return m
+}
+
+// OpenStream creates a stream with the next seqID (starting from 1)
+// If ctx is done before the stream ends, the stream is canceled, i.e. a cancel frame is sent to the peer.
+// Note: the caller should send a header frame (e.g. by NewHeaderFrame(s.SeqID(), ...)) to start it.
+func (m *Mux) OpenStream(ctx context.Context) (*MuxStream, error) {
+	m.mu.Lock()
+	if m.err != nil {
+		m.mu.Unlock()
+		return nil, m.err
+	}
+	for {
+		m.nextSeqID++
+		if m.nextSeqID <= 0 { // wrapped around
+			m.nextSeqID = 1
+		}
+		if _, ok := m.streams[m.nextSeqID]; !ok {
+			break
+		}
+	}
+	s := m.addStream(m.nextSeqID)
+	m.mu.Unlock()
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				_ = s.cancelWith(ctx.Err().Error())
+			case <-s.ctx.Done():
+			}
+		}()
+	}
+	return s, nil
+}
+
+// Accept returns the next stream started by the peer, which is only available for a server Mux
+func (m *Mux) Accept(ctx context.Context) (*MuxStream, error) {
+	for {
+		m.mu.Lock()
+		if len(m.accepted) > 0 {
+			s := m.accepted[0]
+			m.accepted[0] = nil
+			m.accepted = m.accepted[1:]
+			m.mu.Unlock()
+			return s, nil
+		}
+		err := m.err
+		m.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		select {
+		case <-m.acceptCh:
+		case <-m.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// NumStreams returns the number of active streams
+func (m *Mux) NumStreams() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.streams)
+}
+
+// Done returns a channel which is closed when the Mux is closed or the connection fails
+func (m *Mux) Done() <-chan struct{} {
+	return m.done
+}
+
+// Err returns the error which closed the Mux, or nil if it's still working
+func (m *Mux) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// Close closes the connection, and fails all active streams with ErrMuxClosed
+// It returns nil if the Mux is closed by this call, otherwise the error which has closed it (see Err),
+// e.g. ErrMuxClosed for a second call, or the error of the connection.
+// Note: frames buffered by the FrameWriter (e.g. with WithFlushLatency) are dropped.
+func (m *Mux) Close() error {
+	if m.fail(ErrMuxClosed) {
+		return nil
+	}
+	return m.Err()
+}
+
+// fail closes the Mux with the error and fails all active streams; only the first error is kept,
+// and it returns false if the Mux has been closed
+func (m *Mux) fail(err error) bool {
+	m.mu.Lock()
+	if m.err != nil {
+		m.mu.Unlock()
+		return false
+	}
+	m.err = err
+	streams := m.streams
+	m.streams = map[int32]*MuxStream{}
+	m.mu.Unlock()
+
+	close(m.done)
+	_ = m.conn.Close() // first, which releases writes blocked by an unresponsive peer
+	_ = m.writer.Close()
+	for _, s := range streams {
+		s.fail(unexpectedEOF(err)) // io.EOF is for the end of streams
+	}
+	return true
+}
+
+// addStream creates and registers a stream; the caller should hold the lock
+func (m *Mux) addStream(seqID int32) *MuxStream {
+	s := &MuxStream{
+		mux:    m,
+		state:  NewStream(seqID),
+		notify: make(chan struct{}, 1),
+
+		sendWindow: m.streamWindow,
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	m.streams[seqID] = s
+	return s
+}
+
+// removeStream unregisters the stream if it's still registered, and cancels its context
+func (m *Mux) removeStream(s *MuxStream) {
+	m.mu.Lock()
+	if m.streams[s.SeqID()] == s {
+		delete(m.streams, s.SeqID())
+	}
+	m.mu.Unlock()
+	s.cancel()
+}
+
+// writeFrame writes the frame; the Mux fails on errors of writing, but not on frames which can't be encoded
+func (m *Mux) writeFrame(f *Frame) error {
+	if _, err := f.Header().BytesLength(); err != nil { // nothing is written
+		return err
+	}
+	if err := m.writer.WriteFrame(f); err != nil {
+		m.fail(err)
+		return m.Err()
+	}
+	return nil
+}
+
+func (m *Mux) readLoop() {
+	reader := bufio.NewReader(m.conn)
+	for {
+		f := &Frame{}
+		err := f.read(reader, m.maxFrameSize)
+		if err != nil {
+			m.fail(err)
+			return
+		}
+		m.touch()
+		if err = m.dispatch(f); err != nil {
+			m.fail(err)
+			return
+		}
+	}
+}
+
+// dispatch delivers the frame to its stream; returns an error only if the connection should be closed
+func (m *Mux) dispatch(f *Frame) error {
+	if !f.Header().IsStreaming() {
+		return ErrNotStreamFrame
+	}
+	seqID := f.Header().SeqID()
+	m.mu.Lock()
+	if m.err != nil {
+		m.mu.Unlock()
+		return nil
+	}
+	if data, ok := f.Ping(); ok {
+		m.mu.Unlock()
+		m.sendControl(NewPongFrame(data)) // not writing in the reader goroutine
+		return nil
+	}
+	if _, ok := f.Pong(); ok { // the time is recorded by touch
+		m.mu.Unlock()
+		return nil
+	}
+	if increment, ok := f.WindowUpdate(); ok {
+		m.updateWindow(seqID, increment)
+		m.mu.Unlock()
+		return nil
+	}
+	s, ok := m.streams[seqID]
+	if !ok {
+		if !m.server || f.Type() != FrameKindHeader {
+			m.mu.Unlock()
+			m.consumeAsync(dataSize(f))
+			return nil
+		}
+		s = m.addStream(seqID)
+		m.accepted = append(m.accepted, s)
+		select {
+		case m.acceptCh <- struct{}{}:
+		default:
+		}
+	}
+	m.mu.Unlock()
+
+	if err := s.state.OnRecv(f); err != nil {
+		m.removeStream(s)
+		s.fail(err)
+		m.consumeAsync(dataSize(f))
+		return nil
+	}
+	if f.IsCancel() {
+		discarded, _ := s.reset(f.TrailerErr())
+		m.removeStream(s)
+		m.consumeAsync(discarded)
+		return nil
+	}
+	s.push(f)
+	if s.state.Closed() {
+		m.removeStream(s)
+	}
+	return nil
+}
+
+// MuxStream is a stream in a Mux
+type MuxStream struct {
+	mux   *Mux
+	state *Stream
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	queue    []*Frame
+	notify   chan struct{} // notified when queue or err is changed
+	err      error
+	canceled bool // by either side
+
+	// flow control, guarded by the lock of mux
+	sendWindow   int
+	recvConsumed int
+}
+
+// SeqID returns the seqID of the stream
+func (s *MuxStream) SeqID() int32 {
+	return s.state.SeqID()
+}
+
+// State returns the state machine of the stream, for inspecting states
+func (s *MuxStream) State() *Stream {
+	return s.state
+}
+
+// Context returns the context of the stream, which is canceled when the stream ends, i.e.
+// trailers are both sent and received, either side cancels it, or the connection fails.
+// It's useful for handlers to learn that the peer has given up on the stream.
+func (s *MuxStream) Context() context.Context {
+	return s.ctx
+}
+
+// Cancel cancels the stream, sending a cancel frame to the peer (see NewCancelFrame) unless it has ended
+// Later reads and writes of the stream return an *Exception of ExceptionTypeCanceled, and received frames
+// not yet read are discarded.
+func (s *MuxStream) Cancel() error {
+	return s.cancelWith("")
+}
+
+func (s *MuxStream) cancelWith(message string) error {
+	if s.state.Closed() {
+		return nil
+	}
+	f := NewCancelFrame(s.SeqID(), message)
+	discarded, ok := s.reset(f.TrailerErr())
+	if !ok { // canceled by others
+		return nil
+	}
+	s.mux.removeStream(s)
+	s.mux.consume(nil, discarded)
+	prev, next, err := s.state.onSend(f)
+	if err != nil {
+		return err
+	}
+	if err = s.mux.writeFrame(f); err != nil {
+		s.state.revertSend(prev, next)
+		return err
+	}
+	return nil
+}
+
+// WriteFrame validates the frame by the state machine of the stream (see Stream.OnSend) and writes it
+// If flow control is enabled, it blocks for data frames until the peer has consumed enough data.
+func (s *MuxStream) WriteFrame(f *Frame) error {
+	return s.writeFrame(context.Background(), f)
+}
+
+// writeFrame is WriteFrame with ctx for waiting for the flow control
+func (s *MuxStream) writeFrame(ctx context.Context, f *Frame) error {
+	s.mu.Lock()
+	err := s.err
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if h := f.Header(); h != nil { // before changing the state, for frames which can't be encoded
+		if _, err = h.BytesLength(); err != nil {
+			return err
+		}
+	}
+	size := dataSize(f)
+	if s.mux.flowControl() && size > 0 {
+		if err = s.acquireWindow(ctx, size); err != nil {
+			return err
+		}
+	}
+	prev, next, err := s.state.onSend(f)
+	if err != nil {
+		if s.mux.flowControl() && size > 0 {
+			s.releaseWindow(size)
+		}
+		return err
+	}
+	if err = s.mux.writeFrame(f); err != nil {
+		s.state.revertSend(prev, next) // not sent
+		return err
+	}
+	if s.state.Closed() {
+		s.mux.removeStream(s)
+	}
+	return nil
+}
+
+// ReadFrame returns the next received frame of the stream, blocking until it's available
+// It returns io.EOF after the trailer frame is returned, or the error which failed the stream,
+// e.g. the error of the connection or a *StreamStateError for illegal frames from the peer.
+func (s *MuxStream) ReadFrame(ctx context.Context) (*Frame, error) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			f := s.queue[0]
+			s.queue[0] = nil
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			s.mux.consume(s, dataSize(f))
+			return f, nil
+		}
+		err, canceled := s.err, s.canceled
+		s.mu.Unlock()
+		if canceled {
+			return nil, err
+		}
+		if s.state.RecvState() == StreamStateClosed {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		select {
+		case <-s.notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *MuxStream) push(f *Frame) {
+	s.mu.Lock()
+	s.queue = append(s.queue, f)
+	s.mu.Unlock()
+	s.wakeup()
+}
+
+// fail makes the stream return the error after the queued frames; only the first error is kept
+func (s *MuxStream) fail(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+	s.wakeup()
+	s.cancel()
+}
+
+// release removes the stream without canceling it, discarding the frames not read, e.g. for servers which have
+// sent the trailer, and will not read the rest of the stream; later reads return io.EOF.
+func (s *MuxStream) release() {
+	if s.state.Closed() { // already removed
+		return
+	}
+	discarded, _ := s.reset(io.EOF)
+	s.mux.removeStream(s)
+	s.mux.consume(nil, discarded)
+}
+
+// reset cancels the stream with the error, discarding the queued frames; returns the discarded data size,
+// and false if the stream has been canceled, i.e. only the first call takes effect
+func (s *MuxStream) reset(err error) (int, bool) {
+	s.mu.Lock()
+	if s.canceled {
+		s.mu.Unlock()
+		return 0, false
+	}
+	discarded := 0
+	for _, f := range s.queue {
+		discarded += dataSize(f)
+	}
+	s.canceled = true
+	s.queue = nil
+	s.err = err
+	s.mu.Unlock()
+	s.wakeup()
+	return discarded, true
+}
+
+func (s *MuxStream) wakeup() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
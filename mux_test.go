@@ -0,0 +1,356 @@
+package ttheader
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestMuxPair(t *testing.T) (client, server *Mux) {
+	c, s := net.Pipe()
+	client, server = NewClientMux(c), NewServerMux(s)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	return client, server
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestMux(t *testing.T) {
+	t.Run("echo", func(t *testing.T) {
+		ctx := testContext(t)
+		client, server := newTestMuxPair(t)
+		go func() {
+			s, err := server.Accept(ctx)
+			if err != nil {
+				return
+			}
+			for {
+				f, err := s.ReadFrame(ctx)
+				if err != nil {
+					return
+				}
+				switch f.Type() {
+				case FrameKindHeader:
+					_ = s.WriteFrame(NewHeaderFrame(s.SeqID(), nil, nil))
+				case FrameKindData:
+					_ = s.WriteFrame(NewDataFrame(s.SeqID(), f.Payload()))
+				case FrameKindTrailer:
+					_ = s.WriteFrame(NewTrailerFrame(s.SeqID(), nil, nil))
+				}
+			}
+		}()
+
+		s, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		assert(t, s.SeqID() == 1, s.SeqID())
+		assert(t, s.WriteFrame(NewHeaderFrame(1, map[uint16]string{IntKeyToMethod: "echo"}, nil)) == nil)
+		assert(t, s.WriteFrame(NewDataFrame(1, []byte("hello"))) == nil)
+		assert(t, s.WriteFrame(NewTrailerFrame(1, nil, nil)) == nil)
+
+		var kinds []FrameKind
+		for {
+			f, err := s.ReadFrame(ctx)
+			if err == io.EOF {
+				break
+			}
+			assert(t, err == nil, err)
+			kinds = append(kinds, f.Type())
+			if f.Type() == FrameKindData {
+				assert(t, string(f.Payload()) == "hello", f.Payload())
+			}
+		}
+		assert(t, len(kinds) == 3 && kinds[2] == FrameKindTrailer, kinds)
+		assert(t, s.State().Closed())
+		assert(t, client.NumStreams() == 0, "removed", client.NumStreams())
+		<-s.Context().Done()
+		assert(t, s.Cancel() == nil, "no-op for ended streams")
+		_, err = s.ReadFrame(ctx)
+		assert(t, err == io.EOF, err)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		ctx := testContext(t)
+		client, server := newTestMuxPair(t)
+		go func() {
+			for {
+				s, err := server.Accept(ctx)
+				if err != nil {
+					return
+				}
+				go func() {
+					for {
+						f, err := s.ReadFrame(ctx)
+						if err != nil {
+							return
+						}
+						if f.Type() == FrameKindData { // reply with the data frame as the header and trailer
+							_ = s.WriteFrame(NewHeaderFrame(s.SeqID(), nil, map[string]string{"echo": string(f.Payload())}))
+							_ = s.WriteFrame(NewTrailerFrame(s.SeqID(), nil, nil))
+						}
+					}
+				}()
+			}
+		}()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s, err := client.OpenStream(ctx)
+				assert(t, err == nil, err)
+				payload := string(rune('a' + s.SeqID()))
+				assert(t, s.WriteFrame(NewHeaderFrame(s.SeqID(), nil, nil)) == nil)
+				assert(t, s.WriteFrame(NewDataFrame(s.SeqID(), []byte(payload))) == nil)
+				f, err := s.ReadFrame(ctx)
+				assert(t, err == nil, err)
+				echo, _ := f.Header().GetStrKey("echo")
+				assert(t, echo == payload, s.SeqID(), echo)
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("illegal-frame", func(t *testing.T) {
+		ctx := testContext(t)
+		c, conn := net.Pipe()
+		client := NewClientMux(c)
+		t.Cleanup(func() { _ = client.Close() })
+		s, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+
+		_, err = NewDataFrame(s.SeqID(), nil).WriteTo(conn) // data before header
+		assert(t, err == nil, err)
+		_, err = s.ReadFrame(ctx)
+		var stateErr *StreamStateError
+		assert(t, errors.As(err, &stateErr), err)
+		assert(t, client.NumStreams() == 0, client.NumStreams())
+		assert(t, client.Err() == nil, "the connection is still working", client.Err())
+
+		_, err = NewDataFrame(100, nil).WriteTo(conn) // unknown streams are ignored
+		assert(t, err == nil, err)
+		_, err = NewFrame(NewHeader(), nil).WriteTo(conn)
+		assert(t, err == nil, err)
+		<-client.Done()
+		assert(t, client.Err() == ErrNotStreamFrame, client.Err())
+		assert(t, client.Close() == ErrNotStreamFrame, "the earlier error")
+	})
+
+	t.Run("frame-too-large", func(t *testing.T) {
+		c, conn := net.Pipe()
+		client := NewClientMux(c, WithMuxMaxFrameSize(1024))
+		t.Cleanup(func() { _ = client.Close() })
+		_, err := conn.Write([]byte{0, 0, 4, 1}) // only the size is checked
+		assert(t, err == nil, err)
+		<-client.Done()
+		assert(t, client.Err() == ErrFrameTooLarge, client.Err())
+	})
+
+	t.Run("illegal-send", func(t *testing.T) {
+		client, _ := newTestMuxPair(t)
+		s, err := client.OpenStream(context.Background())
+		assert(t, err == nil, err)
+		var stateErr *StreamStateError
+		assert(t, errors.As(s.WriteFrame(NewDataFrame(s.SeqID(), nil)), &stateErr))
+	})
+
+	t.Run("encode-error", func(t *testing.T) {
+		ctx := testContext(t)
+		client, server := newTestMuxPair(t)
+		s, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		f := NewHeaderFrame(s.SeqID(), nil, map[string]string{"k": string(make([]byte, 70000))})
+		assert(t, s.WriteFrame(f) == ErrMetaSizeTooLarge)
+		assert(t, client.Err() == nil, "the connection is kept", client.Err())
+		assert(t, s.State().SendState() == StreamStateIdle, s.State().SendState())
+
+		s2, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		assert(t, s2.WriteFrame(NewHeaderFrame(s2.SeqID(), nil, nil)) == nil)
+		ss, err := server.Accept(ctx)
+		assert(t, err == nil && ss.SeqID() == s2.SeqID(), ss, err)
+	})
+
+	t.Run("connection-closed", func(t *testing.T) {
+		ctx := testContext(t)
+		client, server := newTestMuxPair(t)
+		s, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		assert(t, s.WriteFrame(NewHeaderFrame(s.SeqID(), nil, nil)) == nil)
+		ss, err := server.Accept(ctx)
+		assert(t, err == nil, err)
+		_, err = ss.ReadFrame(ctx)
+		assert(t, err == nil, err)
+
+		assert(t, server.Close() == nil)
+		assert(t, server.Close() == ErrMuxClosed, "closed")
+		_, err = ss.ReadFrame(ctx)
+		assert(t, err == ErrMuxClosed, err)
+		_, err = server.Accept(ctx)
+		assert(t, err == ErrMuxClosed, err)
+
+		_, err = s.ReadFrame(ctx)
+		assert(t, err == io.ErrUnexpectedEOF, "not the end of stream", err)
+		assert(t, s.WriteFrame(NewDataFrame(s.SeqID(), nil)) != nil)
+		_, err = client.OpenStream(ctx)
+		assert(t, err == io.EOF, err)
+	})
+
+	t.Run("close-while-writing", func(t *testing.T) {
+		ctx := testContext(t)
+		c, _ := net.Pipe() // the peer never reads
+		client := NewClientMux(c)
+		s, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		ch := writeAsync(s, NewHeaderFrame(s.SeqID(), nil, nil))
+		assertBlocked(t, ch)
+
+		closed := make(chan error, 1)
+		go func() {
+			closed <- client.Close()
+		}()
+		select {
+		case err = <-closed:
+			assert(t, err == nil, err)
+		case <-ctx.Done():
+			t.Fatal("Close is blocked by the write")
+		}
+		select {
+		case err = <-ch:
+			assert(t, err != nil, "the write fails")
+			assert(t, s.State().SendState() == StreamStateIdle, "not sent", s.State().SendState())
+		case <-ctx.Done():
+			t.Fatal("still blocked")
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		client, server := newTestMuxPair(t)
+		s, err := client.OpenStream(context.Background())
+		assert(t, err == nil, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = s.ReadFrame(ctx)
+		assert(t, err == context.Canceled, err)
+		_, err = server.Accept(ctx)
+		assert(t, err == context.Canceled, err)
+	})
+}
+
+func TestMuxStream_Cancel(t *testing.T) {
+	t.Run("by-client", func(t *testing.T) {
+		ctx := testContext(t)
+		client, server := newTestMuxPair(t)
+		s, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		assert(t, s.WriteFrame(NewHeaderFrame(s.SeqID(), nil, nil)) == nil)
+		assert(t, s.WriteFrame(NewTrailerFrame(s.SeqID(), nil, nil)) == nil, "can be canceled after half-closed")
+		ss, err := server.Accept(ctx)
+		assert(t, err == nil, err)
+
+		assert(t, s.Cancel() == nil)
+		assert(t, s.Cancel() == nil, "idempotent")
+		_, err = s.ReadFrame(ctx)
+		assert(t, errors.Is(err, ExceptionTypeCanceled), err)
+		assert(t, errors.Is(s.WriteFrame(NewDataFrame(s.SeqID(), nil)), ExceptionTypeCanceled))
+		assert(t, client.NumStreams() == 0, client.NumStreams())
+		<-s.Context().Done()
+
+		select {
+		case <-ss.Context().Done():
+		case <-ctx.Done():
+			t.Fatal("the server stream is not canceled")
+		}
+		_, err = ss.ReadFrame(ctx)
+		assert(t, errors.Is(err, ExceptionTypeCanceled), "queued frames are discarded", err)
+		assert(t, errors.Is(ss.WriteFrame(NewHeaderFrame(ss.SeqID(), nil, nil)), ExceptionTypeCanceled))
+		assert(t, server.NumStreams() == 0, server.NumStreams())
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		ctx := testContext(t)
+		c, peer := net.Pipe()
+		client := NewClientMux(c)
+		var cancels int32
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			reader := bufio.NewReader(peer)
+			for {
+				f, err := ReadFrame(reader)
+				if err != nil {
+					return
+				}
+				if f.IsCancel() {
+					atomic.AddInt32(&cancels, 1)
+				}
+			}
+		}()
+		s, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		assert(t, s.WriteFrame(NewHeaderFrame(s.SeqID(), nil, nil)) == nil)
+
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				_ = s.Cancel()
+			}()
+		}
+		close(start)
+		wg.Wait()
+		_ = client.Close()
+		<-done
+		assert(t, atomic.LoadInt32(&cancels) == 1, "sent only once", cancels)
+	})
+
+	t.Run("by-context", func(t *testing.T) {
+		ctx := testContext(t)
+		client, server := newTestMuxPair(t)
+		streamCtx, cancel := context.WithCancel(ctx)
+		s, err := client.OpenStream(streamCtx)
+		assert(t, err == nil, err)
+		assert(t, s.WriteFrame(NewHeaderFrame(s.SeqID(), nil, nil)) == nil)
+		ss, err := server.Accept(ctx)
+		assert(t, err == nil, err)
+		_, err = ss.ReadFrame(ctx)
+		assert(t, err == nil, err)
+
+		cancel()
+		_, err = ss.ReadFrame(ctx)
+		assert(t, errors.Is(err, ExceptionTypeCanceled) && err.Error() == "context canceled", err)
+		<-ss.Context().Done()
+		_, err = s.ReadFrame(ctx)
+		assert(t, errors.Is(err, ExceptionTypeCanceled), err)
+	})
+
+	t.Run("by-server", func(t *testing.T) {
+		ctx := testContext(t)
+		client, server := newTestMuxPair(t)
+		s, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		assert(t, s.WriteFrame(NewHeaderFrame(s.SeqID(), nil, nil)) == nil)
+		ss, err := server.Accept(ctx)
+		assert(t, err == nil, err)
+		assert(t, ss.Cancel() == nil)
+		_, err = s.ReadFrame(ctx)
+		assert(t, errors.Is(err, ExceptionTypeCanceled), err)
+		<-s.Context().Done()
+	})
+}
@@ -0,0 +1,49 @@
+package ttheader
+
+import "io"
+
+// PayloadReader reads the payload of a frame from the underlying io.Reader, limited to the declared frame size
+type PayloadReader struct {
+	reader    io.Reader
+	remaining int
+}
+
+func newPayloadReader(reader io.Reader, size int) *PayloadReader {
+	return &PayloadReader{reader: reader, remaining: size}
+}
+
+// Read implements io.Reader; it returns io.EOF at the end of the payload,
+// or io.ErrUnexpectedEOF if the underlying reader ends before that
+func (r *PayloadReader) Read(p []byte) (n int, err error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if len(p) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err = r.reader.Read(p)
+	r.remaining -= n
+	if err == io.EOF && r.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Remaining returns the size of the unread payload
+func (r *PayloadReader) Remaining() int {
+	return r.remaining
+}
+
+// Close discards the unread payload, so that the underlying reader is positioned at the next frame
+// Note: the underlying reader is not closed
+func (r *PayloadReader) Close() error {
+	if r.remaining <= 0 {
+		return nil
+	}
+	n, err := io.CopyN(io.Discard, r.reader, int64(r.remaining))
+	r.remaining -= int(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
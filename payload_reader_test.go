@@ -0,0 +1,45 @@
+package ttheader
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestPayloadReader_Read(t *testing.T) {
+	t.Run("limited", func(t *testing.T) {
+		r := newPayloadReader(bytes.NewReader([]byte{1, 2, 3, 4, 5}), 3)
+		buf, err := io.ReadAll(r)
+		assert(t, err == nil, err)
+		assert(t, bytes.Equal(buf, []byte{1, 2, 3}), buf)
+		assert(t, r.Remaining() == 0, r.Remaining())
+	})
+	t.Run("unexpected-eof", func(t *testing.T) {
+		r := newPayloadReader(bytes.NewReader([]byte{1, 2}), 3)
+		_, err := io.ReadAll(r)
+		assert(t, err == io.ErrUnexpectedEOF, err)
+		assert(t, r.Remaining() == 1, r.Remaining())
+	})
+}
+
+func TestPayloadReader_Close(t *testing.T) {
+	t.Run("discard", func(t *testing.T) {
+		underlying := bytes.NewReader([]byte{1, 2, 3, 4, 5})
+		r := newPayloadReader(underlying, 3)
+		buf := make([]byte, 1)
+		_, err := r.Read(buf)
+		assert(t, err == nil, err)
+		assert(t, r.Close() == nil)
+		assert(t, r.Remaining() == 0, r.Remaining())
+		assert(t, underlying.Len() == 2, underlying.Len())
+	})
+	t.Run("unexpected-eof", func(t *testing.T) {
+		r := newPayloadReader(bytes.NewReader([]byte{1}), 3)
+		err := r.Close()
+		assert(t, err == io.ErrUnexpectedEOF, err)
+	})
+	t.Run("nothing-to-discard", func(t *testing.T) {
+		r := newPayloadReader(bytes.NewReader(nil), 0)
+		assert(t, r.Close() == nil)
+	})
+}
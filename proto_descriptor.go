@@ -0,0 +1,318 @@
+package ttheader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// field numbers in descriptor.proto, for parsing a FileDescriptorSet (e.g. by protoc --descriptor_set_out)
+const (
+	protoFieldFileSetFile = 1 // FileDescriptorSet.file
+
+	protoFieldFilePackage = 2 // FileDescriptorProto.package
+	protoFieldFileMessage = 4 // FileDescriptorProto.message_type
+	protoFieldFileEnum    = 5 // FileDescriptorProto.enum_type
+
+	protoFieldMessageName   = 1 // DescriptorProto.name
+	protoFieldMessageField  = 2 // DescriptorProto.field
+	protoFieldMessageNested = 3 // DescriptorProto.nested_type
+	protoFieldMessageEnum   = 4 // DescriptorProto.enum_type
+
+	protoFieldFieldName     = 1 // FieldDescriptorProto.name
+	protoFieldFieldNumber   = 3 // FieldDescriptorProto.number
+	protoFieldFieldLabel    = 4 // FieldDescriptorProto.label
+	protoFieldFieldType     = 5 // FieldDescriptorProto.type
+	protoFieldFieldTypeName = 6 // FieldDescriptorProto.type_name
+
+	protoFieldEnumName        = 1 // EnumDescriptorProto.name
+	protoFieldEnumValue       = 2 // EnumDescriptorProto.value
+	protoFieldEnumValueName   = 1 // EnumValueDescriptorProto.name
+	protoFieldEnumValueNumber = 2 // EnumValueDescriptorProto.number
+
+	protoLabelRepeated = 3
+)
+
+// ProtoFieldType is the type of a protobuf field, as FieldDescriptorProto.Type
+type ProtoFieldType int32
+
+const (
+	ProtoTypeDouble   ProtoFieldType = 1
+	ProtoTypeFloat    ProtoFieldType = 2
+	ProtoTypeInt64    ProtoFieldType = 3
+	ProtoTypeUint64   ProtoFieldType = 4
+	ProtoTypeInt32    ProtoFieldType = 5
+	ProtoTypeFixed64  ProtoFieldType = 6
+	ProtoTypeFixed32  ProtoFieldType = 7
+	ProtoTypeBool     ProtoFieldType = 8
+	ProtoTypeString   ProtoFieldType = 9
+	ProtoTypeGroup    ProtoFieldType = 10
+	ProtoTypeMessage  ProtoFieldType = 11
+	ProtoTypeBytes    ProtoFieldType = 12
+	ProtoTypeUint32   ProtoFieldType = 13
+	ProtoTypeEnum     ProtoFieldType = 14
+	ProtoTypeSfixed32 ProtoFieldType = 15
+	ProtoTypeSfixed64 ProtoFieldType = 16
+	ProtoTypeSint32   ProtoFieldType = 17
+	ProtoTypeSint64   ProtoFieldType = 18
+)
+
+var protoFieldTypeNames = map[ProtoFieldType]string{
+	ProtoTypeDouble:   "double",
+	ProtoTypeFloat:    "float",
+	ProtoTypeInt64:    "int64",
+	ProtoTypeUint64:   "uint64",
+	ProtoTypeInt32:    "int32",
+	ProtoTypeFixed64:  "fixed64",
+	ProtoTypeFixed32:  "fixed32",
+	ProtoTypeBool:     "bool",
+	ProtoTypeString:   "string",
+	ProtoTypeGroup:    "group",
+	ProtoTypeMessage:  "message",
+	ProtoTypeBytes:    "bytes",
+	ProtoTypeUint32:   "uint32",
+	ProtoTypeEnum:     "enum",
+	ProtoTypeSfixed32: "sfixed32",
+	ProtoTypeSfixed64: "sfixed64",
+	ProtoTypeSint32:   "sint32",
+	ProtoTypeSint64:   "sint64",
+}
+
+func (t ProtoFieldType) String() string {
+	if name, ok := protoFieldTypeNames[t]; ok {
+		return name
+	}
+	return "field type " + strconv.Itoa(int(t))
+}
+
+// ProtoDescriptorSet contains messages and enums in a FileDescriptorSet, by full names (e.g. "pkg.Outer.Inner")
+type ProtoDescriptorSet struct {
+	Messages map[string]*ProtoMessageDesc
+	Enums    map[string]*ProtoEnumDesc
+}
+
+// ProtoMessageDesc is the descriptor of a message
+type ProtoMessageDesc struct {
+	FullName string
+	Fields   []*ProtoFieldDesc
+}
+
+// ProtoFieldDesc is the descriptor of a field
+type ProtoFieldDesc struct {
+	Number   int
+	Name     string
+	Type     ProtoFieldType
+	Repeated bool
+	// TypeName is the full name of message/enum types, e.g. ".pkg.Message"
+	TypeName string
+	// Message or Enum is the resolved type of TypeName; nil if not found in the set
+	Message *ProtoMessageDesc
+	Enum    *ProtoEnumDesc
+}
+
+// ProtoEnumDesc is the descriptor of an enum
+type ProtoEnumDesc struct {
+	FullName string
+	Values   map[int32]string
+}
+
+// Field returns the field by number, or nil if not found
+func (d *ProtoMessageDesc) Field(num int) *ProtoFieldDesc {
+	for _, f := range d.Fields {
+		if f.Number == num {
+			return f
+		}
+	}
+	return nil
+}
+
+// Decode decodes a message in protobuf wire format with the descriptor
+func (d *ProtoMessageDesc) Decode(buf []byte) (*ProtoMessage, error) {
+	return protoDecoder{heuristic: true}.decode(buf, d, 0)
+}
+
+// TypeString returns the type for display, e.g. "int32", "repeated string", ".pkg.Message"
+func (d *ProtoFieldDesc) TypeString() string {
+	s := d.Type.String()
+	if d.TypeName != "" {
+		s = d.TypeName
+	}
+	if d.Repeated {
+		return "repeated " + s
+	}
+	return s
+}
+
+// Message returns the message by full name, with or without the leading dot
+func (s *ProtoDescriptorSet) Message(name string) *ProtoMessageDesc {
+	return s.Messages[strings.TrimPrefix(name, ".")]
+}
+
+// ParseProtoDescriptorSet parses the serialized FileDescriptorSet, e.g. by protoc --descriptor_set_out
+// Note: only names, numbers and types of messages, fields and enums are parsed; options are ignored.
+func ParseProtoDescriptorSet(buf []byte) (*ProtoDescriptorSet, error) {
+	set := &ProtoDescriptorSet{
+		Messages: map[string]*ProtoMessageDesc{},
+		Enums:    map[string]*ProtoEnumDesc{},
+	}
+	files, err := decodeProtoDescriptor(buf)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files.Fields {
+		if file.Number != protoFieldFileSetFile {
+			continue
+		}
+		fileDesc, err := decodeProtoDescriptor(file.Value)
+		if err != nil {
+			return nil, err
+		}
+		pkg, err := protoDescriptorString(fileDesc, protoFieldFilePackage)
+		if err != nil {
+			return nil, err
+		}
+		if err = set.addTypes(fileDesc, pkg, protoFieldFileMessage, protoFieldFileEnum, 0); err != nil {
+			return nil, err
+		}
+	}
+	for _, m := range set.Messages {
+		for _, f := range m.Fields {
+			name := strings.TrimPrefix(f.TypeName, ".")
+			f.Message, f.Enum = set.Messages[name], set.Enums[name]
+		}
+	}
+	return set, nil
+}
+
+// addTypes adds messages and enums (by the given field numbers) in the file or message, with the scope as prefix
+func (s *ProtoDescriptorSet) addTypes(parent *ProtoMessage, scope string, messageNum, enumNum, depth int) error {
+	if depth > maxProtoDepth {
+		return ErrProtobufDepthExceeded
+	}
+	for _, field := range parent.Fields {
+		if field.Number != messageNum && field.Number != enumNum {
+			continue
+		}
+		desc, err := decodeProtoDescriptor(field.Value)
+		if err != nil {
+			return err
+		}
+		name, err := protoDescriptorString(desc, protoFieldMessageName) // the same number for enums
+		if err != nil {
+			return err
+		}
+		if scope != "" {
+			name = scope + "." + name
+		}
+		if field.Number == enumNum {
+			if s.Enums[name], err = parseProtoEnumDesc(desc, name); err != nil {
+				return err
+			}
+			continue
+		}
+		if s.Messages[name], err = parseProtoMessageDesc(desc, name); err != nil {
+			return err
+		}
+		if err = s.addTypes(desc, name, protoFieldMessageNested, protoFieldMessageEnum, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseProtoMessageDesc(desc *ProtoMessage, name string) (*ProtoMessageDesc, error) {
+	m := &ProtoMessageDesc{FullName: name}
+	for _, field := range desc.Fields {
+		if field.Number != protoFieldMessageField {
+			continue
+		}
+		fieldDesc, err := decodeProtoDescriptor(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		f := &ProtoFieldDesc{}
+		if f.Name, err = protoDescriptorString(fieldDesc, protoFieldFieldName); err != nil {
+			return nil, err
+		}
+		if f.TypeName, err = protoDescriptorString(fieldDesc, protoFieldFieldTypeName); err != nil {
+			return nil, err
+		}
+		number, err := protoDescriptorVarint(fieldDesc, protoFieldFieldNumber)
+		if err != nil {
+			return nil, err
+		}
+		label, err := protoDescriptorVarint(fieldDesc, protoFieldFieldLabel)
+		if err != nil {
+			return nil, err
+		}
+		tp, err := protoDescriptorVarint(fieldDesc, protoFieldFieldType)
+		if err != nil {
+			return nil, err
+		}
+		f.Number, f.Repeated, f.Type = int(number), label == protoLabelRepeated, ProtoFieldType(tp)
+		m.Fields = append(m.Fields, f)
+	}
+	return m, nil
+}
+
+func parseProtoEnumDesc(desc *ProtoMessage, name string) (*ProtoEnumDesc, error) {
+	e := &ProtoEnumDesc{FullName: name, Values: map[int32]string{}}
+	for _, field := range desc.Fields {
+		if field.Number != protoFieldEnumValue {
+			continue
+		}
+		valueDesc, err := decodeProtoDescriptor(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		valueName, err := protoDescriptorString(valueDesc, protoFieldEnumValueName)
+		if err != nil {
+			return nil, err
+		}
+		number, err := protoDescriptorVarint(valueDesc, protoFieldEnumValueNumber)
+		if err != nil {
+			return nil, err
+		}
+		e.Values[int32(number)] = valueName
+	}
+	return e, nil
+}
+
+// decodeProtoDescriptor decodes the value of a bytes field in descriptors, without heuristics
+func decodeProtoDescriptor(value interface{}) (*ProtoMessage, error) {
+	buf, ok := value.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("invalid descriptor: %w", ErrInvalidProtobufWireType)
+	}
+	return protoDecoder{}.decode(buf, nil, 0)
+}
+
+// protoDescriptorString returns the last value of the string field, or "" if not found
+func protoDescriptorString(desc *ProtoMessage, num int) (string, error) {
+	var s string
+	for _, field := range desc.Fields {
+		if field.Number == num {
+			buf, ok := field.Value.([]byte)
+			if !ok {
+				return "", fmt.Errorf("invalid descriptor: %w", ErrInvalidProtobufWireType)
+			}
+			s = string(buf)
+		}
+	}
+	return s, nil
+}
+
+// protoDescriptorVarint returns the last value of the varint field, or 0 if not found
+func protoDescriptorVarint(desc *ProtoMessage, num int) (uint64, error) {
+	var v uint64
+	for _, field := range desc.Fields {
+		if field.Number == num {
+			n, ok := field.Value.(uint64)
+			if !ok || field.WireType != ProtoWireVarint {
+				return 0, fmt.Errorf("invalid descriptor: %w", ErrInvalidProtobufWireType)
+			}
+			v = n
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,127 @@
+package ttheader
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func testProtoFieldDesc(name string, num int, tp ProtoFieldType, repeated bool, typeName string) string {
+	buf := appendProtoStringField(nil, protoFieldFieldName, name)
+	buf = appendProtoVarintField(buf, protoFieldFieldNumber, uint64(num))
+	label := uint64(1)
+	if repeated {
+		label = protoLabelRepeated
+	}
+	buf = appendProtoVarintField(buf, protoFieldFieldLabel, label)
+	buf = appendProtoVarintField(buf, protoFieldFieldType, uint64(tp))
+	if typeName != "" {
+		buf = appendProtoStringField(buf, protoFieldFieldTypeName, typeName)
+	}
+	return string(buf)
+}
+
+func testProtoMessageDesc(name string, fields []string, nested ...string) string {
+	buf := appendProtoStringField(nil, protoFieldMessageName, name)
+	for _, f := range fields {
+		buf = appendProtoStringField(buf, protoFieldMessageField, f)
+	}
+	for _, n := range nested {
+		buf = appendProtoStringField(buf, protoFieldMessageNested, n)
+	}
+	return string(buf)
+}
+
+// testProtoDescriptorSet returns the descriptor set of testProtoMessage, i.e.
+//
+//	package test;
+//	enum Color { RED = 0; GREEN = 1; }
+//	message Msg {
+//	  message Inner { sint32 x = 1; }
+//	  int32 a = 1; string b = 2; Inner c = 3; float d = 4; double e = 5;
+//	  repeated int32 f = 6; Color g = 7; group H = 8 { int32 y = 1; }
+//	}
+func testProtoDescriptorSet() []byte {
+	inner := testProtoMessageDesc("Inner", []string{testProtoFieldDesc("x", 1, ProtoTypeSint32, false, "")})
+	group := testProtoMessageDesc("H", []string{testProtoFieldDesc("y", 1, ProtoTypeInt32, false, "")})
+	msg := testProtoMessageDesc("Msg", []string{
+		testProtoFieldDesc("a", 1, ProtoTypeInt32, false, ""),
+		testProtoFieldDesc("b", 2, ProtoTypeString, false, ""),
+		testProtoFieldDesc("c", 3, ProtoTypeMessage, false, ".test.Msg.Inner"),
+		testProtoFieldDesc("d", 4, ProtoTypeFloat, false, ""),
+		testProtoFieldDesc("e", 5, ProtoTypeDouble, false, ""),
+		testProtoFieldDesc("f", 6, ProtoTypeInt32, true, ""),
+		testProtoFieldDesc("g", 7, ProtoTypeEnum, false, ".test.Color"),
+		testProtoFieldDesc("h", 8, ProtoTypeGroup, false, ".test.Msg.H"),
+	}, inner, group)
+	enum := appendProtoStringField(nil, protoFieldEnumName, "Color")
+	for i, name := range []string{"RED", "GREEN"} {
+		value := appendProtoVarintField(appendProtoStringField(nil, protoFieldEnumValueName, name), protoFieldEnumValueNumber, uint64(i))
+		enum = appendProtoStringField(enum, protoFieldEnumValue, string(value))
+	}
+	file := appendProtoStringField(nil, 1, "test.proto")
+	file = appendProtoStringField(file, protoFieldFilePackage, "test")
+	file = appendProtoStringField(file, protoFieldFileMessage, msg)
+	file = appendProtoStringField(file, protoFieldFileEnum, string(enum))
+	return appendProtoStringField(nil, protoFieldFileSetFile, string(file))
+}
+
+func TestParseProtoDescriptorSet(t *testing.T) {
+	t.Run("normal", func(t *testing.T) {
+		set, err := ParseProtoDescriptorSet(testProtoDescriptorSet())
+		assert(t, err == nil, err)
+		assert(t, len(set.Messages) == 3, set.Messages)
+		msg := set.Message(".test.Msg")
+		assert(t, msg != nil && msg == set.Message("test.Msg") && len(msg.Fields) == 8, msg)
+		assert(t, msg.Field(3).Message == set.Messages["test.Msg.Inner"], msg.Field(3))
+		assert(t, msg.Field(7).Enum == set.Enums["test.Color"], msg.Field(7))
+		assert(t, set.Enums["test.Color"].Values[1] == "GREEN", set.Enums["test.Color"])
+		assert(t, msg.Field(6).Repeated && msg.Field(6).TypeString() == "repeated int32", msg.Field(6))
+		assert(t, msg.Field(3).TypeString() == ".test.Msg.Inner", msg.Field(3).TypeString())
+		assert(t, msg.Field(9) == nil)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		_, err := ParseProtoDescriptorSet(appendProtoVarintField(nil, protoFieldFileSetFile, 1))
+		assert(t, err != nil, "file should be bytes")
+		_, err = ParseProtoDescriptorSet([]byte{0xff})
+		assert(t, err != nil)
+	})
+}
+
+func TestProtoMessageDesc_Decode(t *testing.T) {
+	set, err := ParseProtoDescriptorSet(testProtoDescriptorSet())
+	assert(t, err == nil, err)
+
+	t.Run("json", func(t *testing.T) {
+		m, err := set.Message("test.Msg").Decode(testProtoMessage())
+		assert(t, err == nil, err)
+		buf, err := json.Marshal(m)
+		assert(t, err == nil, err)
+		expected := `[` +
+			`{"name":"a","number":1,"type":"int32","value":150,"wireType":"varint"},` +
+			`{"name":"b","number":2,"type":"string","value":"hello","wireType":"bytes"},` +
+			`{"name":"c","number":3,"type":".test.Msg.Inner","value":[` +
+			`{"name":"x","number":1,"type":"sint32","value":-1,"wireType":"varint"}],"wireType":"bytes"},` +
+			`{"name":"d","number":4,"type":"float","value":1.5,"wireType":"fixed32"},` +
+			`{"name":"e","number":5,"type":"double","value":2.5,"wireType":"fixed64"},` +
+			`{"name":"f","number":6,"type":"repeated int32","value":[1,2,3],"wireType":"bytes"},` +
+			`{"name":"g","number":7,"type":".test.Color","value":"GREEN","wireType":"varint"},` +
+			`{"name":"h","number":8,"type":".test.Msg.H","value":[` +
+			`{"name":"y","number":1,"type":"int32","value":1,"wireType":"varint"}],"wireType":"group"}` +
+			`]`
+		assert(t, string(buf) == expected, string(buf))
+	})
+	t.Run("unknown-field", func(t *testing.T) {
+		m, err := set.Message("test.Msg").Decode(appendProtoVarintField(nil, 100, 1))
+		assert(t, err == nil, err)
+		assert(t, m.Field(100).Desc == nil, m.Field(100))
+	})
+	t.Run("negative-int32", func(t *testing.T) {
+		m, err := set.Message("test.Msg").Decode(appendProtoVarintField(nil, 1, uint64(0xffffffffffffffff)))
+		assert(t, err == nil, err)
+		assert(t, m.Field(1).jsonValue() == int32(-1), m.Field(1).jsonValue())
+	})
+	t.Run("invalid-nested", func(t *testing.T) {
+		_, err := set.Message("test.Msg").Decode(appendProtoStringField(nil, 3, "\xff"))
+		assert(t, err != nil)
+	})
+}
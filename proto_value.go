@@ -0,0 +1,344 @@
+package ttheader
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ProtoWireType is the wire type of protobuf fields
+type ProtoWireType byte
+
+const (
+	ProtoWireVarint     ProtoWireType = protoWireVarint
+	ProtoWireFixed64    ProtoWireType = protoWireFixed64
+	ProtoWireBytes      ProtoWireType = protoWireBytes
+	ProtoWireStartGroup ProtoWireType = protoWireStartGroup
+	ProtoWireEndGroup   ProtoWireType = protoWireEndGroup
+	ProtoWireFixed32    ProtoWireType = protoWireFixed32
+)
+
+var protoWireTypeNames = map[ProtoWireType]string{
+	ProtoWireVarint:     "varint",
+	ProtoWireFixed64:    "fixed64",
+	ProtoWireBytes:      "bytes",
+	ProtoWireStartGroup: "group",
+	ProtoWireEndGroup:   "end_group",
+	ProtoWireFixed32:    "fixed32",
+}
+
+func (t ProtoWireType) String() string {
+	if name, ok := protoWireTypeNames[t]; ok {
+		return name
+	}
+	return "wire type " + strconv.Itoa(int(t))
+}
+
+// MarshalText renders the wire type by its name in JSON
+func (t ProtoWireType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// ProtoMessage is a protobuf message decoded from the wire format, with fields in the encoded order
+// Note: repeated fields appear as many fields with the same number.
+type ProtoMessage struct {
+	Fields []*ProtoField
+}
+
+// ProtoField is a field of a protobuf message
+// The Go type of Value depends on WireType: varint/fixed64: uint64; fixed32: uint32; bytes: []byte; group: nil.
+type ProtoField struct {
+	Number   int
+	WireType ProtoWireType
+	Value    interface{}
+	// Message is the nested message of a bytes field, or the fields of a group
+	// Without descriptors, bytes are decoded as a message if they are not printable text and
+	// can be decoded as a message; so a message is not always a message, and vice versa.
+	Message *ProtoMessage
+	// Desc is the descriptor of the field; nil if decoded without descriptors or the field is unknown
+	Desc *ProtoFieldDesc
+}
+
+// Field returns the first field with the given number, or nil if not found
+func (m *ProtoMessage) Field(num int) *ProtoField {
+	for _, field := range m.Fields {
+		if field.Number == num {
+			return field
+		}
+	}
+	return nil
+}
+
+// DecodeProtoMessage decodes a message in protobuf wire format without descriptors
+func DecodeProtoMessage(buf []byte) (*ProtoMessage, error) {
+	return protoDecoder{heuristic: true}.decode(buf, nil, 0)
+}
+
+// DecodeKitexProtobufPayload decodes the envelope and the message of a kitex protobuf payload;
+// desc can be nil for decoding without descriptors
+func DecodeKitexProtobufPayload(payload []byte, desc *ProtoMessageDesc) (*MessageBegin, *ProtoMessage, error) {
+	msg, size, err := ReadMessageBegin(payload, ProtocolIDKitexProtobuf)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := protoDecoder{heuristic: true}.decode(payload[size:], desc, 0)
+	if err != nil {
+		return msg, nil, err
+	}
+	return msg, body, nil
+}
+
+type protoDecoder struct {
+	// heuristic decodes bytes fields without descriptors as nested messages when possible
+	heuristic bool
+}
+
+func (d protoDecoder) decode(buf []byte, desc *ProtoMessageDesc, depth int) (*ProtoMessage, error) {
+	reader := newBytesReader(buf)
+	m, err := d.decodeFields(reader, desc, 0, depth)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// decodeFields decodes fields until the end of the reader, or the end of the group with the given number (if > 0)
+func (d protoDecoder) decodeFields(reader *bytesReader, desc *ProtoMessageDesc, group, depth int) (*ProtoMessage, error) {
+	if depth > maxProtoDepth {
+		return nil, ErrProtobufDepthExceeded
+	}
+	m := &ProtoMessage{}
+	for reader.idx < reader.len || group > 0 {
+		num, wireType, err := readProtoTag(reader)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if wireType == protoWireEndGroup {
+			if num != group {
+				return nil, ErrInvalidProtobufTag
+			}
+			return m, nil
+		}
+		field := &ProtoField{Number: num, WireType: ProtoWireType(wireType)}
+		if desc != nil {
+			field.Desc = desc.Field(num)
+		}
+		if err = d.decodeValue(reader, field, depth); err != nil {
+			return nil, err
+		}
+		m.Fields = append(m.Fields, field)
+	}
+	return m, nil
+}
+
+func (d protoDecoder) decodeValue(reader *bytesReader, field *ProtoField, depth int) (err error) {
+	switch field.WireType {
+	case ProtoWireVarint:
+		field.Value, err = reader.ReadUvarint()
+		return unexpectedEOF(err)
+	case ProtoWireFixed64:
+		buf, err := reader.Next(8)
+		if err != nil {
+			return err
+		}
+		field.Value = binary.LittleEndian.Uint64(buf)
+	case ProtoWireFixed32:
+		buf, err := reader.Next(4)
+		if err != nil {
+			return err
+		}
+		field.Value = binary.LittleEndian.Uint32(buf)
+	case ProtoWireBytes:
+		size, err := readProtoLength(reader)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		buf, err := reader.Next(size)
+		if err != nil {
+			return err
+		}
+		field.Value = append([]byte{}, buf...)
+		return d.decodeNested(field, buf, depth)
+	case ProtoWireStartGroup:
+		var desc *ProtoMessageDesc
+		if field.Desc != nil {
+			desc = field.Desc.Message
+		}
+		field.Message, err = d.decodeFields(reader, desc, field.Number, depth+1)
+		return err
+	default:
+		return ErrInvalidProtobufWireType
+	}
+	return nil
+}
+
+// decodeNested decodes the bytes as a message, by the descriptor or heuristics
+func (d protoDecoder) decodeNested(field *ProtoField, buf []byte, depth int) (err error) {
+	if field.Desc != nil {
+		if field.Desc.Type == ProtoTypeMessage && field.Desc.Message != nil {
+			field.Message, err = d.decode(buf, field.Desc.Message, depth+1)
+		}
+		return err
+	}
+	if d.heuristic && len(buf) > 0 && !isPrintable(buf) {
+		if m, err := d.decode(buf, nil, depth+1); err == nil {
+			field.Message = m
+		}
+	}
+	return nil
+}
+
+// isPrintable returns whether buf is valid UTF-8 text without control characters (except whitespaces)
+func isPrintable(buf []byte) bool {
+	for len(buf) > 0 {
+		r, size := utf8.DecodeRune(buf)
+		if r == utf8.RuneError && size <= 1 {
+			return false
+		}
+		if !unicode.IsPrint(r) && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+		buf = buf[size:]
+	}
+	return true
+}
+
+// MarshalJSON renders the message as a list of fields: [{"number", "wireType", "name", "type", "value"}],
+// where "name" and "type" are only available with descriptors
+func (m *ProtoMessage) MarshalJSON() ([]byte, error) {
+	fields := make([]interface{}, 0, len(m.Fields))
+	for _, field := range m.Fields {
+		entry := map[string]interface{}{
+			"number":   field.Number,
+			"wireType": field.WireType,
+			"value":    field.jsonValue(),
+		}
+		if field.Desc != nil {
+			entry["name"] = field.Desc.Name
+			entry["type"] = field.Desc.TypeString()
+		}
+		fields = append(fields, entry)
+	}
+	return json.Marshal(fields)
+}
+
+// jsonValue converts the value into a JSON friendly one:
+// (1) with descriptors, values are interpreted by field types, e.g. zigzag for sint32, names for enums,
+// and packed repeated fields are rendered as lists;
+// (2) without descriptors, varint/fixed values are rendered as unsigned integers;
+// (3) bytes which are not printable text are rendered as {"base64": "..."};
+// (4) nested messages and groups are rendered as lists of fields.
+func (f *ProtoField) jsonValue() interface{} {
+	if f.Message != nil {
+		return f.Message
+	}
+	if f.Desc == nil {
+		if buf, ok := f.Value.([]byte); ok {
+			return jsonBytes(buf)
+		}
+		return f.Value
+	}
+	buf, ok := f.Value.([]byte)
+	if !ok {
+		return f.Desc.scalar(f.Value)
+	}
+	switch f.Desc.Type {
+	case ProtoTypeString:
+		return jsonBytes(buf)
+	case ProtoTypeBytes, ProtoTypeMessage, ProtoTypeGroup:
+		return map[string]string{"base64": base64.StdEncoding.EncodeToString(buf)}
+	}
+	values, err := f.Desc.unpack(buf)
+	if err != nil {
+		return map[string]string{"base64": base64.StdEncoding.EncodeToString(buf)}
+	}
+	return values
+}
+
+// scalar interprets a varint (uint64) or fixed (uint32/uint64) value by the field type
+func (d *ProtoFieldDesc) scalar(value interface{}) interface{} {
+	var v uint64
+	switch n := value.(type) {
+	case uint64:
+		v = n
+	case uint32:
+		v = uint64(n)
+	default:
+		return value
+	}
+	switch d.Type {
+	case ProtoTypeInt32, ProtoTypeSfixed32:
+		return int32(v)
+	case ProtoTypeInt64, ProtoTypeSfixed64:
+		return int64(v)
+	case ProtoTypeUint32, ProtoTypeFixed32:
+		return uint32(v)
+	case ProtoTypeSint32:
+		return int32(unzigzag(uint64(uint32(v))))
+	case ProtoTypeSint64:
+		return unzigzag(v)
+	case ProtoTypeBool:
+		return v != 0
+	case ProtoTypeFloat:
+		return jsonFloat(float64(math.Float32frombits(uint32(v))))
+	case ProtoTypeDouble:
+		return jsonFloat(math.Float64frombits(v))
+	case ProtoTypeEnum:
+		if d.Enum != nil {
+			if name, ok := d.Enum.Values[int32(v)]; ok {
+				return name
+			}
+		}
+		return int32(v)
+	}
+	return v
+}
+
+// unpack decodes a packed repeated field of scalars
+func (d *ProtoFieldDesc) unpack(buf []byte) ([]interface{}, error) {
+	reader := newBytesReader(buf)
+	values := []interface{}{}
+	for reader.idx < reader.len {
+		var value interface{}
+		var err error
+		switch d.Type {
+		case ProtoTypeFixed32, ProtoTypeSfixed32, ProtoTypeFloat:
+			var b []byte
+			if b, err = reader.Next(4); err == nil {
+				value = binary.LittleEndian.Uint32(b)
+			}
+		case ProtoTypeFixed64, ProtoTypeSfixed64, ProtoTypeDouble:
+			var b []byte
+			if b, err = reader.Next(8); err == nil {
+				value = binary.LittleEndian.Uint64(b)
+			}
+		default:
+			value, err = reader.ReadUvarint()
+		}
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		values = append(values, d.scalar(value))
+	}
+	return values, nil
+}
+
+// jsonBytes renders printable text as string, otherwise {"base64": "..."}
+func jsonBytes(buf []byte) interface{} {
+	if isPrintable(buf) {
+		return string(buf)
+	}
+	return map[string]string{"base64": base64.StdEncoding.EncodeToString(buf)}
+}
+
+// jsonFloat renders NaN and Inf as strings, which are not supported in JSON
+func jsonFloat(f float64) interface{} {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return f
+}
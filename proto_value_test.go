@@ -0,0 +1,113 @@
+package ttheader
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+// testProtoMessage returns a message with all wire types:
+// {1: 150, 2: "hello", 3: {1: zigzag(-1)}, 4: 1.5f, 5: 2.5, 6: packed [1, 2, 3], 7: 1, 8: group {1: 1}}
+func testProtoMessage() []byte {
+	buf := appendProtoVarintField(nil, 1, 150)
+	buf = appendProtoStringField(buf, 2, "hello")
+	buf = appendProtoStringField(buf, 3, string(appendProtoVarintField(nil, 1, zigzag(-1))))
+	buf = append(appendProtoTag(buf, 4, protoWireFixed32), 0, 0, 0xc0, 0x3f)
+	buf = append(appendProtoTag(buf, 5, protoWireFixed64), 0, 0, 0, 0, 0, 0, 0x04, 0x40)
+	buf = appendProtoStringField(buf, 6, "\x01\x02\x03")
+	buf = appendProtoVarintField(buf, 7, 1)
+	buf = appendProtoVarintField(appendProtoTag(buf, 8, protoWireStartGroup), 1, 1)
+	return appendProtoTag(buf, 8, protoWireEndGroup)
+}
+
+func TestProtoWireType_String(t *testing.T) {
+	assert(t, ProtoWireBytes.String() == "bytes")
+	assert(t, ProtoWireType(7).String() == "wire type 7")
+}
+
+func TestDecodeProtoMessage(t *testing.T) {
+	t.Run("all-types", func(t *testing.T) {
+		m, err := DecodeProtoMessage(testProtoMessage())
+		assert(t, err == nil, err)
+		assert(t, len(m.Fields) == 8, len(m.Fields))
+		assert(t, m.Field(1).Value == uint64(150), m.Field(1))
+		assert(t, string(m.Field(2).Value.([]byte)) == "hello" && m.Field(2).Message == nil, m.Field(2))
+		nested := m.Field(3).Message
+		assert(t, nested != nil && nested.Field(1).Value == uint64(1), m.Field(3))
+		assert(t, m.Field(4).WireType == ProtoWireFixed32 && m.Field(4).Value == uint32(0x3fc00000), m.Field(4))
+		assert(t, m.Field(5).WireType == ProtoWireFixed64 && m.Field(5).Value == uint64(0x4004000000000000), m.Field(5))
+		assert(t, m.Field(6).Message == nil, "not a message", m.Field(6).Message)
+		assert(t, m.Field(8).WireType == ProtoWireStartGroup && m.Field(8).Message.Field(1).Value == uint64(1), m.Field(8))
+		assert(t, m.Field(9) == nil)
+	})
+	t.Run("repeated", func(t *testing.T) {
+		buf := appendProtoStringField(appendProtoStringField(nil, 1, "a"), 1, "b")
+		m, err := DecodeProtoMessage(buf)
+		assert(t, err == nil, err)
+		assert(t, len(m.Fields) == 2 && m.Fields[1].Number == 1, m.Fields)
+	})
+	t.Run("empty-bytes", func(t *testing.T) {
+		m, err := DecodeProtoMessage(appendProtoStringField(nil, 1, ""))
+		assert(t, err == nil, err)
+		assert(t, len(m.Field(1).Value.([]byte)) == 0 && m.Field(1).Message == nil, m.Field(1))
+	})
+	t.Run("truncated", func(t *testing.T) {
+		buf := testProtoMessage()
+		// truncated at field boundaries is still valid, so only check some cases:
+		// in a varint, in a string, and before the end of the group
+		for _, size := range []int{2, 6, len(buf) - 1} {
+			_, err := DecodeProtoMessage(buf[:size])
+			assert(t, err == io.ErrUnexpectedEOF, size, err)
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		_, err := DecodeProtoMessage(appendProtoTag(nil, 1, 6))
+		assert(t, err == ErrInvalidProtobufWireType, err)
+		_, err = DecodeProtoMessage(appendProtoTag(nil, 1, protoWireEndGroup))
+		assert(t, err == ErrInvalidProtobufTag, err)
+	})
+	t.Run("depth-exceeded", func(t *testing.T) {
+		var buf []byte
+		for i := 0; i <= maxProtoDepth; i++ {
+			buf = appendProtoTag(buf, 1, protoWireStartGroup)
+		}
+		_, err := DecodeProtoMessage(buf)
+		assert(t, err == ErrProtobufDepthExceeded, err)
+	})
+}
+
+func TestDecodeKitexProtobufPayload(t *testing.T) {
+	envelope, err := (&MessageBegin{Name: "echo", Type: MessageTypeReply, SeqID: 3}).Bytes(ProtocolIDKitexProtobuf)
+	assert(t, err == nil, err)
+	msg, body, err := DecodeKitexProtobufPayload(append(envelope, testProtoMessage()...), nil)
+	assert(t, err == nil, err)
+	assert(t, msg.Name == "echo" && msg.SeqID == 3, msg)
+	assert(t, len(body.Fields) == 8, body)
+
+	_, _, err = DecodeKitexProtobufPayload(testThriftMessage(1), nil)
+	assert(t, err == ErrInvalidThriftMagic, err)
+}
+
+func TestProtoMessage_MarshalJSON(t *testing.T) {
+	m, err := DecodeProtoMessage(testProtoMessage())
+	assert(t, err == nil, err)
+	buf, err := json.Marshal(m)
+	assert(t, err == nil, err)
+	expected := `[` +
+		`{"number":1,"value":150,"wireType":"varint"},` +
+		`{"number":2,"value":"hello","wireType":"bytes"},` +
+		`{"number":3,"value":[{"number":1,"value":1,"wireType":"varint"}],"wireType":"bytes"},` +
+		`{"number":4,"value":1069547520,"wireType":"fixed32"},` +
+		`{"number":5,"value":4612811918334230528,"wireType":"fixed64"},` +
+		`{"number":6,"value":{"base64":"AQID"},"wireType":"bytes"},` +
+		`{"number":7,"value":1,"wireType":"varint"},` +
+		`{"number":8,"value":[{"number":1,"value":1,"wireType":"varint"}],"wireType":"group"}` +
+		`]`
+	assert(t, string(buf) == expected, string(buf))
+}
+
+func Test_isPrintable(t *testing.T) {
+	assert(t, isPrintable([]byte("hello, 世界\n")))
+	assert(t, !isPrintable([]byte("\x01")))
+	assert(t, !isPrintable([]byte("\xff")))
+}
@@ -0,0 +1,119 @@
+package ttheader
+
+import (
+	"errors"
+	"math"
+)
+
+// a minimal implementation of the protobuf wire format:
+// Field: tag(varint, field_number << 3 | wire_type) + value
+// - varint(0):  varint
+// - fixed64(1): 8 bytes little endian
+// - bytes(2):   varint length + value
+// - group(3/4): deprecated, start_group + fields + end_group
+// - fixed32(5): 4 bytes little endian
+
+const (
+	protoWireVarint     = 0
+	protoWireFixed64    = 1
+	protoWireBytes      = 2
+	protoWireStartGroup = 3
+	protoWireEndGroup   = 4
+	protoWireFixed32    = 5
+
+	protoMaxFieldNumber = 1<<29 - 1
+
+	// maxProtoDepth limits the nesting level of groups and messages, to avoid stack overflow
+	maxProtoDepth = 64
+)
+
+var (
+	ErrInvalidProtobufTag      = errors.New("invalid protobuf tag")
+	ErrInvalidProtobufWireType = errors.New("invalid protobuf wire type")
+	ErrInvalidProtobufLength   = errors.New("invalid protobuf length")
+	ErrProtobufDepthExceeded   = errors.New("max protobuf depth exceeded")
+)
+
+func appendProtoTag(buf []byte, num int, wireType byte) []byte {
+	return appendUvarint(buf, uint64(num)<<3|uint64(wireType))
+}
+
+func appendProtoVarintField(buf []byte, num int, v uint64) []byte {
+	return appendUvarint(appendProtoTag(buf, num, protoWireVarint), v)
+}
+
+func appendProtoStringField(buf []byte, num int, s string) []byte {
+	buf = appendUvarint(appendProtoTag(buf, num, protoWireBytes), uint64(len(s)))
+	return append(buf, s...)
+}
+
+func readProtoTag(reader *bytesReader) (num int, wireType byte, err error) {
+	tag, err := reader.ReadUvarint()
+	if err != nil {
+		return 0, 0, err
+	}
+	num, wireType = int(tag>>3), byte(tag&0x7)
+	if num <= 0 || num > protoMaxFieldNumber {
+		return 0, 0, ErrInvalidProtobufTag
+	}
+	return num, wireType, nil
+}
+
+func readProtoLength(reader *bytesReader) (int, error) {
+	size, err := reader.ReadUvarint()
+	if err != nil {
+		return 0, err
+	}
+	if size > math.MaxInt32 {
+		return 0, ErrInvalidProtobufLength
+	}
+	return int(size), nil
+}
+
+func readProtoString(reader *bytesReader) (string, error) {
+	size, err := readProtoLength(reader)
+	if err != nil {
+		return "", err
+	}
+	return reader.ReadString(size)
+}
+
+// skipProtoValue skips the value of a field with the given number and wire type
+func skipProtoValue(reader *bytesReader, num int, wireType byte, depth int) error {
+	if depth > maxProtoDepth {
+		return ErrProtobufDepthExceeded
+	}
+	switch wireType {
+	case protoWireVarint:
+		_, err := reader.ReadUvarint()
+		return err
+	case protoWireFixed64:
+		return reader.Skip(8)
+	case protoWireFixed32:
+		return reader.Skip(4)
+	case protoWireBytes:
+		size, err := readProtoLength(reader)
+		if err != nil {
+			return err
+		}
+		return reader.Skip(size)
+	case protoWireStartGroup:
+		for {
+			fieldNum, fieldWireType, err := readProtoTag(reader)
+			if err != nil {
+				return err
+			}
+			if fieldWireType == protoWireEndGroup {
+				if fieldNum != num {
+					return ErrInvalidProtobufTag
+				}
+				return nil
+			}
+			if err = skipProtoValue(reader, fieldNum, fieldWireType, depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		return ErrInvalidProtobufWireType
+	}
+}
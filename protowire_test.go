@@ -0,0 +1,74 @@
+package ttheader
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+func Test_appendProtoFields(t *testing.T) {
+	buf := appendProtoVarintField(nil, 1, 150)
+	buf = appendProtoStringField(buf, 2, "testing")
+	expected := []byte{0x08, 0x96, 0x01, 0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g'}
+	assert(t, reflect.DeepEqual(buf, expected), buf)
+}
+
+func Test_readProtoTag(t *testing.T) {
+	t.Run("normal", func(t *testing.T) {
+		num, wireType, err := readProtoTag(newBytesReader(appendProtoTag(nil, 1000, protoWireBytes)))
+		assert(t, err == nil, err)
+		assert(t, num == 1000 && wireType == protoWireBytes, num, wireType)
+	})
+	t.Run("zero-field-number", func(t *testing.T) {
+		_, _, err := readProtoTag(newBytesReader([]byte{0x02}))
+		assert(t, err == ErrInvalidProtobufTag, err)
+	})
+	t.Run("eof", func(t *testing.T) {
+		_, _, err := readProtoTag(newBytesReader(nil))
+		assert(t, err == io.EOF, err)
+	})
+}
+
+func Test_skipProtoValue(t *testing.T) {
+	t.Run("all-wire-types", func(t *testing.T) {
+		var buf []byte
+		buf = appendProtoVarintField(buf, 1, 1<<63)
+		buf = append(appendProtoTag(buf, 2, protoWireFixed64), 1, 2, 3, 4, 5, 6, 7, 8)
+		buf = append(appendProtoTag(buf, 3, protoWireFixed32), 1, 2, 3, 4)
+		buf = appendProtoStringField(buf, 4, "bytes")
+		buf = appendProtoTag(buf, 5, protoWireStartGroup)
+		buf = appendProtoVarintField(buf, 1, 1)
+		buf = appendProtoTag(buf, 5, protoWireEndGroup)
+		reader := newBytesReader(buf)
+		for {
+			num, wireType, err := readProtoTag(reader)
+			if err == io.EOF {
+				break
+			}
+			assert(t, err == nil, err)
+			err = skipProtoValue(reader, num, wireType, 0)
+			assert(t, err == nil, err)
+		}
+	})
+	t.Run("mismatched-end-group", func(t *testing.T) {
+		buf := appendProtoTag(nil, 6, protoWireEndGroup)
+		err := skipProtoValue(newBytesReader(buf), 5, protoWireStartGroup, 0)
+		assert(t, err == ErrInvalidProtobufTag, err)
+	})
+	t.Run("invalid-wire-type", func(t *testing.T) {
+		err := skipProtoValue(newBytesReader(nil), 1, 6, 0)
+		assert(t, err == ErrInvalidProtobufWireType, err)
+	})
+	t.Run("invalid-length", func(t *testing.T) {
+		err := skipProtoValue(newBytesReader(appendUvarint(nil, 1<<40)), 1, protoWireBytes, 0)
+		assert(t, err == ErrInvalidProtobufLength, err)
+	})
+	t.Run("depth-exceeded", func(t *testing.T) {
+		var buf []byte
+		for i := 0; i <= maxProtoDepth; i++ {
+			buf = appendProtoTag(buf, 1, protoWireStartGroup)
+		}
+		err := skipProtoValue(newBytesReader(buf), 1, protoWireStartGroup, 0)
+		assert(t, err == ErrProtobufDepthExceeded, err)
+	})
+}
@@ -0,0 +1,96 @@
+package ttheader
+
+// ResponseOption customizes the response header built by NewResponseFrame
+type ResponseOption func(req, resp *Header)
+
+var (
+	// swappedIntKeys are the From*/To* key pairs: the response is sent from the request's callee to its caller
+	swappedIntKeys = [][2]uint16{
+		{IntKeyFromService, IntKeyToService},
+		{IntKeyFromCluster, IntKeyToCluster},
+		{IntKeyFromIDC, IntKeyToIDC},
+		{IntKeyFromMethod, IntKeyToMethod},
+	}
+
+	// propagatedIntKeys are copied from the request for tracing and logging
+	propagatedIntKeys = []uint16{IntKeyLogID, IntKeySpanContext, IntKeyStressTag}
+)
+
+// WithIntKey sets the key in the response intInfo
+func WithIntKey(key uint16, value string) ResponseOption {
+	return func(req, resp *Header) {
+		resp.SetIntKey(key, value)
+	}
+}
+
+// WithStrKey sets the key in the response strInfo
+func WithStrKey(key, value string) ResponseOption {
+	return func(req, resp *Header) {
+		resp.SetStrKey(key, value)
+	}
+}
+
+// WithPropagatedIntKeys copies the keys (if exist) from the request intInfo to the response intInfo
+func WithPropagatedIntKeys(keys ...uint16) ResponseOption {
+	return func(req, resp *Header) {
+		for _, key := range keys {
+			if value, ok := req.GetIntKey(key); ok {
+				resp.SetIntKey(key, value)
+			}
+		}
+	}
+}
+
+// WithPropagatedStrKeys copies the keys (if exist) from the request strInfo to the response strInfo
+func WithPropagatedStrKeys(keys ...string) ResponseOption {
+	return func(req, resp *Header) {
+		for _, key := range keys {
+			if value, ok := req.GetStrKey(key); ok {
+				resp.SetStrKey(key, value)
+			}
+		}
+	}
+}
+
+// NewResponseFrame creates a response frame for the request, with the given payload
+// The response header mirrors the request: SeqID, ProtocolID and flags are copied, From*/To* keys are swapped,
+// and LogID/SpanContext/StressTag are propagated; other keys can be set or propagated by opts.
+// Note: the ACL token is not copied.
+func NewResponseFrame(req *Frame, payload []byte, opts ...ResponseOption) *Frame {
+	reqHeader := req.Header()
+	h := NewHeader()
+	h.SetSeqID(reqHeader.SeqID())
+	h.SetProtocolID(reqHeader.ProtocolID())
+	h.SetFlags(reqHeader.Flags())
+	for _, pair := range swappedIntKeys {
+		if value, ok := reqHeader.GetIntKey(pair[0]); ok {
+			h.SetIntKey(pair[1], value)
+		}
+		if value, ok := reqHeader.GetIntKey(pair[1]); ok {
+			h.SetIntKey(pair[0], value)
+		}
+	}
+	WithPropagatedIntKeys(propagatedIntKeys...)(reqHeader, h)
+	for _, opt := range opts {
+		opt(reqHeader, h)
+	}
+	return NewFrame(h, payload)
+}
+
+// NewExceptionFrame creates an exception response frame for the request
+// The exception is encoded in the request's protocol, with its SeqID set to the request's.
+// For streaming requests, the frame is marked as a trailer, which ends the stream; for others
+// the frame type is left unset, which is treated as a trailer (see FrameType), like old TTHeader peers do.
+func NewExceptionFrame(req *Frame, exc *Exception) (*Frame, error) {
+	e := *exc // avoid modifying the input
+	e.SeqID = req.Header().SeqID()
+	payload, err := e.encode(req.Header().ProtocolID())
+	if err != nil {
+		return nil, err
+	}
+	f := NewResponseFrame(req, payload)
+	if f.Header().IsStreaming() {
+		f.Header().SetIntKey(IntKeyFrameType, FrameTypeTrailer)
+	}
+	return f, nil
+}
@@ -0,0 +1,112 @@
+package ttheader
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestNewResponseFrame(t *testing.T) {
+	t.Run("mirror", func(t *testing.T) {
+		reqHeader := NewHeaderWithInfo(map[uint16]string{
+			IntKeyFromService: "client",
+			IntKeyFromMethod:  "caller",
+			IntKeyToService:   "server",
+			IntKeyToCluster:   "cluster",
+			IntKeyToMethod:    "method",
+			IntKeyLogID:       "log-id",
+			IntKeySpanContext: "span",
+			IntKeyEnv:         "env",
+		}, map[string]string{"key": "value"})
+		reqHeader.SetSeqID(100)
+		reqHeader.SetProtocolID(ProtocolIDThriftCompact)
+		reqHeader.SetIsStreaming()
+		reqHeader.SetToken("token")
+		req := NewFrame(reqHeader, []byte{1})
+
+		resp := NewResponseFrame(req, []byte{2})
+		h := resp.Header()
+		assert(t, h.SeqID() == 100, h.SeqID())
+		assert(t, h.ProtocolID() == ProtocolIDThriftCompact, h.ProtocolID())
+		assert(t, h.IsStreaming())
+		assert(t, h.Token() == "", h.Token())
+		assert(t, len(h.StrInfo()) == 0, h.StrInfo())
+		assert(t, bytes.Equal(resp.Payload(), []byte{2}), resp.Payload())
+		assert(t, reflect.DeepEqual(h.IntInfo(), map[uint16]string{
+			IntKeyFromService: "server",
+			IntKeyFromCluster: "cluster",
+			IntKeyFromMethod:  "method",
+			IntKeyToService:   "client",
+			IntKeyToMethod:    "caller",
+			IntKeyLogID:       "log-id",
+			IntKeySpanContext: "span",
+		}), h.IntInfo())
+	})
+	t.Run("options", func(t *testing.T) {
+		reqHeader := NewHeaderWithInfo(
+			map[uint16]string{IntKeyEnv: "env"},
+			map[string]string{"a": "1", "b": "2"},
+		)
+		req := NewFrame(reqHeader, nil)
+
+		resp := NewResponseFrame(req, nil,
+			WithIntKey(IntKeyMsgType, "2"),
+			WithStrKey("c", "3"),
+			WithPropagatedIntKeys(IntKeyEnv, IntKeyDDPTag),
+			WithPropagatedStrKeys("a", "d"),
+		)
+		h := resp.Header()
+		assert(t, reflect.DeepEqual(h.IntInfo(), map[uint16]string{IntKeyMsgType: "2", IntKeyEnv: "env"}), h.IntInfo())
+		assert(t, reflect.DeepEqual(h.StrInfo(), map[string]string{"a": "1", "c": "3"}), h.StrInfo())
+	})
+	t.Run("round-trip", func(t *testing.T) {
+		reqHeader := NewHeaderWithInfo(map[uint16]string{IntKeyToService: "server"}, nil)
+		reqHeader.SetSeqID(1)
+		resp := NewResponseFrame(NewFrame(reqHeader, nil), []byte{1, 2, 3})
+		buf, err := resp.Bytes()
+		assert(t, err == nil, err)
+		f, err := ReadFrame(bytes.NewReader(buf))
+		assert(t, err == nil, err)
+		assert(t, f.Header().SeqID() == 1, f.Header().SeqID())
+		value, _ := f.Header().GetIntKey(IntKeyFromService)
+		assert(t, value == "server", value)
+	})
+}
+
+func TestNewExceptionFrame(t *testing.T) {
+	t.Run("binary", func(t *testing.T) {
+		reqHeader := NewHeaderWithInfo(map[uint16]string{IntKeyToService: "server"}, nil)
+		reqHeader.SetSeqID(100)
+		req := NewFrame(reqHeader, nil)
+		exc := NewException("method", 0, "message", 1)
+
+		f, err := NewExceptionFrame(req, exc)
+		assert(t, err == nil, err)
+		assert(t, exc.SeqID == 0, exc.SeqID) // not modified
+		assert(t, f.Header().SeqID() == 100, f.Header().SeqID())
+		_, ok := f.Header().GetIntKey(IntKeyFrameType)
+		assert(t, !ok)
+		assert(t, FrameType(f.Header().IntInfo()) == FrameTypeTrailer)
+		value, _ := f.Header().GetIntKey(IntKeyFromService)
+		assert(t, value == "server", value)
+
+		decoded, err := f.PayloadAsException()
+		assert(t, err == nil, err)
+		assert(t, reflect.DeepEqual(decoded, NewException("method", 100, "message", 1)), decoded)
+	})
+	t.Run("streaming", func(t *testing.T) {
+		reqHeader := NewHeader()
+		reqHeader.SetIsStreaming()
+		f, err := NewExceptionFrame(NewFrame(reqHeader, nil), NewException("method", 0, "message", 1))
+		assert(t, err == nil, err)
+		assert(t, f.Header().IsStreaming())
+		frameType, _ := f.Header().GetIntKey(IntKeyFrameType)
+		assert(t, frameType == FrameTypeTrailer, frameType)
+	})
+	t.Run("unsupported-protocol", func(t *testing.T) {
+		reqHeader := NewHeader()
+		reqHeader.SetProtocolID(0xff)
+		_, err := NewExceptionFrame(NewFrame(reqHeader, nil), NewException("method", 0, "message", 1))
+		assert(t, err == ErrProtocolNotSupported, err)
+	})
+}
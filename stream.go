@@ -0,0 +1,177 @@
+package ttheader
+
+import (
+	"fmt"
+	"sync"
+)
+
+// StreamState is the state of one direction (send or recv) of a stream
+type StreamState int
+
+const (
+	StreamStateIdle   StreamState = iota // nothing sent/received
+	StreamStateMeta                      // only meta frames sent/received
+	StreamStateHeader                    // header frame sent/received
+	StreamStateData                      // data frames sent/received
+	StreamStateClosed                    // trailer sent/received, i.e. half-closed
+)
+
+func (s StreamState) String() string {
+	switch s {
+	case StreamStateIdle:
+		return "idle"
+	case StreamStateMeta:
+		return "meta"
+	case StreamStateHeader:
+		return "header"
+	case StreamStateData:
+		return "data"
+	case StreamStateClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("state %d", int(s))
+	}
+}
+
+// StreamStateError is the error of an illegal frame for the state of the stream
+type StreamStateError struct {
+	SeqID     int32
+	Direction string // "send" or "recv"
+	State     StreamState
+	Frame     FrameKind
+	Message   string
+}
+
+func (e *StreamStateError) Error() string {
+	return fmt.Sprintf("stream %d: %s %s frame in state %s: %s", e.SeqID, e.Direction, e.Frame, e.State, e.Message)
+}
+
+// Stream tracks the states of a ttheader stream as frames are sent and received, rejecting illegal frames:
+//   - meta frames are allowed anytime before the trailer;
+//   - the header frame must be the first non-meta frame, and only once;
+//   - data frames must follow the header frame;
+//   - the trailer frame ends the direction (it can be the only frame, e.g. rejecting a stream by an exception),
+//     and no more frames are allowed after it, except cancel frames and window updates
+//     (see NewCancelFrame and NewWindowUpdateFrame).
+//
+// Note: a Stream can be used concurrently; states are not changed by rejected frames.
+type Stream struct {
+	seqID int32
+
+	lock      sync.Mutex
+	sendState StreamState
+	recvState StreamState
+}
+
+// NewStream returns a new Stream with the seqID, with both directions idle
+func NewStream(seqID int32) *Stream {
+	return &Stream{seqID: seqID}
+}
+
+// SeqID returns the seqID of the stream
+func (s *Stream) SeqID() int32 {
+	return s.seqID
+}
+
+// SendState returns the state of the send direction
+func (s *Stream) SendState() StreamState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.sendState
+}
+
+// RecvState returns the state of the recv direction
+func (s *Stream) RecvState() StreamState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.recvState
+}
+
+// Closed returns whether trailers have been both sent and received
+func (s *Stream) Closed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.sendState == StreamStateClosed && s.recvState == StreamStateClosed
+}
+
+// OnSend validates the frame to send and updates the send state; returns *StreamStateError if illegal
+func (s *Stream) OnSend(f *Frame) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.transit(&s.sendState, "send", f)
+}
+
+// onSend is OnSend returning the send states before and after the transition, for revertSend
+func (s *Stream) onSend(f *Frame) (prev, next StreamState, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	prev = s.sendState
+	err = s.transit(&s.sendState, "send", f)
+	return prev, s.sendState, err
+}
+
+// revertSend restores the send state to prev if it's still next, i.e. for a frame which failed to be written
+func (s *Stream) revertSend(prev, next StreamState) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.sendState == next {
+		s.sendState = prev
+	}
+}
+
+// OnRecv validates the received frame and updates the recv state; returns *StreamStateError if illegal
+func (s *Stream) OnRecv(f *Frame) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.transit(&s.recvState, "recv", f)
+}
+
+func (s *Stream) transit(state *StreamState, direction string, f *Frame) error {
+	kind := f.Type()
+	fail := func(format string, args ...interface{}) error {
+		return &StreamStateError{
+			SeqID:     s.seqID,
+			Direction: direction,
+			State:     *state,
+			Frame:     kind,
+			Message:   fmt.Sprintf(format, args...),
+		}
+	}
+	h := f.Header()
+	if h == nil || !h.IsStreaming() {
+		return fail("not a streaming frame")
+	}
+	if h.SeqID() != s.seqID {
+		return fail("unexpected seqID %d", h.SeqID())
+	}
+	if *state == StreamStateClosed {
+		if f.IsCancel() { // the stream can be canceled even after the direction is closed
+			return nil
+		}
+		if _, ok := f.WindowUpdate(); ok { // the peer may be still sending
+			return nil
+		}
+		return fail("after trailer")
+	}
+	switch kind {
+	case FrameKindMeta:
+		if *state == StreamStateIdle {
+			*state = StreamStateMeta
+		}
+	case FrameKindHeader:
+		if *state != StreamStateIdle && *state != StreamStateMeta {
+			return fail("duplicate header")
+		}
+		*state = StreamStateHeader
+	case FrameKindData:
+		if *state != StreamStateHeader && *state != StreamStateData {
+			return fail("before header")
+		}
+		*state = StreamStateData
+	case FrameKindTrailer:
+		*state = StreamStateClosed
+	default:
+		return fail("unknown frame type")
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package ttheader
+
+// FrameKind is the type of frames in ttheader streaming, i.e. the value of IntKeyFrameType
+type FrameKind int
+
+const (
+	FrameKindUnknown FrameKind = iota
+	FrameKindMeta
+	FrameKindHeader
+	FrameKindData
+	FrameKindTrailer
+)
+
+var frameKinds = map[string]FrameKind{
+	FrameTypeMeta:    FrameKindMeta,
+	FrameTypeHeader:  FrameKindHeader,
+	FrameTypeData:    FrameKindData,
+	FrameTypeTrailer: FrameKindTrailer,
+}
+
+func (k FrameKind) String() string {
+	switch k {
+	case FrameKindMeta:
+		return "meta"
+	case FrameKindHeader:
+		return "header"
+	case FrameKindData:
+		return "data"
+	case FrameKindTrailer:
+		return "trailer"
+	default:
+		return "unknown"
+	}
+}
+
+// Type returns the type of the frame by IntKeyFrameType
+// Note: frames without IntKeyFrameType are treated as trailers, as FrameType does;
+// and unrecognized values are FrameKindUnknown.
+func (f *Frame) Type() FrameKind {
+	var intInfo map[uint16]string
+	if f.header != nil {
+		intInfo = f.header.IntInfo()
+	}
+	return frameKinds[FrameType(intInfo)]
+}
+
+// NewMetaFrame creates a streaming meta frame, which carries control information (by strInfo) of the stream
+func NewMetaFrame(seqID int32, strInfo map[string]string, payload []byte) *Frame {
+	return newStreamFrame(seqID, FrameTypeMeta, nil, strInfo, payload)
+}
+
+// NewHeaderFrame creates a streaming header frame, which starts the stream (from the client) or
+// carries the response header (from the server)
+func NewHeaderFrame(seqID int32, intInfo map[uint16]string, strInfo map[string]string) *Frame {
+	return newStreamFrame(seqID, FrameTypeHeader, intInfo, strInfo, nil)
+}
+
+// NewDataFrame creates a streaming data frame, which carries a message in the payload
+func NewDataFrame(seqID int32, payload []byte) *Frame {
+	return newStreamFrame(seqID, FrameTypeData, nil, nil, payload)
+}
+
+// NewTrailerFrame creates a streaming trailer frame, which ends the stream in its direction;
+// the payload can be an encoded exception, and is empty for normal ends
+func NewTrailerFrame(seqID int32, strInfo map[string]string, payload []byte) *Frame {
+	return newStreamFrame(seqID, FrameTypeTrailer, nil, strInfo, payload)
+}
+
+// newStreamFrame creates a frame with the streaming flag and frame type set
+// Note: info maps are copied, so that callers can reuse them.
+func newStreamFrame(seqID int32, frameType string, intInfo map[uint16]string, strInfo map[string]string, payload []byte) *Frame {
+	h := NewHeader()
+	h.SetSeqID(seqID)
+	h.SetIsStreaming()
+	for key, value := range intInfo {
+		h.SetIntKey(key, value)
+	}
+	for key, value := range strInfo {
+		h.SetStrKey(key, value)
+	}
+	h.SetIntKey(IntKeyFrameType, frameType)
+	return NewFrame(h, payload)
+}
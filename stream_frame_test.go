@@ -0,0 +1,60 @@
+package ttheader
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFrameKind_String(t *testing.T) {
+	assert(t, FrameKindMeta.String() == "meta")
+	assert(t, FrameKindTrailer.String() == "trailer")
+	assert(t, FrameKind(100).String() == "unknown")
+}
+
+func TestFrame_Type(t *testing.T) {
+	assert(t, NewFrame(nil, nil).Type() == FrameKindTrailer, "compatible with old frames")
+	assert(t, NewFrame(NewHeader(), nil).Type() == FrameKindTrailer, "compatible with old frames")
+	h := NewHeader()
+	h.SetIntKey(IntKeyFrameType, "x")
+	assert(t, NewFrame(h, nil).Type() == FrameKindUnknown)
+}
+
+func TestNewStreamFrames(t *testing.T) {
+	cases := []struct {
+		frame *Frame
+		kind  FrameKind
+	}{
+		{NewMetaFrame(1, map[string]string{"k": "v"}, []byte("meta")), FrameKindMeta},
+		{NewHeaderFrame(1, map[uint16]string{IntKeyToMethod: "echo"}, map[string]string{"k": "v"}), FrameKindHeader},
+		{NewDataFrame(1, []byte("data")), FrameKindData},
+		{NewTrailerFrame(1, map[string]string{"k": "v"}, nil), FrameKindTrailer},
+	}
+	for _, c := range cases {
+		t.Run(c.kind.String(), func(t *testing.T) {
+			h := c.frame.Header()
+			assert(t, h.IsStreaming() && h.SeqID() == 1, h)
+			assert(t, c.frame.Type() == c.kind, c.frame.Type())
+
+			// survives encoding
+			buf, err := c.frame.Bytes()
+			assert(t, err == nil, err)
+			f, err := ReadFrame(bytes.NewReader(buf))
+			assert(t, err == nil, err)
+			assert(t, f.Type() == c.kind && f.Header().IsStreaming(), f.Type())
+			assert(t, bytes.Equal(f.Payload(), c.frame.Payload()), f.Payload())
+		})
+	}
+
+	t.Run("info", func(t *testing.T) {
+		intInfo := map[uint16]string{IntKeyToMethod: "echo", IntKeyFrameType: FrameTypeData}
+		strInfo := map[string]string{"k": "v"}
+		f := NewHeaderFrame(2, intInfo, strInfo)
+		method, _ := f.Header().GetIntKey(IntKeyToMethod)
+		value, _ := f.Header().GetStrKey("k")
+		assert(t, method == "echo" && value == "v", f.Header())
+		assert(t, f.Type() == FrameKindHeader, "frame type is always set")
+		assert(t, intInfo[IntKeyFrameType] == FrameTypeData, "input is not modified")
+		f.Header().SetStrKey("x", "y")
+		assert(t, len(strInfo) == 1, "input is copied")
+	})
+}
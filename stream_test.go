@@ -0,0 +1,115 @@
+package ttheader
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStreamState_String(t *testing.T) {
+	assert(t, StreamStateData.String() == "data")
+	assert(t, StreamState(100).String() == "state 100")
+}
+
+func TestStreamStateError_Error(t *testing.T) {
+	err := &StreamStateError{SeqID: 1, Direction: "send", State: StreamStateIdle, Frame: FrameKindData, Message: "before header"}
+	assert(t, err.Error() == "stream 1: send data frame in state idle: before header", err.Error())
+}
+
+func TestStream(t *testing.T) {
+	t.Run("normal", func(t *testing.T) {
+		s := NewStream(1)
+		assert(t, s.SeqID() == 1)
+		for _, f := range []*Frame{
+			NewMetaFrame(1, nil, nil),
+			NewHeaderFrame(1, nil, nil),
+			NewDataFrame(1, []byte("a")),
+			NewMetaFrame(1, nil, nil),
+			NewDataFrame(1, []byte("b")),
+		} {
+			assert(t, s.OnSend(f) == nil, f.Type())
+		}
+		assert(t, s.SendState() == StreamStateData, s.SendState())
+		assert(t, s.RecvState() == StreamStateIdle, s.RecvState())
+
+		assert(t, s.OnSend(NewTrailerFrame(1, nil, nil)) == nil)
+		assert(t, s.SendState() == StreamStateClosed && !s.Closed(), "half-closed")
+		assert(t, s.OnRecv(NewHeaderFrame(1, nil, nil)) == nil)
+		assert(t, s.OnRecv(NewDataFrame(1, nil)) == nil)
+		assert(t, s.OnRecv(NewTrailerFrame(1, nil, nil)) == nil)
+		assert(t, s.Closed())
+	})
+	t.Run("trailer-only", func(t *testing.T) {
+		s := NewStream(1)
+		assert(t, s.OnRecv(NewTrailerFrame(1, nil, nil)) == nil)
+		assert(t, s.RecvState() == StreamStateClosed)
+	})
+	t.Run("meta-only", func(t *testing.T) {
+		s := NewStream(1)
+		assert(t, s.OnRecv(NewMetaFrame(1, nil, nil)) == nil)
+		assert(t, s.RecvState() == StreamStateMeta)
+	})
+
+	illegal := []struct {
+		name    string
+		frames  []*Frame
+		state   StreamState
+		message string
+	}{
+		{"data-before-header", []*Frame{NewDataFrame(1, nil)}, StreamStateIdle, "before header"},
+		{"data-after-meta", []*Frame{NewMetaFrame(1, nil, nil), NewDataFrame(1, nil)}, StreamStateMeta, "before header"},
+		{"duplicate-header", []*Frame{NewHeaderFrame(1, nil, nil), NewHeaderFrame(1, nil, nil)}, StreamStateHeader, "duplicate header"},
+		{"header-after-data", []*Frame{NewHeaderFrame(1, nil, nil), NewDataFrame(1, nil), NewHeaderFrame(1, nil, nil)}, StreamStateData, "duplicate header"},
+		{"after-trailer", []*Frame{NewTrailerFrame(1, nil, nil), NewMetaFrame(1, nil, nil)}, StreamStateClosed, "after trailer"},
+		{"seqID", []*Frame{NewHeaderFrame(2, nil, nil)}, StreamStateIdle, "unexpected seqID 2"},
+		{"not-streaming", []*Frame{NewFrame(NewHeader(), nil)}, StreamStateIdle, "not a streaming frame"},
+	}
+	for _, c := range illegal {
+		t.Run(c.name, func(t *testing.T) {
+			s := NewStream(1)
+			var err error
+			for _, f := range c.frames {
+				if err = s.OnRecv(f); err != nil {
+					break
+				}
+			}
+			var stateErr *StreamStateError
+			assert(t, errors.As(err, &stateErr), err)
+			assert(t, stateErr.Direction == "recv" && stateErr.State == c.state && stateErr.Message == c.message, stateErr)
+			assert(t, s.RecvState() == c.state, "state is not changed", s.RecvState())
+			assert(t, s.SendState() == StreamStateIdle, s.SendState())
+		})
+	}
+
+	t.Run("unknown-type", func(t *testing.T) {
+		f := NewDataFrame(1, nil)
+		f.Header().SetIntKey(IntKeyFrameType, "x")
+		err := NewStream(1).OnSend(f)
+		var stateErr *StreamStateError
+		assert(t, errors.As(err, &stateErr) && stateErr.Frame == FrameKindUnknown, err)
+	})
+}
+
+func TestStream_Cancel(t *testing.T) {
+	s := NewStream(1)
+	assert(t, s.OnSend(NewHeaderFrame(1, nil, nil)) == nil)
+	assert(t, s.OnSend(NewCancelFrame(1, "")) == nil)
+	assert(t, s.SendState() == StreamStateClosed)
+	assert(t, s.OnSend(NewCancelFrame(1, "")) == nil, "after trailer")
+	assert(t, s.OnSend(NewTrailerFrame(1, nil, nil)) != nil)
+}
+
+func TestStream_revertSend(t *testing.T) {
+	s := NewStream(1)
+	prev, next, err := s.onSend(NewHeaderFrame(1, nil, nil))
+	assert(t, err == nil && prev == StreamStateIdle && next == StreamStateHeader, prev, next, err)
+	s.revertSend(prev, next)
+	assert(t, s.SendState() == StreamStateIdle, s.SendState())
+
+	_, _, err = s.onSend(NewHeaderFrame(1, nil, nil))
+	assert(t, err == nil, err)
+	prev, next, err = s.onSend(NewDataFrame(1, nil))
+	assert(t, err == nil, err)
+	assert(t, s.OnSend(NewTrailerFrame(1, nil, nil)) == nil)
+	s.revertSend(prev, next)
+	assert(t, s.SendState() == StreamStateClosed, "changed by later frames", s.SendState())
+}
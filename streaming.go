@@ -0,0 +1,374 @@
+package ttheader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var ErrStreamHeaderSent = errors.New("stream header already sent")
+
+// StreamClient starts streams (client-streaming, server-streaming or bidi) over a client Mux
+type StreamClient struct {
+	mux        *Mux
+	protocolID uint8
+}
+
+// NewStreamClient returns a StreamClient over the Mux
+// The protocolID is set in header frames, which tells the server how to encode exceptions in trailers.
+func NewStreamClient(mux *Mux, protocolID uint8) *StreamClient {
+	return &StreamClient{mux: mux, protocolID: protocolID}
+}
+
+// NewStream starts a stream of the method, sending the header frame with the given strInfo
+// The stream is canceled if ctx is done before the stream ends.
+func (c *StreamClient) NewStream(ctx context.Context, method string, header map[string]string) (*ClientStream, error) {
+	ms, err := c.mux.OpenStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f := NewHeaderFrame(ms.SeqID(), map[uint16]string{IntKeyToMethod: method}, header)
+	f.Header().SetProtocolID(c.protocolID)
+	if err = ms.WriteFrame(f); err != nil {
+		_ = ms.Cancel()
+		return nil, err
+	}
+	return &ClientStream{streamBase: streamBase{ms: ms}}, nil
+}
+
+// streamBase implements the receiving part of both sides
+type streamBase struct {
+	ms *MuxStream
+
+	recvMu sync.Mutex // serializes reading frames
+
+	mu             sync.Mutex
+	header         map[string]string // of the peer, only for clients
+	headerReceived bool
+	trailer        map[string]string // of the peer
+	recvErr        error             // sticky error after the trailer is received or the stream fails
+}
+
+// next reads frames until a data frame, the header frame (if untilHeader), or the end of the stream
+func (s *streamBase) next(ctx context.Context, untilHeader bool) ([]byte, error) {
+	for {
+		s.mu.Lock()
+		err := s.recvErr
+		s.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		f, err := s.ms.ReadFrame(ctx)
+		if err != nil {
+			if ctx.Err() == nil || err != ctx.Err() { // not sticky for errors of ctx
+				s.setRecvErr(err)
+			}
+			return nil, err
+		}
+		switch f.Type() {
+		case FrameKindHeader:
+			s.mu.Lock()
+			s.header, s.headerReceived = f.Header().StrInfo(), true
+			s.mu.Unlock()
+			if untilHeader {
+				return nil, nil
+			}
+		case FrameKindData:
+			// data frames never precede the header frame (see Stream), so it's not read by Header
+			return f.Payload(), nil
+		case FrameKindTrailer:
+			err = f.TrailerErr()
+			if err == nil {
+				err = io.EOF
+			}
+			s.mu.Lock()
+			s.trailer = f.Header().StrInfo()
+			s.mu.Unlock()
+			s.setRecvErr(err)
+			return nil, err
+		}
+	}
+}
+
+func (s *streamBase) setRecvErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.recvErr == nil {
+		s.recvErr = err
+	}
+}
+
+// Recv returns the payload of the next data frame
+// It returns io.EOF if the client has closed the sending direction (see ClientStream.CloseSend),
+// or the error failing the stream, e.g. an *Exception of ExceptionTypeCanceled if the stream is canceled.
+func (s *streamBase) Recv(ctx context.Context) ([]byte, error) {
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	return s.next(ctx, false)
+}
+
+// Trailer returns the strInfo of the trailer frame from the peer, which is available after Recv returns an error
+func (s *streamBase) Trailer() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.trailer
+}
+
+func (s *streamBase) send(ctx context.Context, payload []byte) error {
+	return s.ms.writeFrame(ctx, NewDataFrame(s.ms.SeqID(), payload))
+}
+
+// ClientStream is the client side of a stream
+type ClientStream struct {
+	streamBase
+}
+
+// Context returns the context of the stream, which is canceled when the stream ends, see MuxStream.Context
+func (s *ClientStream) Context() context.Context {
+	return s.ms.Context()
+}
+
+// Header waits for the header frame from the server and returns its strInfo
+// It returns nil without an error if the server ends the stream by only a trailer frame with an OK status.
+func (s *ClientStream) Header(ctx context.Context) (map[string]string, error) {
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	for {
+		s.mu.Lock()
+		header, received, err := s.header, s.headerReceived, s.recvErr
+		s.mu.Unlock()
+		if received {
+			return header, nil
+		}
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err = s.next(ctx, true); err != nil {
+			s.closeIfEnded()
+			if err != io.EOF {
+				return nil, err
+			}
+		}
+	}
+}
+
+// Recv returns the payload of the next data frame
+// It returns io.EOF if the server ends the stream normally, or the error in the trailer (see Frame.TrailerErr),
+// or the error failing the stream, e.g. an *Exception of ExceptionTypeCanceled if the stream is canceled.
+func (s *ClientStream) Recv(ctx context.Context) ([]byte, error) {
+	payload, err := s.streamBase.Recv(ctx)
+	if err != nil {
+		s.closeIfEnded()
+	}
+	return payload, err
+}
+
+// closeIfEnded closes the sending direction if the server has ended the stream, so that it's released
+func (s *ClientStream) closeIfEnded() {
+	if s.ms.State().RecvState() == StreamStateClosed {
+		_ = s.CloseSend()
+	}
+}
+
+// Send sends the payload in a data frame; it returns io.EOF if the server has ended the stream
+// Note: if flow control is enabled, it blocks until the server has consumed enough data, or ctx is done.
+func (s *ClientStream) Send(ctx context.Context, payload []byte) error {
+	if s.ms.State().RecvState() == StreamStateClosed {
+		return io.EOF
+	}
+	return s.send(ctx, payload)
+}
+
+// CloseSend ends the sending direction by a trailer frame, i.e. half-closes the stream; it's idempotent
+func (s *ClientStream) CloseSend() error {
+	if s.ms.State().SendState() == StreamStateClosed {
+		return nil
+	}
+	return s.ms.WriteFrame(NewTrailerFrame(s.ms.SeqID(), nil, nil))
+}
+
+// StreamHandler handles a stream on the server side
+// The returned error is sent to the client in the trailer frame, see NewErrorTrailerFrame.
+type StreamHandler func(s *ServerStream) error
+
+// StreamServer dispatches streams accepted by server Muxes to handlers by the method in IntKeyToMethod
+type StreamServer struct {
+	mu       sync.RWMutex
+	handlers map[string]StreamHandler
+}
+
+// NewStreamServer returns a StreamServer without handlers
+func NewStreamServer() *StreamServer {
+	return &StreamServer{handlers: map[string]StreamHandler{}}
+}
+
+// Register sets the handler of the method, replacing the existing one
+func (srv *StreamServer) Register(method string, handler StreamHandler) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.handlers[method] = handler
+}
+
+// Serve accepts streams from the Mux and handles each in a new goroutine, until ctx is done or the Mux fails
+// Streams of unknown methods are ended by an exception of ExceptionTypeUnknownMethod.
+func (srv *StreamServer) Serve(ctx context.Context, mux *Mux) error {
+	for {
+		ms, err := mux.Accept(ctx)
+		if err != nil {
+			return err
+		}
+		go srv.handle(ms)
+	}
+}
+
+func (srv *StreamServer) handle(ms *MuxStream) {
+	// after the trailer, or if the stream fails before the handler
+	defer ms.release()
+	f, err := ms.ReadFrame(ms.Context()) // accepted by the header frame
+	if err != nil {
+		return
+	}
+	s := &ServerStream{
+		streamBase:    streamBase{ms: ms},
+		protocolID:    f.Header().ProtocolID(),
+		requestHeader: f.Header().StrInfo(),
+	}
+	s.method, _ = f.Header().GetIntKey(IntKeyToMethod)
+
+	srv.mu.RLock()
+	handler := srv.handlers[s.method]
+	srv.mu.RUnlock()
+	if handler == nil {
+		err = NewExceptionWithType(s.method, 0, "unknown method "+s.method, ExceptionTypeUnknownMethod)
+	} else {
+		err = s.run(handler)
+	}
+	s.finish(err)
+}
+
+// ServerStream is the server side of a stream
+type ServerStream struct {
+	streamBase
+	method        string
+	protocolID    uint8
+	requestHeader map[string]string
+
+	sendMu      sync.Mutex
+	sendHeader  map[string]string
+	headerSent  bool
+	sendTrailer map[string]string
+}
+
+// Method returns the method of the stream, i.e. IntKeyToMethod in the header frame from the client
+func (s *ServerStream) Method() string {
+	return s.method
+}
+
+// RequestHeader returns the strInfo of the header frame from the client
+func (s *ServerStream) RequestHeader() map[string]string {
+	return s.requestHeader
+}
+
+// Context returns the context of the stream, which is canceled when the client cancels the stream,
+// the connection fails, or the stream ends; see MuxStream.Context
+func (s *ServerStream) Context() context.Context {
+	return s.ms.Context()
+}
+
+// SetHeader adds the strInfo to the header frame, which is sent by SendHeader, the first Send,
+// or the end of the handler (if it returns nil); returns ErrStreamHeaderSent if it has been sent
+func (s *ServerStream) SetHeader(header map[string]string) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if s.headerSent {
+		return ErrStreamHeaderSent
+	}
+	if s.sendHeader == nil {
+		s.sendHeader = map[string]string{}
+	}
+	for key, value := range header {
+		s.sendHeader[key] = value
+	}
+	return nil
+}
+
+// SendHeader sends the header frame; returns ErrStreamHeaderSent if it has been sent
+func (s *ServerStream) SendHeader() error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if s.headerSent {
+		return ErrStreamHeaderSent
+	}
+	return s.writeHeader()
+}
+
+// writeHeader sends the header frame; the caller should hold sendMu
+func (s *ServerStream) writeHeader() error {
+	s.headerSent = true
+	f := NewHeaderFrame(s.ms.SeqID(), nil, s.sendHeader)
+	f.Header().SetProtocolID(s.protocolID)
+	return s.ms.WriteFrame(f)
+}
+
+// SetTrailer adds the strInfo to the trailer frame, which is sent after the handler returns
+// Note: keys for the status (e.g. StrKeyStatusCode) are overwritten by the returned error of the handler.
+func (s *ServerStream) SetTrailer(trailer map[string]string) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if s.sendTrailer == nil {
+		s.sendTrailer = map[string]string{}
+	}
+	for key, value := range trailer {
+		s.sendTrailer[key] = value
+	}
+}
+
+// Send sends the payload in a data frame, sending the header frame first if necessary
+// Note: if flow control is enabled, it blocks until the client has consumed enough data, or ctx is done.
+func (s *ServerStream) Send(ctx context.Context, payload []byte) error {
+	s.sendMu.Lock()
+	if !s.headerSent {
+		if err := s.writeHeader(); err != nil {
+			s.sendMu.Unlock()
+			return err
+		}
+	}
+	s.sendMu.Unlock()
+	return s.send(ctx, payload)
+}
+
+// run calls the handler, converting a panic to an error
+func (s *ServerStream) run(handler StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = NewExceptionWithType(s.method, 0, fmt.Sprintf("panic: %v", r), ExceptionTypeInternalError)
+		}
+	}()
+	return handler(s)
+}
+
+// finish sends the trailer frame with the error
+func (s *ServerStream) finish(err error) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if err == nil && !s.headerSent {
+		if s.writeHeader() != nil {
+			return
+		}
+	}
+	f, fErr := NewErrorTrailerFrame(s.ms.SeqID(), s.protocolID, err)
+	if fErr != nil { // the protocol is not supported for exceptions
+		f, _ = NewErrorTrailerFrame(s.ms.SeqID(), ProtocolIDThriftBinary, err)
+	}
+	for key, value := range s.sendTrailer {
+		if _, ok := f.Header().GetStrKey(key); !ok {
+			f.Header().SetStrKey(key, value)
+		}
+	}
+	_ = s.ms.WriteFrame(f) // fails if the stream is canceled, i.e. nobody cares
+}
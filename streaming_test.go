@@ -0,0 +1,276 @@
+package ttheader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestStreamPair(t *testing.T, opts ...MuxOption) (*StreamClient, *StreamServer) {
+	c, s := net.Pipe()
+	client, server := NewClientMux(c, opts...), NewServerMux(s, opts...)
+	srv := NewStreamServer()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_ = srv.Serve(ctx, server)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		_ = client.Close()
+		_ = server.Close()
+	})
+	return NewStreamClient(client, ProtocolIDThriftBinary), srv
+}
+
+// recvAll receives payloads until an error, which is returned if not io.EOF
+func recvAll(ctx context.Context, recv func(ctx context.Context) ([]byte, error)) ([]string, error) {
+	var payloads []string
+	for {
+		payload, err := recv(ctx)
+		if err == io.EOF {
+			return payloads, nil
+		}
+		if err != nil {
+			return payloads, err
+		}
+		payloads = append(payloads, string(payload))
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	t.Run("client-streaming", func(t *testing.T) {
+		ctx := testContext(t)
+		client, srv := newTestStreamPair(t)
+		srv.Register("concat", func(s *ServerStream) error {
+			payloads, err := recvAll(s.Context(), s.Recv)
+			if err != nil {
+				return err
+			}
+			s.SetTrailer(map[string]string{"count": strconv.Itoa(len(payloads))})
+			var result string
+			for _, p := range payloads {
+				result += p
+			}
+			return s.Send(s.Context(), []byte(result))
+		})
+
+		s, err := client.NewStream(ctx, "concat", nil)
+		assert(t, err == nil, err)
+		for _, p := range []string{"a", "b", "c"} {
+			assert(t, s.Send(ctx, []byte(p)) == nil)
+		}
+		assert(t, s.CloseSend() == nil)
+		assert(t, s.CloseSend() == nil, "idempotent")
+		payloads, err := recvAll(ctx, s.Recv)
+		assert(t, err == nil, err)
+		assert(t, reflect.DeepEqual(payloads, []string{"abc"}), payloads)
+		assert(t, s.Trailer()["count"] == "3", s.Trailer())
+		_, err = s.Recv(ctx)
+		assert(t, err == io.EOF, "sticky", err)
+		<-s.Context().Done()
+	})
+
+	t.Run("server-streaming", func(t *testing.T) {
+		ctx := testContext(t)
+		client, srv := newTestStreamPair(t)
+		srv.Register("count", func(s *ServerStream) error {
+			payload, err := s.Recv(s.Context())
+			if err != nil {
+				return err
+			}
+			n, _ := strconv.Atoi(string(payload))
+			for i := 0; i < n; i++ {
+				if err = s.Send(s.Context(), []byte(strconv.Itoa(i))); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		s, err := client.NewStream(ctx, "count", nil)
+		assert(t, err == nil, err)
+		assert(t, s.Send(ctx, []byte("3")) == nil)
+		assert(t, s.CloseSend() == nil)
+		payloads, err := recvAll(ctx, s.Recv)
+		assert(t, err == nil, err)
+		assert(t, reflect.DeepEqual(payloads, []string{"0", "1", "2"}), payloads)
+	})
+
+	t.Run("bidi", func(t *testing.T) {
+		ctx := testContext(t)
+		client, srv := newTestStreamPair(t)
+		srv.Register("echo", func(s *ServerStream) error {
+			assert(t, s.Method() == "echo" && s.RequestHeader()["k"] == "v", s.Method(), s.RequestHeader())
+			assert(t, s.SetHeader(map[string]string{"server": "echo"}) == nil)
+			assert(t, s.SendHeader() == nil)
+			assert(t, s.SendHeader() == ErrStreamHeaderSent)
+			assert(t, s.SetHeader(nil) == ErrStreamHeaderSent)
+			for {
+				payload, err := s.Recv(s.Context())
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if err = s.Send(s.Context(), payload); err != nil {
+					return err
+				}
+			}
+		})
+
+		s, err := client.NewStream(ctx, "echo", map[string]string{"k": "v"})
+		assert(t, err == nil, err)
+		header, err := s.Header(ctx)
+		assert(t, err == nil && header["server"] == "echo", header, err)
+		for _, p := range []string{"a", "b"} {
+			assert(t, s.Send(ctx, []byte(p)) == nil)
+			payload, err := s.Recv(ctx)
+			assert(t, err == nil && string(payload) == p, payload, err)
+		}
+		header, err = s.Header(ctx)
+		assert(t, err == nil && header["server"] == "echo", "available after received", header, err)
+		assert(t, s.CloseSend() == nil)
+		_, err = s.Recv(ctx)
+		assert(t, err == io.EOF, err)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		ctx := testContext(t)
+		client, srv := newTestStreamPair(t)
+		srv.Register("biz", func(s *ServerStream) error {
+			return NewBizError(100, "biz", nil)
+		})
+		srv.Register("exception", func(s *ServerStream) error {
+			return NewExceptionWithType("", 0, "bad request", ExceptionTypeProtocolError)
+		})
+		srv.Register("panic", func(s *ServerStream) error {
+			panic("oops")
+		})
+
+		cases := []struct {
+			method string
+			check  func(err error) bool
+		}{
+			{"biz", func(err error) bool { return reflect.DeepEqual(err, NewBizError(100, "biz", nil)) }},
+			{"exception", func(err error) bool {
+				return errors.Is(err, ExceptionTypeProtocolError) && err.Error() == "bad request"
+			}},
+			{"panic", func(err error) bool {
+				return errors.Is(err, ExceptionTypeInternalError) && err.Error() == "panic: oops"
+			}},
+			{"unknown", func(err error) bool { return errors.Is(err, ExceptionTypeUnknownMethod) }},
+		}
+		for _, c := range cases {
+			s, err := client.NewStream(ctx, c.method, nil)
+			assert(t, err == nil, err)
+			header, err := s.Header(ctx)
+			assert(t, header == nil && c.check(err), c.method, "trailer only", err)
+			_, err = s.Recv(ctx)
+			assert(t, c.check(err), c.method, err)
+			assert(t, s.Send(ctx, nil) == io.EOF, "ended by the server")
+		}
+	})
+
+	t.Run("ok-without-data", func(t *testing.T) {
+		ctx := testContext(t)
+		client, srv := newTestStreamPair(t)
+		srv.Register("noop", func(s *ServerStream) error {
+			return s.SetHeader(map[string]string{"k": "v"})
+		})
+		s, err := client.NewStream(ctx, "noop", nil)
+		assert(t, err == nil, err)
+		header, err := s.Header(ctx)
+		assert(t, err == nil && header["k"] == "v", "header is sent at the end", header, err)
+		_, err = s.Recv(ctx)
+		assert(t, err == io.EOF, err)
+		<-s.Context().Done()
+	})
+
+	t.Run("canceled-by-client", func(t *testing.T) {
+		ctx := testContext(t)
+		client, srv := newTestStreamPair(t)
+		started, handlerErr := make(chan struct{}), make(chan error, 1)
+		srv.Register("wait", func(s *ServerStream) error {
+			close(started)
+			<-s.Context().Done()
+			_, err := s.Recv(ctx)
+			handlerErr <- err
+			return err
+		})
+		streamCtx, cancel := context.WithCancel(ctx)
+		s, err := client.NewStream(streamCtx, "wait", nil)
+		assert(t, err == nil, err)
+		<-started
+		cancel()
+		select {
+		case err = <-handlerErr:
+			assert(t, errors.Is(err, ExceptionTypeCanceled), err)
+		case <-ctx.Done():
+			t.Fatal("handler is not canceled")
+		}
+		_, err = s.Recv(ctx)
+		assert(t, errors.Is(err, ExceptionTypeCanceled), err)
+	})
+
+	t.Run("recv-context", func(t *testing.T) {
+		ctx := testContext(t)
+		client, srv := newTestStreamPair(t)
+		srv.Register("wait", func(s *ServerStream) error {
+			_, err := s.Recv(s.Context())
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		})
+		s, err := client.NewStream(ctx, "wait", nil)
+		assert(t, err == nil, err)
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err = s.Recv(timeoutCtx)
+		assert(t, err == context.DeadlineExceeded, err)
+		assert(t, s.CloseSend() == nil)
+		_, err = s.Recv(ctx)
+		assert(t, err == io.EOF, "not sticky for errors of ctx", err)
+	})
+
+	t.Run("send-context", func(t *testing.T) {
+		ctx := testContext(t)
+		client, srv := newTestStreamPair(t, WithMuxFlowControl(10, 0))
+		srv.Register("block", func(s *ServerStream) error {
+			<-s.Context().Done()
+			return nil
+		})
+		s, err := client.NewStream(ctx, "block", nil)
+		assert(t, err == nil, err)
+		assert(t, s.Send(ctx, make([]byte, 10)) == nil)
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		assert(t, s.Send(timeoutCtx, []byte("x")) == context.DeadlineExceeded, "blocked by flow control")
+	})
+}
+
+func TestStreamServer_handle(t *testing.T) {
+	t.Run("failed-before-handler", func(t *testing.T) {
+		ctx := testContext(t)
+		client, server := newTestMuxPair(t)
+		s, err := client.OpenStream(ctx)
+		assert(t, err == nil, err)
+		assert(t, s.WriteFrame(NewHeaderFrame(s.SeqID(), nil, nil)) == nil)
+		ms, err := server.Accept(ctx)
+		assert(t, err == nil, err)
+		_, err = ms.ReadFrame(ctx) // taken away from handle
+		assert(t, err == nil, err)
+		ms.fail(io.ErrUnexpectedEOF)
+
+		NewStreamServer().handle(ms)
+		assert(t, server.NumStreams() == 0, "released", server.NumStreams())
+		_, err = ms.ReadFrame(ctx)
+		assert(t, err == io.EOF, err)
+	})
+}
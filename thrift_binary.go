@@ -0,0 +1,196 @@
+package ttheader
+
+import (
+	"errors"
+	"math"
+)
+
+// thrift binary protocol:
+// Message (strict):     version|type(4 bytes, 0x8001_00XX) + method(4 bytes length + value) + seqID(4 bytes)
+// Message (non-strict): method(4 bytes length + value) + type(1 byte) + seqID(4 bytes)
+// Struct:               [field_type(1) + field_id(2) + value]* + stop(1)
+// Map:                  key_type(1) + value_type(1) + size(4) + [key + value]*
+// Set/List:             elem_type(1) + size(4) + [elem]*
+
+const (
+	thriftTypeBool   = 0x2
+	thriftTypeByte   = 0x3
+	thriftTypeDouble = 0x4
+	thriftTypeInt16  = 0x6
+	thriftTypeInt64  = 0xa
+	thriftTypeStruct = 0xc
+	thriftTypeMap    = 0xd
+	thriftTypeSet    = 0xe
+	thriftTypeList   = 0xf
+	thriftTypeUUID   = 0x10
+
+	thriftVersionMask = 0xffff0000
+	thriftVersion1    = 0x80010000
+
+	// maxThriftDepth limits the nesting level of containers and structs, to avoid stack overflow
+	maxThriftDepth = 64
+)
+
+var (
+	ErrThriftDepthExceeded = errors.New("max thrift depth exceeded")
+	ErrInvalidThriftType   = errors.New("invalid thrift type")
+	ErrInvalidThriftSize   = errors.New("invalid thrift size")
+)
+
+// thriftReader is the reader needed for skipping thrift values
+type thriftReader interface {
+	ReadByte() (byte, error)
+	ReadUint32() (uint32, error)
+	Skip(n int) error
+}
+
+// thriftBinaryFixedSize returns the encoded size of a fixed-size type, or 0 for variable-size/invalid types
+func thriftBinaryFixedSize(tp byte) int {
+	switch tp {
+	case thriftTypeBool, thriftTypeByte:
+		return 1
+	case thriftTypeInt16:
+		return 2
+	case thriftTypeInt32:
+		return 4
+	case thriftTypeDouble, thriftTypeInt64:
+		return 8
+	case thriftTypeUUID:
+		return 16
+	default:
+		return 0
+	}
+}
+
+// skipThriftBinary skips a value of the given type; depth is the nesting level of the value
+func skipThriftBinary(reader thriftReader, tp byte, depth int) error {
+	if depth > maxThriftDepth {
+		return ErrThriftDepthExceeded
+	}
+	if size := thriftBinaryFixedSize(tp); size > 0 {
+		return reader.Skip(size)
+	}
+	switch tp {
+	case thriftTypeBinary:
+		size, err := readThriftSize(reader)
+		if err != nil {
+			return err
+		}
+		return reader.Skip(size)
+	case thriftTypeStruct:
+		for {
+			fieldType, err := reader.ReadByte()
+			if err != nil {
+				return err
+			}
+			if fieldType == thriftStop {
+				return nil
+			}
+			if err = reader.Skip(2); err != nil { // field id
+				return err
+			}
+			if err = skipThriftBinary(reader, fieldType, depth+1); err != nil {
+				return err
+			}
+		}
+	case thriftTypeMap:
+		keyType, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		valueType, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		size, err := readThriftSize(reader)
+		if err != nil {
+			return err
+		}
+		return skipThriftBinaryElements(reader, size, depth, keyType, valueType)
+	case thriftTypeSet, thriftTypeList:
+		elemType, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		size, err := readThriftSize(reader)
+		if err != nil {
+			return err
+		}
+		return skipThriftBinaryElements(reader, size, depth, elemType)
+	default:
+		return ErrInvalidThriftType
+	}
+}
+
+// skipThriftBinaryElements skips count elements of a container, each of which consists of values of given types
+func skipThriftBinaryElements(reader thriftReader, count, depth int, types ...byte) error {
+	elemSize := 0
+	for _, tp := range types {
+		size := thriftBinaryFixedSize(tp)
+		if size == 0 {
+			elemSize = 0
+			break
+		}
+		elemSize += size
+	}
+	if elemSize > 0 { // skip all fixed-size elements at once
+		if count > math.MaxInt32/elemSize {
+			return ErrInvalidThriftSize
+		}
+		return reader.Skip(count * elemSize)
+	}
+	for i := 0; i < count; i++ {
+		for _, tp := range types {
+			if err := skipThriftBinary(reader, tp, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// skipThriftBinaryMessage skips a whole message (both strict and non-strict), returning its seqID
+func skipThriftBinaryMessage(reader thriftReader) (int32, error) {
+	seqID, err := skipThriftBinaryMessageBegin(reader)
+	if err != nil {
+		return 0, err
+	}
+	return seqID, skipThriftBinary(reader, thriftTypeStruct, 0)
+}
+
+// skipThriftBinaryMessageBegin skips the message header (both strict and non-strict), returning its seqID
+func skipThriftBinaryMessageBegin(reader thriftReader) (int32, error) {
+	first, err := reader.ReadUint32()
+	if err != nil {
+		return 0, err
+	}
+	if int32(first) < 0 { // strict: version|type + method + seqID
+		if first&thriftVersionMask != thriftVersion1 {
+			return 0, ErrInvalidThriftMagic
+		}
+		size, err := readThriftSize(reader)
+		if err != nil {
+			return 0, err
+		}
+		if err = reader.Skip(size); err != nil {
+			return 0, err
+		}
+	} else { // non-strict: method + type + seqID, and the first 4 bytes is the length of method
+		if err = reader.Skip(int(first) + 1); err != nil {
+			return 0, err
+		}
+	}
+	seqID, err := reader.ReadUint32()
+	return int32(seqID), err
+}
+
+func readThriftSize(reader thriftReader) (int, error) {
+	size, err := reader.ReadUint32()
+	if err != nil {
+		return 0, err
+	}
+	if int32(size) < 0 {
+		return 0, ErrInvalidThriftSize
+	}
+	return int(size), nil
+}
@@ -0,0 +1,147 @@
+package ttheader
+
+import (
+	"io"
+	"testing"
+)
+
+// helpers for building thrift binary data in tests
+
+func appendI32(buf []byte, v int32) []byte {
+	return appendUint32(buf, uint32(v))
+}
+
+func appendThriftString(buf []byte, s string) []byte {
+	return append(appendI32(buf, int32(len(s))), s...)
+}
+
+func appendFieldBegin(buf []byte, tp byte, id int16) []byte {
+	return appendI16(append(buf, tp), id)
+}
+
+// testThriftStruct returns a struct with all types of fields
+func testThriftStruct() []byte {
+	var buf []byte
+	buf = append(appendFieldBegin(buf, thriftTypeBool, 1), 1)
+	buf = append(appendFieldBegin(buf, thriftTypeByte, 2), 2)
+	buf = appendI16(appendFieldBegin(buf, thriftTypeInt16, 3), 3)
+	buf = appendI32(appendFieldBegin(buf, thriftTypeInt32, 4), 4)
+	buf = append(appendFieldBegin(buf, thriftTypeInt64, 5), 0, 0, 0, 0, 0, 0, 0, 5)
+	buf = append(appendFieldBegin(buf, thriftTypeDouble, 6), 0, 0, 0, 0, 0, 0, 0, 6)
+	buf = appendThriftString(appendFieldBegin(buf, thriftTypeBinary, 7), "seven")
+	// list<string>
+	buf = append(appendFieldBegin(buf, thriftTypeList, 8), thriftTypeBinary)
+	buf = appendThriftString(appendThriftString(appendI32(buf, 2), "a"), "b")
+	// set<i32>
+	buf = append(appendFieldBegin(buf, thriftTypeSet, 9), thriftTypeInt32)
+	buf = appendI32(appendI32(appendI32(buf, 2), 1), 2)
+	// map<string, struct{1: i32}>
+	buf = append(appendFieldBegin(buf, thriftTypeMap, 10), thriftTypeBinary, thriftTypeStruct)
+	buf = appendThriftString(appendI32(buf, 1), "key")
+	buf = append(appendI32(appendFieldBegin(buf, thriftTypeInt32, 1), 1), thriftStop)
+	// map<i64, i16>
+	buf = append(appendFieldBegin(buf, thriftTypeMap, 11), thriftTypeInt64, thriftTypeInt16)
+	buf = append(appendI32(buf, 1), 0, 0, 0, 0, 0, 0, 0, 1, 0, 1)
+	// nested struct
+	buf = append(appendFieldBegin(buf, thriftTypeStruct, 12), thriftStop)
+	return append(buf, thriftStop)
+}
+
+func testThriftMessage(seqID int32) []byte {
+	buf := appendUint32(nil, thriftVersion1|0x1) // call
+	buf = appendThriftString(buf, "method")
+	buf = appendI32(buf, seqID)
+	return append(buf, testThriftStruct()...)
+}
+
+func Test_skipThriftBinary(t *testing.T) {
+	t.Run("all-types", func(t *testing.T) {
+		buf := append(testThriftStruct(), 0xff)
+		reader := newBytesReader(buf)
+		err := skipThriftBinary(reader, thriftTypeStruct, 0)
+		assert(t, err == nil, err)
+		assert(t, reader.idx == len(buf)-1, reader.idx)
+	})
+	t.Run("truncated", func(t *testing.T) {
+		buf := testThriftStruct()
+		for i := 0; i < len(buf); i++ {
+			err := skipThriftBinary(newBytesReader(buf[:i]), thriftTypeStruct, 0)
+			assert(t, err != nil, i)
+		}
+	})
+	t.Run("invalid-type", func(t *testing.T) {
+		buf := append(appendFieldBegin(nil, 0x1, 1), thriftStop)
+		err := skipThriftBinary(newBytesReader(buf), thriftTypeStruct, 0)
+		assert(t, err == ErrInvalidThriftType, err)
+	})
+	t.Run("invalid-elem-type", func(t *testing.T) {
+		buf := appendI32([]byte{0x1}, 1)
+		err := skipThriftBinary(newBytesReader(buf), thriftTypeList, 0)
+		assert(t, err == ErrInvalidThriftType, err)
+	})
+	t.Run("negative-size", func(t *testing.T) {
+		buf := appendI32([]byte{thriftTypeInt32}, -1)
+		err := skipThriftBinary(newBytesReader(buf), thriftTypeList, 0)
+		assert(t, err == ErrInvalidThriftSize, err)
+	})
+	t.Run("huge-fixed-size-elements", func(t *testing.T) {
+		buf := appendI32([]byte{thriftTypeUUID, thriftTypeUUID}, 0x7fffffff)
+		err := skipThriftBinary(newBytesReader(buf), thriftTypeMap, 0)
+		assert(t, err == ErrInvalidThriftSize, err)
+	})
+	t.Run("depth-exceeded", func(t *testing.T) {
+		var buf []byte
+		for i := 0; i <= maxThriftDepth; i++ {
+			buf = appendFieldBegin(buf, thriftTypeStruct, 1)
+		}
+		for i := 0; i <= maxThriftDepth+1; i++ {
+			buf = append(buf, thriftStop)
+		}
+		err := skipThriftBinary(newBytesReader(buf), thriftTypeStruct, 0)
+		assert(t, err == ErrThriftDepthExceeded, err)
+	})
+}
+
+func Test_skipThriftBinaryMessage(t *testing.T) {
+	t.Run("strict", func(t *testing.T) {
+		buf := testThriftMessage(100)
+		reader := newBytesReader(buf)
+		seqID, err := skipThriftBinaryMessage(reader)
+		assert(t, err == nil, err)
+		assert(t, seqID == 100, seqID)
+		assert(t, reader.idx == len(buf), reader.idx)
+	})
+	t.Run("non-strict", func(t *testing.T) {
+		buf := appendThriftString(nil, "method")
+		buf = append(buf, 0x1)
+		buf = appendI32(buf, 100)
+		buf = append(buf, testThriftStruct()...)
+		reader := newBytesReader(buf)
+		seqID, err := skipThriftBinaryMessage(reader)
+		assert(t, err == nil, err)
+		assert(t, seqID == 100, seqID)
+		assert(t, reader.idx == len(buf), reader.idx)
+	})
+	t.Run("invalid-version", func(t *testing.T) {
+		buf := appendUint32(nil, 0x80020001)
+		_, err := skipThriftBinaryMessage(newBytesReader(buf))
+		assert(t, err == ErrInvalidThriftMagic, err)
+	})
+	t.Run("truncated", func(t *testing.T) {
+		buf := testThriftMessage(100)
+		for i := 1; i < len(buf); i++ {
+			_, err := skipThriftBinaryMessage(newBytesReader(buf[:i]))
+			assert(t, err != nil, i)
+		}
+	})
+	t.Run("invalid-type", func(t *testing.T) {
+		buf := append(appendThriftString(nil, "method"), 0x1)
+		buf = append(appendFieldBegin(appendI32(buf, 100), 0x1, 1), thriftStop)
+		_, err := skipThriftBinaryMessage(newBytesReader(buf))
+		assert(t, err == ErrInvalidThriftType, err)
+	})
+	t.Run("eof", func(t *testing.T) {
+		_, err := skipThriftBinaryMessage(newBytesReader(nil))
+		assert(t, err == io.EOF, err)
+	})
+}
@@ -0,0 +1,213 @@
+package ttheader
+
+import (
+	"math"
+)
+
+// thrift compact protocol:
+// Message: protocol_id(0x82) + type(3 bits)|version(5 bits) + seqID(varint) + method(varint length + value)
+// Field:   delta(4 bits)|type(4 bits) if 0 < delta <= 15, else type(1 byte) + id(zigzag varint); stop(0)
+// i16/i32/i64: zigzag varint; double: 8 bytes little endian; binary: varint length + value
+// Bool:    field type 1 (true) or 2 (false); 1 byte in containers
+// List/Set: size(4 bits)|elem_type(4 bits) if size < 15, else 0xf|elem_type + size(varint)
+// Map:     size(varint) + key_type(4 bits)|value_type(4 bits) (omitted if size is 0)
+
+const (
+	thriftCompactTypeShift = 5
+
+	compactTypeStop      = 0x0
+	compactTypeTrue      = 0x1
+	compactTypeFalse     = 0x2
+	compactTypeByte      = 0x3
+	compactTypeInt16     = 0x4
+	compactTypeInt32     = 0x5
+	compactTypeInt64     = 0x6
+	compactTypeDouble    = 0x7
+	compactTypeBinary    = 0x8
+	compactTypeList      = 0x9
+	compactTypeSet       = 0xa
+	compactTypeMap       = 0xb
+	compactTypeStruct    = 0xc
+	compactTypeUUID      = 0xd
+	compactTypeMask      = 0x0f
+	compactMaxShortDelta = 15
+)
+
+// appendCompactMessageBegin appends the compact message header
+func appendCompactMessageBegin(buf []byte, name string, msgType byte, seqID int32) []byte {
+	buf = append(buf, thriftCompactProtocolID, msgType<<thriftCompactTypeShift|thriftCompactVersion)
+	buf = appendUvarint(buf, uint64(uint32(seqID)))
+	return appendCompactString(buf, name)
+}
+
+// readCompactMessageBegin reads the compact message header
+func readCompactMessageBegin(reader *bytesReader) (name string, msgType byte, seqID int32, err error) {
+	var protocolID, typeAndVersion byte
+	if protocolID, err = reader.ReadByte(); err != nil {
+		return
+	}
+	if typeAndVersion, err = reader.ReadByte(); err != nil {
+		return
+	}
+	if protocolID != thriftCompactProtocolID || typeAndVersion&thriftCompactVersionMask != thriftCompactVersion {
+		err = ErrInvalidThriftMagic
+		return
+	}
+	msgType = typeAndVersion >> thriftCompactTypeShift
+	var id uint64
+	if id, err = reader.ReadUvarint(); err != nil {
+		return
+	}
+	if id > math.MaxUint32 {
+		err = ErrInvalidVarint
+		return
+	}
+	seqID = int32(uint32(id))
+	name, err = readCompactString(reader)
+	return
+}
+
+// appendCompactFieldBegin appends the field header, with the id of the previous field in the struct
+func appendCompactFieldBegin(buf []byte, tp byte, id, lastID int16) []byte {
+	if delta := int(id) - int(lastID); delta > 0 && delta <= compactMaxShortDelta {
+		return append(buf, byte(delta)<<4|tp)
+	}
+	return appendUvarint(append(buf, tp), zigzag(int64(id)))
+}
+
+// readCompactFieldBegin reads the field header, with the id of the previous field in the struct
+func readCompactFieldBegin(reader *bytesReader, lastID int16) (tp byte, id int16, err error) {
+	var b byte
+	if b, err = reader.ReadByte(); err != nil {
+		return
+	}
+	tp = b & compactTypeMask
+	if tp == compactTypeStop {
+		return
+	}
+	if delta := int16(b >> 4); delta != 0 {
+		return tp, lastID + delta, nil
+	}
+	var v uint64
+	if v, err = reader.ReadUvarint(); err != nil {
+		return
+	}
+	return tp, int16(unzigzag(v)), nil
+}
+
+func appendCompactString(buf []byte, s string) []byte {
+	return append(appendUvarint(buf, uint64(len(s))), s...)
+}
+
+func readCompactString(reader *bytesReader) (string, error) {
+	size, err := readCompactSize(reader)
+	if err != nil {
+		return "", err
+	}
+	return reader.ReadString(size)
+}
+
+func readCompactSize(reader *bytesReader) (int, error) {
+	size, err := reader.ReadUvarint()
+	if err != nil {
+		return 0, err
+	}
+	if size > math.MaxInt32 {
+		return 0, ErrInvalidThriftSize
+	}
+	return int(size), nil
+}
+
+func readCompactInt32(reader *bytesReader) (int32, error) {
+	v, err := reader.ReadUvarint()
+	if err != nil {
+		return 0, err
+	}
+	return int32(unzigzag(v)), nil
+}
+
+// skipThriftCompact skips a value of the given compact type; depth is the nesting level of the value
+func skipThriftCompact(reader *bytesReader, tp byte, depth int) error {
+	if depth > maxThriftDepth {
+		return ErrThriftDepthExceeded
+	}
+	switch tp {
+	case compactTypeTrue, compactTypeFalse: // bool fields have no value byte, but elements in containers do
+		return nil
+	case compactTypeByte:
+		return reader.Skip(1)
+	case compactTypeInt16, compactTypeInt32, compactTypeInt64:
+		_, err := reader.ReadUvarint()
+		return err
+	case compactTypeDouble:
+		return reader.Skip(8)
+	case compactTypeUUID:
+		return reader.Skip(16)
+	case compactTypeBinary:
+		size, err := readCompactSize(reader)
+		if err != nil {
+			return err
+		}
+		return reader.Skip(size)
+	case compactTypeStruct:
+		var lastID int16
+		for {
+			fieldType, id, err := readCompactFieldBegin(reader, lastID)
+			if err != nil {
+				return err
+			}
+			if fieldType == compactTypeStop {
+				return nil
+			}
+			if err = skipThriftCompact(reader, fieldType, depth+1); err != nil {
+				return err
+			}
+			lastID = id
+		}
+	case compactTypeList, compactTypeSet:
+		elemType, size, err := readCompactListBegin(reader)
+		if err != nil {
+			return err
+		}
+		return skipThriftCompactElements(reader, size, depth, elemType)
+	case compactTypeMap:
+		size, err := readCompactSize(reader)
+		if err != nil || size == 0 {
+			return err
+		}
+		types, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		return skipThriftCompactElements(reader, size, depth, types>>4, types&compactTypeMask)
+	default:
+		return ErrInvalidThriftType
+	}
+}
+
+// skipThriftCompactElements skips count elements of a container, each of which consists of values of given types
+func skipThriftCompactElements(reader *bytesReader, count, depth int, types ...byte) error {
+	for i := 0; i < count; i++ {
+		for _, tp := range types {
+			if tp == compactTypeTrue || tp == compactTypeFalse { // bool elements take one byte
+				tp = compactTypeByte
+			}
+			if err := skipThriftCompact(reader, tp, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func readCompactListBegin(reader *bytesReader) (elemType byte, size int, err error) {
+	var b byte
+	if b, err = reader.ReadByte(); err != nil {
+		return
+	}
+	elemType = b & compactTypeMask
+	if size = int(b >> 4); size == 0xf {
+		size, err = readCompactSize(reader)
+	}
+	return
+}
@@ -0,0 +1,95 @@
+package ttheader
+
+import (
+	"io"
+	"testing"
+)
+
+// testCompactStruct returns a compact struct with all types of fields
+func testCompactStruct() []byte {
+	var buf []byte
+	buf = appendCompactFieldBegin(buf, compactTypeTrue, 1, 0)
+	buf = append(appendCompactFieldBegin(buf, compactTypeByte, 2, 1), 2)
+	buf = appendUvarint(appendCompactFieldBegin(buf, compactTypeInt16, 3, 2), zigzag(-3))
+	buf = appendUvarint(appendCompactFieldBegin(buf, compactTypeInt32, 4, 3), zigzag(4))
+	buf = appendUvarint(appendCompactFieldBegin(buf, compactTypeInt64, 100, 4), zigzag(1<<40)) // long delta
+	buf = append(appendCompactFieldBegin(buf, compactTypeDouble, 101, 100), 0, 0, 0, 0, 0, 0, 0, 0)
+	buf = appendCompactString(appendCompactFieldBegin(buf, compactTypeBinary, 102, 101), "str")
+	// list<bool> with 2 elements
+	buf = append(appendCompactFieldBegin(buf, compactTypeList, 103, 102), 2<<4|compactTypeTrue, 1, 2)
+	// set<i32> with 20 elements (long form)
+	buf = appendUvarint(append(appendCompactFieldBegin(buf, compactTypeSet, 104, 103), 0xf0|compactTypeInt32), 20)
+	for i := 0; i < 20; i++ {
+		buf = appendUvarint(buf, zigzag(int64(i)))
+	}
+	// map<string, struct{1: i32}>
+	buf = appendUvarint(appendCompactFieldBegin(buf, compactTypeMap, 105, 104), 1)
+	buf = append(buf, compactTypeBinary<<4|compactTypeStruct)
+	buf = appendCompactString(buf, "key")
+	buf = append(appendUvarint(appendCompactFieldBegin(buf, compactTypeInt32, 1, 0), zigzag(1)), compactTypeStop)
+	// empty map
+	buf = appendUvarint(appendCompactFieldBegin(buf, compactTypeMap, 106, 105), 0)
+	// uuid
+	buf = append(appendCompactFieldBegin(buf, compactTypeUUID, 107, 106), make([]byte, 16)...)
+	return append(buf, compactTypeStop)
+}
+
+func Test_compactMessageBegin(t *testing.T) {
+	t.Run("normal", func(t *testing.T) {
+		buf := appendCompactMessageBegin(nil, "m", 1, -1)
+		name, msgType, seqID, err := readCompactMessageBegin(newBytesReader(buf))
+		assert(t, err == nil, err)
+		assert(t, name == "m" && msgType == 1 && seqID == -1, name, msgType, seqID)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		_, _, _, err := readCompactMessageBegin(newBytesReader([]byte{0x82, 0x22, 0, 0}))
+		assert(t, err == ErrInvalidThriftMagic, err)
+	})
+	t.Run("seqID-overflow", func(t *testing.T) {
+		buf := appendUvarint([]byte{0x82, 0x21}, 1<<32)
+		_, _, _, err := readCompactMessageBegin(newBytesReader(buf))
+		assert(t, err == ErrInvalidVarint, err)
+	})
+	t.Run("eof", func(t *testing.T) {
+		_, _, _, err := readCompactMessageBegin(newBytesReader([]byte{0x82}))
+		assert(t, err == io.EOF, err)
+	})
+}
+
+func Test_compactFieldBegin(t *testing.T) {
+	for _, tt := range []struct{ id, lastID int16 }{{1, 0}, {15, 0}, {16, 0}, {-1, 0}, {3, 5}} {
+		buf := appendCompactFieldBegin(nil, compactTypeInt32, tt.id, tt.lastID)
+		tp, id, err := readCompactFieldBegin(newBytesReader(buf), tt.lastID)
+		assert(t, err == nil, err)
+		assert(t, tp == compactTypeInt32 && id == tt.id, tp, id, tt)
+	}
+}
+
+func Test_skipThriftCompact(t *testing.T) {
+	t.Run("all-types", func(t *testing.T) {
+		buf := append(testCompactStruct(), 0xff)
+		reader := newBytesReader(buf)
+		err := skipThriftCompact(reader, compactTypeStruct, 0)
+		assert(t, err == nil, err)
+		assert(t, reader.idx == len(buf)-1, reader.idx)
+	})
+	t.Run("truncated", func(t *testing.T) {
+		buf := testCompactStruct()
+		for i := 0; i < len(buf); i++ {
+			err := skipThriftCompact(newBytesReader(buf[:i]), compactTypeStruct, 0)
+			assert(t, err != nil, i)
+		}
+	})
+	t.Run("invalid-type", func(t *testing.T) {
+		err := skipThriftCompact(newBytesReader([]byte{0x1e, 0}), compactTypeStruct, 0)
+		assert(t, err == ErrInvalidThriftType, err)
+	})
+	t.Run("depth-exceeded", func(t *testing.T) {
+		var buf []byte
+		for i := 0; i <= maxThriftDepth; i++ {
+			buf = appendCompactFieldBegin(buf, compactTypeStruct, 1, 0)
+		}
+		err := skipThriftCompact(newBytesReader(buf), compactTypeStruct, 0)
+		assert(t, err == ErrThriftDepthExceeded, err)
+	})
+}
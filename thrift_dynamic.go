@@ -0,0 +1,496 @@
+package ttheader
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// dynamic codec: encodes/decodes thrift binary payloads with a ThriftIDL, converting between
+// the generic tree (ThriftStruct) and maps keyed by field names.
+//
+// Go types of values in maps:
+//   bool: bool; byte: int8; i16: int16; i32 (and enums): int32; i64: int64; double: float64;
+//   string: string; binary: []byte; uuid: [16]byte; struct: map[string]interface{};
+//   list/set: []interface{}; map: map[string]interface{} for string keys, or map[interface{}]interface{}.
+// When encoding, any integer/float types (and json.Number) are accepted for numbers, enum names for enums,
+// string for binary/uuid, and any slices and maps for containers.
+//
+// In JSON, binary is base64, uuid is in the canonical form, doubles of NaN and Inf are strings (see jsonFloat),
+// and map keys are strings, e.g. "1" for i32 keys and `{"id":1}` for struct keys.
+
+var (
+	ErrUnknownThriftField   = errors.New("unknown thrift field")
+	ErrMissingRequiredField = errors.New("missing required field")
+)
+
+// Encode encodes the value (keyed by field names) as a struct in thrift binary
+func (s *ThriftStructDef) Encode(value map[string]interface{}) ([]byte, error) {
+	tree, err := thriftConverter{}.toStruct(s, value, 0)
+	if err != nil {
+		return nil, err
+	}
+	return tree.Bytes()
+}
+
+// Decode decodes a struct in thrift binary into a map keyed by field names; unknown fields are ignored
+func (s *ThriftStructDef) Decode(buf []byte) (map[string]interface{}, error) {
+	tree, err := DecodeThriftStruct(buf)
+	if err != nil {
+		return nil, err
+	}
+	return thriftConverter{}.fromStruct(s, tree)
+}
+
+// EncodeCall encodes a call (or oneway) message, with arguments keyed by names
+func (m *ThriftMethodDef) EncodeCall(seqID int32, args map[string]interface{}) ([]byte, error) {
+	return m.encode(thriftConverter{}, m.args, m.callType(), seqID, args)
+}
+
+// EncodeCallJSON encodes a call (or oneway) message, with arguments in a JSON object
+func (m *ThriftMethodDef) EncodeCallJSON(seqID int32, args []byte) ([]byte, error) {
+	value, err := unmarshalThriftJSON(args)
+	if err != nil {
+		return nil, err
+	}
+	return m.encode(thriftConverter{json: true}, m.args, m.callType(), seqID, value)
+}
+
+// DecodeCall decodes a call (or oneway) message, returning arguments keyed by names
+func (m *ThriftMethodDef) DecodeCall(payload []byte) (*MessageBegin, map[string]interface{}, error) {
+	return m.decode(thriftConverter{}, m.args, payload)
+}
+
+// DecodeCallJSON decodes a call (or oneway) message, returning arguments in a JSON object
+func (m *ThriftMethodDef) DecodeCallJSON(payload []byte) (*MessageBegin, []byte, error) {
+	return marshalThriftJSON(m.decode(thriftConverter{json: true}, m.args, payload))
+}
+
+// EncodeReply encodes a reply message; result is keyed by "success" or names of the declared exceptions
+func (m *ThriftMethodDef) EncodeReply(seqID int32, result map[string]interface{}) ([]byte, error) {
+	return m.encode(thriftConverter{}, m.result, MessageTypeReply, seqID, result)
+}
+
+// EncodeReplyJSON encodes a reply message, with the result in a JSON object
+func (m *ThriftMethodDef) EncodeReplyJSON(seqID int32, result []byte) ([]byte, error) {
+	value, err := unmarshalThriftJSON(result)
+	if err != nil {
+		return nil, err
+	}
+	return m.encode(thriftConverter{json: true}, m.result, MessageTypeReply, seqID, value)
+}
+
+// DecodeReply decodes a reply message, returning the result keyed by "success" or names of the declared exceptions
+// Note: for exception messages (TApplicationException), an *Exception is returned as the error
+func (m *ThriftMethodDef) DecodeReply(payload []byte) (*MessageBegin, map[string]interface{}, error) {
+	return m.decode(thriftConverter{}, m.result, payload)
+}
+
+// DecodeReplyJSON decodes a reply message, returning the result in a JSON object
+func (m *ThriftMethodDef) DecodeReplyJSON(payload []byte) (*MessageBegin, []byte, error) {
+	return marshalThriftJSON(m.decode(thriftConverter{json: true}, m.result, payload))
+}
+
+func (m *ThriftMethodDef) callType() MessageType {
+	if m.Oneway {
+		return MessageTypeOneway
+	}
+	return MessageTypeCall
+}
+
+func (m *ThriftMethodDef) encode(c thriftConverter, s *ThriftStructDef, msgType MessageType,
+	seqID int32, value map[string]interface{}) ([]byte, error) {
+	body, err := c.toStruct(s, value, 0)
+	if err != nil {
+		return nil, err
+	}
+	msg := &ThriftMessage{MessageBegin: MessageBegin{Name: m.Name, Type: msgType, SeqID: seqID}, Body: body}
+	return msg.Bytes()
+}
+
+func (m *ThriftMethodDef) decode(c thriftConverter, s *ThriftStructDef, payload []byte) (
+	*MessageBegin, map[string]interface{}, error) {
+	reader := newBytesReader(payload)
+	msg, err := readBinaryMessageBegin(reader, ProtocolIDThriftBinary)
+	if err != nil {
+		return nil, nil, err
+	}
+	if msg.Name != m.Name {
+		return msg, nil, fmt.Errorf("thrift: expect method %s, got %s", m.Name, msg.Name)
+	}
+	isCall := msg.Type == MessageTypeCall || msg.Type == MessageTypeOneway
+	if s == m.result && msg.Type == MessageTypeException {
+		exc := &Exception{MethodName: msg.Name, SeqID: msg.SeqID}
+		if err = exc.readFields(reader); err != nil {
+			return msg, nil, err
+		}
+		return msg, nil, exc
+	} else if (s == m.args) != isCall || !msg.Type.valid() {
+		return msg, nil, fmt.Errorf("thrift: unexpected message type %s", msg.Type)
+	}
+	body, err := decodeThriftStruct(reader, 0)
+	if err != nil {
+		return msg, nil, err
+	}
+	value, err := c.fromStruct(s, body)
+	return msg, value, err
+}
+
+func unmarshalThriftJSON(buf []byte) (map[string]interface{}, error) {
+	var value map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func marshalThriftJSON(msg *MessageBegin, value map[string]interface{}, err error) (*MessageBegin, []byte, error) {
+	if err != nil {
+		return msg, nil, err
+	}
+	buf, err := json.Marshal(value)
+	return msg, buf, err
+}
+
+// thriftConverter converts between the generic tree and Go values
+type thriftConverter struct {
+	// json converts binary into base64, uuid into strings and map keys into strings
+	json bool
+}
+
+func (c thriftConverter) toStruct(def *ThriftStructDef, value interface{}, depth int) (*ThriftStruct, error) {
+	if depth > maxThriftDepth {
+		return nil, ErrThriftDepthExceeded
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok && value != nil {
+		return nil, fmt.Errorf("thrift: expect map[string]interface{} for %s, got %T", def.Name, value)
+	}
+	for name := range fields {
+		if def.Field(name) == nil {
+			return nil, fmt.Errorf("%w: %s.%s", ErrUnknownThriftField, def.Name, name)
+		}
+	}
+	s := &ThriftStruct{}
+	for _, f := range def.Fields {
+		v, ok := fields[f.Name]
+		if !ok || v == nil {
+			if f.Required {
+				return nil, fmt.Errorf("%w: %s.%s", ErrMissingRequiredField, def.Name, f.Name)
+			}
+			continue
+		}
+		tv, err := c.toValue(f.Type, v, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", def.Name, f.Name, err)
+		}
+		s.Fields = append(s.Fields, &ThriftField{ID: f.ID, Type: f.Type.WireType(), Value: tv})
+	}
+	if def.Kind == "union" && len(s.Fields) != 1 {
+		return nil, fmt.Errorf("thrift: union %s should have exactly one field set, got %d", def.Name, len(s.Fields))
+	}
+	return s, nil
+}
+
+func (c thriftConverter) toValue(t *ThriftTypeRef, value interface{}, depth int) (interface{}, error) {
+	if depth > maxThriftDepth {
+		return nil, ErrThriftDepthExceeded
+	}
+	t = t.underlying()
+	switch t.wireType {
+	case ThriftTypeBool:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	case ThriftTypeByte:
+		v, err := c.toInt(t, value, 8)
+		return int8(v), err
+	case ThriftTypeI16:
+		v, err := c.toInt(t, value, 16)
+		return int16(v), err
+	case ThriftTypeI32:
+		v, err := c.toInt(t, value, 32)
+		return int32(v), err
+	case ThriftTypeI64:
+		return c.toInt(t, value, 64)
+	case ThriftTypeDouble:
+		return c.toFloat(t, value)
+	case ThriftTypeString:
+		switch v := value.(type) {
+		case string:
+			if c.json && t.Name == "binary" {
+				return base64.StdEncoding.DecodeString(v)
+			}
+			return v, nil
+		case []byte:
+			return v, nil
+		}
+	case ThriftTypeUUID:
+		switch v := value.(type) {
+		case [16]byte:
+			return v, nil
+		case string:
+			return parseUUID(v)
+		}
+	case ThriftTypeStruct:
+		return c.toStruct(t.Struct, value, depth)
+	case ThriftTypeList, ThriftTypeSet:
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			break
+		}
+		l := &ThriftList{ElemType: t.ValueType.WireType(), Elems: make([]interface{}, 0, rv.Len())}
+		for i := 0; i < rv.Len(); i++ {
+			elem, err := c.toValue(t.ValueType, rv.Index(i).Interface(), depth+1)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			l.Elems = append(l.Elems, elem)
+		}
+		return l, nil
+	case ThriftTypeMap:
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Map {
+			break
+		}
+		m := &ThriftMap{KeyType: t.KeyType.WireType(), ValueType: t.ValueType.WireType()}
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { // for stable output
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			k, err := c.toKey(t.KeyType, key.Interface(), depth+1)
+			if err != nil {
+				return nil, fmt.Errorf("[%v]: %w", key.Interface(), err)
+			}
+			v, err := c.toValue(t.ValueType, rv.MapIndex(key).Interface(), depth+1)
+			if err != nil {
+				return nil, fmt.Errorf("[%v]: %w", key.Interface(), err)
+			}
+			m.Entries = append(m.Entries, &ThriftMapEntry{Key: k, Value: v})
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("thrift: expect %s, got %T", t.Name, value)
+}
+
+// toKey converts a map key, which may be a string for non-string types (e.g. in JSON)
+func (c thriftConverter) toKey(t *ThriftTypeRef, key interface{}, depth int) (interface{}, error) {
+	s, ok := key.(string)
+	if !ok {
+		return c.toValue(t, key, depth)
+	}
+	switch t.WireType() {
+	case ThriftTypeBool:
+		if b, err := strconv.ParseBool(s); err == nil {
+			key = b
+		}
+	case ThriftTypeByte, ThriftTypeI16, ThriftTypeI32, ThriftTypeI64, ThriftTypeDouble:
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			key = json.Number(s)
+		}
+	case ThriftTypeStruct, ThriftTypeList, ThriftTypeSet, ThriftTypeMap:
+		decoder := json.NewDecoder(strings.NewReader(s))
+		decoder.UseNumber()
+		if err := decoder.Decode(&key); err != nil {
+			return nil, err
+		}
+	}
+	return c.toValue(t, key, depth)
+}
+
+// toInt converts numbers (and enum names) into an integer of the given bits
+func (c thriftConverter) toInt(t *ThriftTypeRef, value interface{}, bits uint) (int64, error) {
+	var n int64
+	rv := reflect.ValueOf(value)
+	switch v := value.(type) {
+	case json.Number:
+		var err error
+		if n, err = v.Int64(); err != nil {
+			return 0, fmt.Errorf("thrift: invalid %s %s", t.Name, v)
+		}
+	case string:
+		if t.Enum == nil {
+			return 0, fmt.Errorf("thrift: expect %s, got %T", t.Name, value)
+		}
+		ev, ok := t.Enum.Value(v)
+		if !ok {
+			return 0, fmt.Errorf("thrift: unknown %s value %s", t.Name, v)
+		}
+		n = int64(ev)
+	default:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = rv.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if rv.Uint() > math.MaxInt64 {
+				return 0, fmt.Errorf("thrift: %v overflows %s", value, t.Name)
+			}
+			n = int64(rv.Uint())
+		case reflect.Float32, reflect.Float64:
+			f := rv.Float()
+			if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+				return 0, fmt.Errorf("thrift: invalid %s %v", t.Name, value)
+			}
+			n = int64(f)
+		default:
+			return 0, fmt.Errorf("thrift: expect %s, got %T", t.Name, value)
+		}
+	}
+	if bits < 64 && (n < -1<<(bits-1) || n > 1<<(bits-1)-1) {
+		return 0, fmt.Errorf("thrift: %d overflows %s", n, t.Name)
+	}
+	return n, nil
+}
+
+func (c thriftConverter) toFloat(t *ThriftTypeRef, value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.Float64()
+	case string: // NaN and Inf, see jsonFloat
+		if f, err := strconv.ParseFloat(v, 64); err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			return f, nil
+		}
+		return 0, fmt.Errorf("thrift: invalid %s %s", t.Name, v)
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	}
+	return 0, fmt.Errorf("thrift: expect %s, got %T", t.Name, value)
+}
+
+func (c thriftConverter) fromStruct(def *ThriftStructDef, s *ThriftStruct) (map[string]interface{}, error) {
+	value := make(map[string]interface{}, len(s.Fields))
+	for _, field := range s.Fields {
+		f := def.FieldByID(field.ID)
+		if f == nil { // ignored, for compatibility with newer IDLs
+			continue
+		}
+		v, err := c.fromValue(f.Type, field.Type, field.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", def.Name, f.Name, err)
+		}
+		value[f.Name] = v
+	}
+	for _, f := range def.Fields {
+		if _, ok := value[f.Name]; f.Required && !ok {
+			return nil, fmt.Errorf("%w: %s.%s", ErrMissingRequiredField, def.Name, f.Name)
+		}
+	}
+	return value, nil
+}
+
+// fromValue converts a value of wire type tp in the generic tree to the Go value of type t
+func (c thriftConverter) fromValue(t *ThriftTypeRef, tp ThriftType, value interface{}) (interface{}, error) {
+	t = t.underlying()
+	if tp != t.wireType {
+		return nil, fmt.Errorf("thrift: expect %s, got %s", t.wireType, tp)
+	}
+	switch v := value.(type) {
+	case string:
+		if t.Name != "binary" {
+			return v, nil
+		} else if c.json {
+			return base64.StdEncoding.EncodeToString(stringToByteSlice(v)), nil
+		}
+		return []byte(v), nil
+	case [16]byte:
+		if c.json {
+			return formatUUID(v), nil
+		}
+		return v, nil
+	case float64:
+		if c.json {
+			return jsonFloat(v), nil
+		}
+		return v, nil
+	case *ThriftStruct:
+		return c.fromStruct(t.Struct, v)
+	case *ThriftList:
+		elems := make([]interface{}, 0, len(v.Elems))
+		for i, elem := range v.Elems {
+			e, err := c.fromValue(t.ValueType, v.ElemType, elem)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			elems = append(elems, e)
+		}
+		return elems, nil
+	case *ThriftMap:
+		return c.fromMap(t, v)
+	}
+	return value, nil
+}
+
+func (c thriftConverter) fromMap(t *ThriftTypeRef, m *ThriftMap) (interface{}, error) {
+	stringKeys := c.json || t.KeyType.WireType() == ThriftTypeString
+	strMap := make(map[string]interface{}, len(m.Entries))
+	anyMap := make(map[interface{}]interface{}, len(m.Entries))
+	for _, entry := range m.Entries {
+		k, err := c.fromValue(t.KeyType, m.KeyType, entry.Key)
+		if err != nil {
+			return nil, fmt.Errorf("[%v]: %w", entry.Key, err)
+		}
+		v, err := c.fromValue(t.ValueType, m.ValueType, entry.Value)
+		if err != nil {
+			return nil, fmt.Errorf("[%v]: %w", entry.Key, err)
+		}
+		if stringKeys {
+			key, err := thriftKeyString(k)
+			if err != nil {
+				return nil, err
+			}
+			strMap[key] = v
+		} else if reflect.TypeOf(k).Comparable() {
+			anyMap[k] = v
+		} else {
+			return nil, fmt.Errorf("thrift: map key of %s is not comparable, use JSON instead", t.KeyType.Name)
+		}
+	}
+	if stringKeys {
+		return strMap, nil
+	}
+	return anyMap, nil
+}
+
+// thriftKeyString converts a map key into string, in JSON for non-string types
+func thriftKeyString(key interface{}) (string, error) {
+	switch k := key.(type) {
+	case string:
+		return k, nil
+	case []byte:
+		return string(k), nil
+	}
+	buf, err := json.Marshal(key)
+	return string(buf), err
+}
+
+// parseUUID parses a uuid in the canonical form, or 32 hex digits
+func parseUUID(s string) (uuid [16]byte, err error) {
+	if len(s) == 36 && s[8] == '-' && s[13] == '-' && s[18] == '-' && s[23] == '-' {
+		s = s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+	}
+	if len(s) != 32 {
+		return uuid, fmt.Errorf("thrift: invalid uuid %q", s)
+	}
+	if _, err = hex.Decode(uuid[:], []byte(s)); err != nil {
+		return uuid, fmt.Errorf("thrift: invalid uuid %q", s)
+	}
+	return uuid, nil
+}
@@ -0,0 +1,232 @@
+package ttheader
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func testItem() map[string]interface{} {
+	return map[string]interface{}{
+		"id":     int32(1),
+		"name":   "one",
+		"color":  int32(10),
+		"data":   []byte{0xff, 0},
+		"uid":    [16]byte{1},
+		"scores": map[interface{}]interface{}{int32(1): 1.5},
+		"times":  []interface{}{int64(100)},
+		"base":   map[string]interface{}{"logID": "log"},
+		"choices": []interface{}{
+			map[string]interface{}{"num": int32(1)},
+			map[string]interface{}{"str": "s"},
+		},
+		"flag":  true,
+		"b":     int8(-1),
+		"small": int16(2),
+	}
+}
+
+func TestThriftStructDef_Encode(t *testing.T) {
+	item := loadTestIDL(t).Struct("Item")
+
+	t.Run("round-trip", func(t *testing.T) {
+		buf, err := item.Encode(testItem())
+		assert(t, err == nil, err)
+		tree, err := DecodeThriftStruct(buf)
+		assert(t, err == nil, err)
+		assert(t, tree.Field(1).Type == ThriftTypeI32 && tree.Field(1).Value == int32(1), tree.Field(1))
+		assert(t, tree.Field(7).Type == ThriftTypeSet, tree.Field(7))
+
+		value, err := item.Decode(buf)
+		assert(t, err == nil, err)
+		expected := testItem()
+		assert(t, len(value) == len(expected), value)
+		assert(t, value["scores"].(map[interface{}]interface{})[int32(1)] == 1.5, value["scores"])
+		delete(expected, "scores") // not supported by json
+		for name, v := range expected {
+			a, err := json.Marshal(v)
+			assert(t, err == nil, err)
+			b, _ := json.Marshal(value[name])
+			assert(t, bytes.Equal(a, b), name, string(a), string(b))
+		}
+	})
+	t.Run("conversion", func(t *testing.T) {
+		buf, err := item.Encode(map[string]interface{}{
+			"id":     1,       // int
+			"color":  "GREEN", // enum name
+			"data":   "raw",   // string for binary
+			"uid":    "01000000-0000-0000-0000-000000000000",
+			"scores": map[int]float32{1: 0.5, 2: 2}, // typed map
+			"times":  []int{1, 2},                   // typed slice
+			"b":      json.Number("-1"),             // json number
+			"small":  float64(2),                    // integral float
+			"name":   nil,                           // nil means unset
+		})
+		assert(t, err == nil, err)
+		value, err := item.Decode(buf)
+		assert(t, err == nil, err)
+		assert(t, value["color"] == int32(2), value["color"])
+		assert(t, string(value["data"].([]byte)) == "raw", value["data"])
+		assert(t, value["uid"] == [16]byte{1}, value["uid"])
+		assert(t, value["scores"].(map[interface{}]interface{})[int32(2)] == float64(2), value["scores"])
+		assert(t, value["b"] == int8(-1) && value["small"] == int16(2), value["b"], value["small"])
+		_, ok := value["name"]
+		assert(t, !ok, value["name"])
+	})
+
+	errorCases := []struct {
+		name    string
+		value   map[string]interface{}
+		message string
+	}{
+		{"missing-required", map[string]interface{}{}, "missing required field: Item.id"},
+		{"unknown-field", map[string]interface{}{"id": 1, "x": 1}, "unknown thrift field: Item.x"},
+		{"type-mismatch", map[string]interface{}{"id": "1"}, "Item.id: thrift: expect i32, got string"},
+		{"overflow", map[string]interface{}{"id": 1, "b": 128}, "Item.b: thrift: 128 overflows byte"},
+		{"fraction", map[string]interface{}{"id": 1.5}, "Item.id: thrift: invalid i32 1.5"},
+		{"unknown-enum", map[string]interface{}{"id": 1, "color": "X"}, "Item.color: thrift: unknown Color value X"},
+		{"invalid-uuid", map[string]interface{}{"id": 1, "uid": "x"}, "Item.uid: thrift: invalid uuid \"x\""},
+		{"list-elem", map[string]interface{}{"id": 1, "times": []interface{}{"x"}}, "Item.times: [0]: thrift: expect i64, got string"},
+		{"nested", map[string]interface{}{"id": 1, "base": map[string]interface{}{"logID": 1}}, "Item.base: Base.logID: thrift: expect string, got int"},
+		{"union", map[string]interface{}{"id": 1, "choices": []interface{}{map[string]interface{}{}}}, "union Choice should have exactly one field set, got 0"},
+	}
+	for _, c := range errorCases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := item.Encode(c.value)
+			assert(t, err != nil && strings.Contains(err.Error(), c.message), err)
+		})
+	}
+	t.Run("error-type", func(t *testing.T) {
+		_, err := item.Encode(map[string]interface{}{})
+		assert(t, errors.Is(err, ErrMissingRequiredField), err)
+		_, err = item.Encode(map[string]interface{}{"id": 1, "x": 1})
+		assert(t, errors.Is(err, ErrUnknownThriftField), err)
+	})
+}
+
+func TestThriftStructDef_Decode(t *testing.T) {
+	item := loadTestIDL(t).Struct("Item")
+	t.Run("unknown-field", func(t *testing.T) {
+		buf, err := (&ThriftStruct{Fields: []*ThriftField{
+			{ID: 1, Type: ThriftTypeI32, Value: int32(1)},
+			{ID: 100, Type: ThriftTypeString, Value: "ignored"},
+		}}).Bytes()
+		assert(t, err == nil, err)
+		value, err := item.Decode(buf)
+		assert(t, err == nil, err)
+		assert(t, len(value) == 1 && value["id"] == int32(1), value)
+	})
+	t.Run("type-mismatch", func(t *testing.T) {
+		buf, _ := (&ThriftStruct{Fields: []*ThriftField{{ID: 1, Type: ThriftTypeI64, Value: int64(1)}}}).Bytes()
+		_, err := item.Decode(buf)
+		assert(t, err != nil && err.Error() == "Item.id: thrift: expect i32, got i64", err)
+	})
+	t.Run("missing-required", func(t *testing.T) {
+		_, err := item.Decode([]byte{thriftStop})
+		assert(t, errors.Is(err, ErrMissingRequiredField), err)
+	})
+}
+
+func TestThriftMethodDef_Call(t *testing.T) {
+	idl := loadTestIDL(t)
+	echo := idl.Service("Echo").Method("echo")
+
+	t.Run("map", func(t *testing.T) {
+		args := map[string]interface{}{
+			"item":   map[string]interface{}{"id": int32(1)},
+			"groups": map[string]interface{}{"g": []interface{}{map[string]interface{}{"id": int32(2)}}},
+		}
+		payload, err := echo.EncodeCall(3, args)
+		assert(t, err == nil, err)
+		msg, value, err := echo.DecodeCall(payload)
+		assert(t, err == nil, err)
+		assert(t, msg.Name == "echo" && msg.Type == MessageTypeCall && msg.SeqID == 3, msg)
+		groups := value["groups"].(map[string]interface{})["g"].([]interface{})
+		assert(t, groups[0].(map[string]interface{})["id"] == int32(2), groups)
+	})
+	t.Run("json", func(t *testing.T) {
+		args := `{"item":{"data":"/wA=","id":1,"scores":{"1":1.5},"uid":"01000000-0000-0000-0000-000000000000"}}`
+		payload, err := echo.EncodeCallJSON(4, []byte(args))
+		assert(t, err == nil, err)
+		msg, value, err := echo.DecodeCallJSON(payload)
+		assert(t, err == nil, err)
+		assert(t, msg.SeqID == 4, msg)
+		assert(t, string(value) == args, string(value))
+	})
+	t.Run("json-nan-inf", func(t *testing.T) {
+		scores := map[interface{}]interface{}{int32(1): math.NaN(), int32(2): math.Inf(1), int32(3): math.Inf(-1)}
+		payload, err := echo.EncodeCall(5, map[string]interface{}{"item": map[string]interface{}{"id": 1, "scores": scores}})
+		assert(t, err == nil, err)
+		_, value, err := echo.DecodeCallJSON(payload)
+		assert(t, err == nil, err)
+		expected := `{"item":{"id":1,"scores":{"1":"NaN","2":"+Inf","3":"-Inf"}}}`
+		assert(t, string(value) == expected, string(value))
+		payload, err = echo.EncodeCallJSON(5, value)
+		assert(t, err == nil, err)
+		_, args, err := echo.DecodeCall(payload)
+		assert(t, err == nil, err)
+		decoded := args["item"].(map[string]interface{})["scores"].(map[interface{}]interface{})
+		assert(t, math.IsNaN(decoded[int32(1)].(float64)) && math.IsInf(decoded[int32(3)].(float64), -1), decoded)
+		_, err = echo.EncodeCallJSON(5, []byte(`{"item":{"id":1,"scores":{"1":"1.5"}}}`))
+		assert(t, err != nil && strings.HasSuffix(err.Error(), "Item.scores: [1]: thrift: invalid double 1.5"), err)
+	})
+	t.Run("oneway", func(t *testing.T) {
+		notify := idl.Service("Echo").Method("notify")
+		payload, err := notify.EncodeCall(5, map[string]interface{}{"msg": "hi"})
+		assert(t, err == nil, err)
+		msg, value, err := notify.DecodeCall(payload)
+		assert(t, err == nil, err)
+		assert(t, msg.Type == MessageTypeOneway && value["msg"] == "hi", msg, value)
+	})
+	t.Run("method-mismatch", func(t *testing.T) {
+		payload, _ := idl.Service("Echo").Method("ping").EncodeCall(1, nil)
+		_, _, err := echo.DecodeCall(payload)
+		assert(t, err != nil && err.Error() == "thrift: expect method echo, got ping", err)
+	})
+	t.Run("type-mismatch", func(t *testing.T) {
+		payload, _ := echo.EncodeReply(1, nil)
+		_, _, err := echo.DecodeCall(payload)
+		assert(t, err != nil && err.Error() == "thrift: unexpected message type reply", err)
+	})
+	t.Run("invalid-json", func(t *testing.T) {
+		_, err := echo.EncodeCallJSON(1, []byte("["))
+		assert(t, err != nil)
+	})
+}
+
+func TestThriftMethodDef_Reply(t *testing.T) {
+	echo := loadTestIDL(t).Service("Echo").Method("echo")
+
+	t.Run("success", func(t *testing.T) {
+		payload, err := echo.EncodeReply(1, map[string]interface{}{"success": map[string]interface{}{"id": int32(1)}})
+		assert(t, err == nil, err)
+		msg, result, err := echo.DecodeReply(payload)
+		assert(t, err == nil, err)
+		assert(t, msg.Type == MessageTypeReply, msg)
+		assert(t, result["success"].(map[string]interface{})["id"] == int32(1), result)
+	})
+	t.Run("declared-exception", func(t *testing.T) {
+		payload, err := echo.EncodeReplyJSON(2, []byte(`{"notFound":{"message":"no"}}`))
+		assert(t, err == nil, err)
+		_, result, err := echo.DecodeReplyJSON(payload)
+		assert(t, err == nil, err)
+		assert(t, string(result) == `{"notFound":{"message":"no"}}`, string(result))
+	})
+	t.Run("application-exception", func(t *testing.T) {
+		payload, err := NewExceptionWithType("echo", 3, "oops", ExceptionTypeInternalError).Bytes()
+		assert(t, err == nil, err)
+		msg, _, err := echo.DecodeReply(payload)
+		assert(t, msg.SeqID == 3, msg)
+		var exc *Exception
+		assert(t, errors.As(err, &exc) && exc.Message == "oops", err)
+		assert(t, errors.Is(err, ExceptionTypeInternalError), err)
+	})
+	t.Run("type-mismatch", func(t *testing.T) {
+		payload, _ := echo.EncodeCall(1, map[string]interface{}{})
+		_, _, err := echo.DecodeReply(payload)
+		assert(t, err != nil && err.Error() == "thrift: unexpected message type call", err)
+	})
+}
@@ -0,0 +1,1091 @@
+package ttheader
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// thrift IDL:
+// Document:    header* definition*
+// Header:      include "file.thrift" | cpp_include "file" | namespace scope name
+// Definition:  const type name = value | typedef type name | enum name { (name [= int])* }
+//              | (struct|union|exception) name { field* } | service name [extends name] { function* }
+// Field:       [id:] [required|optional] type name [= value] [annotations]
+// Function:    [oneway] (void|type) name ( field* ) [throws ( field* )] [annotations]
+// Annotations: ( (name [= "value"])* )
+// Definitions, fields, functions and annotations can be separated by ',' or ';'.
+
+// ThriftIDLError is an error in a thrift IDL file
+type ThriftIDLError struct {
+	Filename string
+	Line     int
+	Message  string
+}
+
+func (e *ThriftIDLError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Filename, e.Line, e.Message)
+}
+
+// ThriftIDL is a parsed thrift IDL file
+// Names of definitions in included files are qualified by the name of the included file, e.g. "base.Base".
+type ThriftIDL struct {
+	Filename   string
+	Namespaces map[string]string
+	// IncludePaths are the paths in include statements
+	IncludePaths []string
+	// Includes are the included files by name, i.e. the filename without directory and ".thrift"
+	Includes map[string]*ThriftIDL
+	Consts   map[string]*ThriftConstDef
+	Typedefs map[string]*ThriftTypedefDef
+	Enums    map[string]*ThriftEnumDef
+	// Structs contains structs, unions and exceptions
+	Structs  map[string]*ThriftStructDef
+	Services map[string]*ThriftServiceDef
+}
+
+// ThriftTypeRef is a reference to a type: a base type, a container or a user defined type
+type ThriftTypeRef struct {
+	// Name is the base type (e.g. "i32", "binary"), "list", "set", "map" or the name of a user defined type
+	Name string
+	// KeyType is the key type of a map
+	KeyType *ThriftTypeRef
+	// ValueType is the value type of a map, or the element type of a list/set
+	ValueType   *ThriftTypeRef
+	Annotations map[string]string
+
+	// resolved definition for user defined types
+	Typedef *ThriftTypedefDef
+	Struct  *ThriftStructDef
+	Enum    *ThriftEnumDef
+
+	wireType ThriftType
+	line     int
+}
+
+// ThriftConstDef is a const definition
+// Value is int64, float64, string, bool, []interface{} (list) or []*ThriftMapEntry (map),
+// and enum values are resolved into int64.
+type ThriftConstDef struct {
+	Name  string
+	Type  *ThriftTypeRef
+	Value interface{}
+}
+
+// ThriftTypedefDef is a typedef definition
+type ThriftTypedefDef struct {
+	Name        string
+	Type        *ThriftTypeRef
+	Annotations map[string]string
+}
+
+// ThriftEnumDef is an enum definition
+type ThriftEnumDef struct {
+	Name        string
+	Values      []*ThriftEnumValue
+	Annotations map[string]string
+}
+
+// ThriftEnumValue is a value of an enum
+type ThriftEnumValue struct {
+	Name        string
+	Value       int32
+	Annotations map[string]string
+}
+
+// ThriftStructDef is a struct, union or exception definition
+type ThriftStructDef struct {
+	// Kind is "struct", "union" or "exception"
+	Kind        string
+	Name        string
+	Fields      []*ThriftFieldDef
+	Annotations map[string]string
+}
+
+// ThriftFieldDef is a field of a struct, or an argument/exception of a function
+// Fields without explicit ids get negative ids, as the thrift compiler does.
+type ThriftFieldDef struct {
+	ID          int16
+	Name        string
+	Type        *ThriftTypeRef
+	Required    bool
+	Optional    bool
+	Default     interface{}
+	Annotations map[string]string
+}
+
+// ThriftServiceDef is a service definition
+type ThriftServiceDef struct {
+	Name        string
+	Extends     string
+	Base        *ThriftServiceDef
+	Methods     []*ThriftMethodDef
+	Annotations map[string]string
+}
+
+// ThriftMethodDef is a function of a service
+type ThriftMethodDef struct {
+	Name   string
+	Oneway bool
+	// Result is nil for void functions
+	Result      *ThriftTypeRef
+	Args        []*ThriftFieldDef
+	Throws      []*ThriftFieldDef
+	Annotations map[string]string
+
+	args   *ThriftStructDef // {args...}
+	result *ThriftStructDef // {0: success, throws...}
+}
+
+var thriftBaseTypes = map[string]ThriftType{
+	"bool":   ThriftTypeBool,
+	"byte":   ThriftTypeByte,
+	"i8":     ThriftTypeByte,
+	"i16":    ThriftTypeI16,
+	"i32":    ThriftTypeI32,
+	"i64":    ThriftTypeI64,
+	"double": ThriftTypeDouble,
+	"string": ThriftTypeString,
+	"binary": ThriftTypeString,
+	"uuid":   ThriftTypeUUID,
+}
+
+// WireType returns the type in thrift binary, following typedefs; enums are i32
+func (t *ThriftTypeRef) WireType() ThriftType {
+	return t.underlying().wireType
+}
+
+// underlying follows typedefs to the actual type
+func (t *ThriftTypeRef) underlying() *ThriftTypeRef {
+	for t.Typedef != nil {
+		t = t.Typedef.Type
+	}
+	return t
+}
+
+// Value returns the value of the enum by name
+func (e *ThriftEnumDef) Value(name string) (int32, bool) {
+	for _, v := range e.Values {
+		if v.Name == name {
+			return v.Value, true
+		}
+	}
+	return 0, false
+}
+
+// ValueName returns the name of the enum value
+func (e *ThriftEnumDef) ValueName(value int32) (string, bool) {
+	for _, v := range e.Values {
+		if v.Value == value {
+			return v.Name, true
+		}
+	}
+	return "", false
+}
+
+// Field returns the field by name, or nil if not found
+func (s *ThriftStructDef) Field(name string) *ThriftFieldDef {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// FieldByID returns the field by id, or nil if not found
+func (s *ThriftStructDef) FieldByID(id int16) *ThriftFieldDef {
+	for _, f := range s.Fields {
+		if f.ID == id {
+			return f
+		}
+	}
+	return nil
+}
+
+// Method returns the function by name, including functions of the base services
+func (s *ThriftServiceDef) Method(name string) *ThriftMethodDef {
+	for ; s != nil; s = s.Base {
+		for _, m := range s.Methods {
+			if m.Name == name {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+// Struct returns the struct/union/exception by (qualified) name, or nil if not found
+func (idl *ThriftIDL) Struct(name string) *ThriftStructDef {
+	scope, local := idl.lookup(name)
+	return scope.Structs[local]
+}
+
+// Enum returns the enum by (qualified) name, or nil if not found
+func (idl *ThriftIDL) Enum(name string) *ThriftEnumDef {
+	scope, local := idl.lookup(name)
+	return scope.Enums[local]
+}
+
+// Service returns the service by (qualified) name, or nil if not found
+func (idl *ThriftIDL) Service(name string) *ThriftServiceDef {
+	scope, local := idl.lookup(name)
+	return scope.Services[local]
+}
+
+// lookup returns the file and the local name for a name which may be qualified by include names
+func (idl *ThriftIDL) lookup(name string) (*ThriftIDL, string) {
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if inc := idl.Includes[name[:i]]; inc != nil {
+			return inc.lookup(name[i+1:])
+		}
+	}
+	return idl, name
+}
+
+// ParseThriftIDL parses a thrift IDL file without includes; use LoadThriftIDL for files with includes
+func ParseThriftIDL(filename string, content []byte) (*ThriftIDL, error) {
+	idl, err := parseThriftIDL(filename, content)
+	if err != nil {
+		return nil, err
+	}
+	if len(idl.IncludePaths) > 0 {
+		return nil, fmt.Errorf("%s: includes are not supported in ParseThriftIDL, use LoadThriftIDL", filename)
+	}
+	if err = idl.resolve(); err != nil {
+		return nil, err
+	}
+	return idl, nil
+}
+
+// LoadThriftIDL loads a thrift IDL file and all its includes, which are searched in the directory
+// of the including file, and then in includeDirs
+func LoadThriftIDL(path string, includeDirs ...string) (*ThriftIDL, error) {
+	loader := &thriftIDLLoader{
+		includeDirs: includeDirs,
+		loaded:      map[string]*ThriftIDL{},
+		loading:     map[string]bool{},
+	}
+	return loader.load(path)
+}
+
+type thriftIDLLoader struct {
+	includeDirs []string
+	loaded      map[string]*ThriftIDL // by absolute path, so that a file included many times is loaded once
+	loading     map[string]bool
+}
+
+func (l *thriftIDLLoader) load(path string) (*ThriftIDL, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if idl, ok := l.loaded[abs]; ok {
+		return idl, nil
+	}
+	if l.loading[abs] {
+		return nil, fmt.Errorf("%s: circular include", path)
+	}
+	l.loading[abs] = true
+	defer delete(l.loading, abs)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	idl, err := parseThriftIDL(path, content)
+	if err != nil {
+		return nil, err
+	}
+	for _, include := range idl.IncludePaths {
+		included, err := l.load(l.find(filepath.Dir(path), include))
+		if err != nil {
+			return nil, err
+		}
+		idl.Includes[strings.TrimSuffix(filepath.Base(include), ".thrift")] = included
+	}
+	if err = idl.resolve(); err != nil {
+		return nil, err
+	}
+	l.loaded[abs] = idl
+	return idl, nil
+}
+
+// find returns the path of the included file; it's left as is if not found, for a meaningful error
+func (l *thriftIDLLoader) find(dir, include string) string {
+	if filepath.IsAbs(include) {
+		return include
+	}
+	for _, d := range append([]string{dir}, l.includeDirs...) {
+		path := filepath.Join(d, include)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(dir, include)
+}
+
+// lexer
+
+const (
+	thriftTokenEOF = iota
+	thriftTokenIdent
+	thriftTokenInt
+	thriftTokenDouble
+	thriftTokenString
+	thriftTokenSymbol
+)
+
+type thriftToken struct {
+	kind  int
+	text  string
+	value interface{} // int64 or float64 for numbers
+	line  int
+}
+
+func lexThriftIDL(filename string, src []byte) ([]thriftToken, error) {
+	var tokens []thriftToken
+	line := 1
+	fail := func(format string, args ...interface{}) ([]thriftToken, error) {
+		return nil, &ThriftIDLError{Filename: filename, Line: line, Message: fmt.Sprintf(format, args...)}
+	}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#' || bytes.HasPrefix(src[i:], []byte("//")):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case bytes.HasPrefix(src[i:], []byte("/*")):
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				return fail("unterminated comment")
+			}
+			line += bytes.Count(src[i:i+2+end], []byte("\n"))
+			i += end + 4
+		case c == '"' || c == '\'':
+			start := line
+			var s []byte
+			j := i + 1
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+					switch src[j] {
+					case 'n':
+						s = append(s, '\n')
+					case 't':
+						s = append(s, '\t')
+					case 'r':
+						s = append(s, '\r')
+					default:
+						s = append(s, src[j])
+					}
+					continue
+				}
+				if src[j] == '\n' {
+					line++
+				}
+				s = append(s, src[j])
+			}
+			if j >= len(src) {
+				return fail("unterminated string")
+			}
+			tokens = append(tokens, thriftToken{kind: thriftTokenString, text: string(s), line: start})
+			i = j + 1
+		case isThriftIdentStart(c):
+			j := i + 1
+			for j < len(src) && (isThriftIdentStart(src[j]) || isDigit(src[j]) || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, thriftToken{kind: thriftTokenIdent, text: string(src[i:j]), line: line})
+			i = j
+		case isDigit(c) || ((c == '-' || c == '+') && i+1 < len(src) && isDigit(src[i+1])):
+			j := i + 1
+			for j < len(src) && (isDigit(src[j]) || isThriftIdentStart(src[j]) || src[j] == '.' ||
+				((src[j] == '-' || src[j] == '+') && (src[j-1] == 'e' || src[j-1] == 'E'))) {
+				j++
+			}
+			text := string(src[i:j])
+			if v, err := parseThriftInt(text); err == nil {
+				tokens = append(tokens, thriftToken{kind: thriftTokenInt, text: text, value: v, line: line})
+			} else if strings.ContainsAny(text, "xX_") { // no hex doubles or underscores in thrift
+				return fail("invalid number %q", text)
+			} else if v, err := strconv.ParseFloat(text, 64); err == nil {
+				tokens = append(tokens, thriftToken{kind: thriftTokenDouble, text: text, value: v, line: line})
+			} else {
+				return fail("invalid number %q", text)
+			}
+			i = j
+		case strings.IndexByte("{}()<>[],;:=*", c) >= 0:
+			tokens = append(tokens, thriftToken{kind: thriftTokenSymbol, text: string(c), line: line})
+			i++
+		default:
+			return fail("unexpected character %q", c)
+		}
+	}
+	return append(tokens, thriftToken{kind: thriftTokenEOF, line: line}), nil
+}
+
+// parseThriftInt parses an integer literal of thrift: decimal (even with leading zeros), or hex with 0x/0X
+func parseThriftInt(text string) (int64, error) {
+	sign, digits := "", text
+	if digits[0] == '+' || digits[0] == '-' {
+		sign, digits = strings.TrimPrefix(digits[:1], "+"), digits[1:]
+	}
+	if len(digits) > 2 && digits[0] == '0' && (digits[1] == 'x' || digits[1] == 'X') {
+		return strconv.ParseInt(sign+digits[2:], 16, 64)
+	}
+	return strconv.ParseInt(sign+digits, 10, 64)
+}
+
+func isThriftIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// parser
+
+type thriftParser struct {
+	filename string
+	tokens   []thriftToken
+	pos      int
+}
+
+// thriftIdent is an identifier in const values, e.g. an enum value, which is resolved after parsing
+type thriftIdent string
+
+func parseThriftIDL(filename string, content []byte) (*ThriftIDL, error) {
+	tokens, err := lexThriftIDL(filename, content)
+	if err != nil {
+		return nil, err
+	}
+	p := &thriftParser{filename: filename, tokens: tokens}
+	idl := &ThriftIDL{
+		Filename:   filename,
+		Namespaces: map[string]string{},
+		Includes:   map[string]*ThriftIDL{},
+		Consts:     map[string]*ThriftConstDef{},
+		Typedefs:   map[string]*ThriftTypedefDef{},
+		Enums:      map[string]*ThriftEnumDef{},
+		Structs:    map[string]*ThriftStructDef{},
+		Services:   map[string]*ThriftServiceDef{},
+	}
+	if err = p.document(idl); err != nil {
+		return nil, err
+	}
+	return idl, nil
+}
+
+func (p *thriftParser) peek() thriftToken {
+	return p.tokens[p.pos]
+}
+
+func (p *thriftParser) next() thriftToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != thriftTokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it's the given symbol or keyword
+func (p *thriftParser) accept(text string) bool {
+	tok := p.peek()
+	if (tok.kind == thriftTokenSymbol || tok.kind == thriftTokenIdent) && tok.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *thriftParser) expect(text string) error {
+	if !p.accept(text) {
+		return p.unexpected(text)
+	}
+	return nil
+}
+
+func (p *thriftParser) ident() (string, error) {
+	if p.peek().kind != thriftTokenIdent {
+		return "", p.unexpected("identifier")
+	}
+	return p.next().text, nil
+}
+
+func (p *thriftParser) skipSeparator() {
+	_ = p.accept(",") || p.accept(";")
+}
+
+func (p *thriftParser) errorf(line int, format string, args ...interface{}) error {
+	return &ThriftIDLError{Filename: p.filename, Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *thriftParser) unexpected(expected string) error {
+	tok := p.peek()
+	if tok.kind == thriftTokenEOF {
+		return p.errorf(tok.line, "expect %s, got EOF", expected)
+	}
+	return p.errorf(tok.line, "expect %s, got %q", expected, tok.text)
+}
+
+func (p *thriftParser) document(idl *ThriftIDL) error {
+	defined := map[string]bool{}
+	for p.peek().kind != thriftTokenEOF {
+		tok := p.peek()
+		name, err := p.definition(idl, tok)
+		if err != nil {
+			return err
+		}
+		if name != "" {
+			if defined[name] {
+				return p.errorf(tok.line, "duplicate definition %q", name)
+			}
+			defined[name] = true
+		}
+		p.skipSeparator()
+	}
+	return nil
+}
+
+// definition parses a header or a definition, returning the name defined
+func (p *thriftParser) definition(idl *ThriftIDL, tok thriftToken) (name string, err error) {
+	if tok.kind != thriftTokenIdent {
+		return "", p.unexpected("definition")
+	}
+	p.next()
+	switch tok.text {
+	case "include", "cpp_include":
+		path := p.next()
+		if path.kind != thriftTokenString {
+			return "", p.errorf(path.line, "expect include path")
+		}
+		if tok.text == "include" {
+			idl.IncludePaths = append(idl.IncludePaths, path.text)
+		}
+		return "", nil
+	case "namespace":
+		scope := p.next()
+		if scope.kind != thriftTokenIdent && scope.text != "*" {
+			return "", p.errorf(scope.line, "expect namespace scope")
+		}
+		if idl.Namespaces[scope.text], err = p.ident(); err != nil {
+			return "", err
+		}
+		_, err = p.annotations()
+		return "", err
+	case "const":
+		c := &ThriftConstDef{}
+		if c.Type, err = p.typeRef(); err != nil {
+			return "", err
+		}
+		if c.Name, err = p.ident(); err != nil {
+			return "", err
+		}
+		if err = p.expect("="); err != nil {
+			return "", err
+		}
+		if c.Value, err = p.constValue(); err != nil {
+			return "", err
+		}
+		idl.Consts[c.Name] = c
+		return c.Name, nil
+	case "typedef":
+		t := &ThriftTypedefDef{}
+		if t.Type, err = p.typeRef(); err != nil {
+			return "", err
+		}
+		if t.Name, err = p.ident(); err != nil {
+			return "", err
+		}
+		if t.Annotations, err = p.annotations(); err != nil {
+			return "", err
+		}
+		idl.Typedefs[t.Name] = t
+		return t.Name, nil
+	case "enum":
+		e, err := p.enum()
+		if err != nil {
+			return "", err
+		}
+		idl.Enums[e.Name] = e
+		return e.Name, nil
+	case "struct", "union", "exception":
+		s, err := p.structDef(tok.text)
+		if err != nil {
+			return "", err
+		}
+		idl.Structs[s.Name] = s
+		return s.Name, nil
+	case "service":
+		s, err := p.service()
+		if err != nil {
+			return "", err
+		}
+		idl.Services[s.Name] = s
+		return s.Name, nil
+	default:
+		return "", p.errorf(tok.line, "unexpected %q", tok.text)
+	}
+}
+
+func (p *thriftParser) typeRef() (t *ThriftTypeRef, err error) {
+	tok := p.peek()
+	name, err := p.ident()
+	if err != nil {
+		return nil, p.unexpected("type")
+	}
+	t = &ThriftTypeRef{Name: name, line: tok.line}
+	switch name {
+	case "list", "set":
+		if err = p.expect("<"); err != nil {
+			return nil, err
+		}
+		if t.ValueType, err = p.typeRef(); err != nil {
+			return nil, err
+		}
+		if err = p.expect(">"); err != nil {
+			return nil, err
+		}
+	case "map":
+		if err = p.expect("<"); err != nil {
+			return nil, err
+		}
+		if t.KeyType, err = p.typeRef(); err != nil {
+			return nil, err
+		}
+		if err = p.expect(","); err != nil {
+			return nil, err
+		}
+		if t.ValueType, err = p.typeRef(); err != nil {
+			return nil, err
+		}
+		if err = p.expect(">"); err != nil {
+			return nil, err
+		}
+	}
+	if t.Annotations, err = p.annotations(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (p *thriftParser) annotations() (map[string]string, error) {
+	if !p.accept("(") {
+		return nil, nil
+	}
+	annotations := map[string]string{}
+	for !p.accept(")") {
+		key, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		value := ""
+		if p.accept("=") {
+			tok := p.next()
+			if tok.kind != thriftTokenString {
+				return nil, p.errorf(tok.line, "expect annotation value of %q", key)
+			}
+			value = tok.text
+		}
+		annotations[key] = value
+		p.skipSeparator()
+	}
+	return annotations, nil
+}
+
+func (p *thriftParser) constValue() (interface{}, error) {
+	tok := p.peek()
+	if tok.kind == thriftTokenEOF || (tok.kind == thriftTokenSymbol && tok.text != "[" && tok.text != "{") {
+		return nil, p.unexpected("const value")
+	}
+	p.next()
+	switch tok.kind {
+	case thriftTokenInt, thriftTokenDouble:
+		return tok.value, nil
+	case thriftTokenString:
+		return tok.text, nil
+	case thriftTokenIdent:
+		switch tok.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return thriftIdent(tok.text), nil
+	}
+	if tok.text == "[" {
+		list := []interface{}{}
+		for !p.accept("]") {
+			v, err := p.constValue()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			p.skipSeparator()
+		}
+		return list, nil
+	}
+	entries := []*ThriftMapEntry{}
+	for !p.accept("}") {
+		entry := &ThriftMapEntry{}
+		var err error
+		if entry.Key, err = p.constValue(); err != nil {
+			return nil, err
+		}
+		if err = p.expect(":"); err != nil {
+			return nil, err
+		}
+		if entry.Value, err = p.constValue(); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+		p.skipSeparator()
+	}
+	return entries, nil
+}
+
+func (p *thriftParser) enum() (e *ThriftEnumDef, err error) {
+	e = &ThriftEnumDef{}
+	if e.Name, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err = p.expect("{"); err != nil {
+		return nil, err
+	}
+	next := int64(0)
+	for !p.accept("}") {
+		v := &ThriftEnumValue{}
+		line := p.peek().line
+		if v.Name, err = p.ident(); err != nil {
+			return nil, err
+		}
+		if p.accept("=") {
+			tok := p.next()
+			if tok.kind != thriftTokenInt {
+				return nil, p.errorf(tok.line, "expect int value of %q", v.Name)
+			}
+			next = tok.value.(int64)
+		}
+		if next < math.MinInt32 || next > math.MaxInt32 {
+			return nil, p.errorf(line, "enum value %s out of range", v.Name)
+		}
+		v.Value = int32(next)
+		next++
+		if v.Annotations, err = p.annotations(); err != nil {
+			return nil, err
+		}
+		e.Values = append(e.Values, v)
+		p.skipSeparator()
+	}
+	if e.Annotations, err = p.annotations(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (p *thriftParser) structDef(kind string) (s *ThriftStructDef, err error) {
+	s = &ThriftStructDef{Kind: kind}
+	if s.Name, err = p.ident(); err != nil {
+		return nil, err
+	}
+	p.accept("xsd_all")
+	if err = p.expect("{"); err != nil {
+		return nil, err
+	}
+	if s.Fields, err = p.fields("}"); err != nil {
+		return nil, err
+	}
+	if s.Annotations, err = p.annotations(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// fields parses fields until the end symbol, checking duplicate ids and names
+func (p *thriftParser) fields(end string) ([]*ThriftFieldDef, error) {
+	var fields []*ThriftFieldDef
+	ids, names := map[int16]bool{}, map[string]bool{}
+	autoID := int16(0)
+	for !p.accept(end) {
+		line := p.peek().line
+		f, err := p.field(&autoID)
+		if err != nil {
+			return nil, err
+		}
+		if ids[f.ID] || names[f.Name] {
+			return nil, p.errorf(line, "duplicate field %d: %s", f.ID, f.Name)
+		}
+		ids[f.ID], names[f.Name] = true, true
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func (p *thriftParser) field(autoID *int16) (f *ThriftFieldDef, err error) {
+	f = &ThriftFieldDef{}
+	if tok := p.peek(); tok.kind == thriftTokenInt {
+		p.next()
+		id := tok.value.(int64)
+		if id < math.MinInt16 || id > math.MaxInt16 {
+			return nil, p.errorf(tok.line, "field id %d out of range", id)
+		}
+		f.ID = int16(id)
+		if err = p.expect(":"); err != nil {
+			return nil, err
+		}
+	} else {
+		*autoID--
+		f.ID = *autoID
+	}
+	if p.accept("required") {
+		f.Required = true
+	} else if p.accept("optional") {
+		f.Optional = true
+	}
+	if f.Type, err = p.typeRef(); err != nil {
+		return nil, err
+	}
+	if f.Name, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if p.accept("=") {
+		if f.Default, err = p.constValue(); err != nil {
+			return nil, err
+		}
+	}
+	if f.Annotations, err = p.annotations(); err != nil {
+		return nil, err
+	}
+	p.skipSeparator()
+	return f, nil
+}
+
+func (p *thriftParser) service() (s *ThriftServiceDef, err error) {
+	s = &ThriftServiceDef{}
+	if s.Name, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if p.accept("extends") {
+		if s.Extends, err = p.ident(); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.expect("{"); err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for !p.accept("}") {
+		line := p.peek().line
+		m, err := p.method()
+		if err != nil {
+			return nil, err
+		}
+		if names[m.Name] {
+			return nil, p.errorf(line, "duplicate function %q", m.Name)
+		}
+		names[m.Name] = true
+		s.Methods = append(s.Methods, m)
+	}
+	if s.Annotations, err = p.annotations(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (p *thriftParser) method() (m *ThriftMethodDef, err error) {
+	m = &ThriftMethodDef{Oneway: p.accept("oneway")}
+	if !p.accept("void") {
+		if m.Result, err = p.typeRef(); err != nil {
+			return nil, err
+		}
+	}
+	if m.Name, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err = p.expect("("); err != nil {
+		return nil, err
+	}
+	if m.Args, err = p.fields(")"); err != nil {
+		return nil, err
+	}
+	if p.accept("throws") {
+		if err = p.expect("("); err != nil {
+			return nil, err
+		}
+		if m.Throws, err = p.fields(")"); err != nil {
+			return nil, err
+		}
+	}
+	if m.Annotations, err = p.annotations(); err != nil {
+		return nil, err
+	}
+	p.skipSeparator()
+	return m, nil
+}
+
+// resolution
+
+// resolve resolves type references and const values, after includes are loaded
+func (idl *ThriftIDL) resolve() error {
+	for _, c := range idl.Consts {
+		if err := idl.resolveConst(c, 0); err != nil {
+			return err
+		}
+	}
+	for _, t := range idl.Typedefs {
+		if err := idl.resolveType(t.Type, 0); err != nil {
+			return err
+		}
+	}
+	for _, s := range idl.Structs {
+		if err := idl.resolveFields(s.Fields); err != nil {
+			return err
+		}
+	}
+	for _, s := range idl.Services {
+		if s.Extends != "" {
+			if s.Base = idl.Service(s.Extends); s.Base == nil {
+				return fmt.Errorf("%s: unknown service %q", idl.Filename, s.Extends)
+			}
+		}
+		for _, m := range s.Methods {
+			if err := idl.resolveMethod(m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (idl *ThriftIDL) resolveMethod(m *ThriftMethodDef) error {
+	if m.Result != nil {
+		if err := idl.resolveType(m.Result, 0); err != nil {
+			return err
+		}
+	}
+	if err := idl.resolveFields(m.Args); err != nil {
+		return err
+	}
+	if err := idl.resolveFields(m.Throws); err != nil {
+		return err
+	}
+	m.args = &ThriftStructDef{Kind: "struct", Name: m.Name + "_args", Fields: m.Args}
+	m.result = &ThriftStructDef{Kind: "struct", Name: m.Name + "_result"}
+	if m.Result != nil {
+		m.result.Fields = append(m.result.Fields, &ThriftFieldDef{ID: 0, Name: "success", Type: m.Result, Optional: true})
+	}
+	for _, f := range m.Throws {
+		if t := f.Type.underlying(); t.Struct == nil || t.Struct.Kind != "exception" {
+			return &ThriftIDLError{Filename: idl.Filename, Line: f.Type.line, Message: fmt.Sprintf("%q is not an exception", f.Type.Name)}
+		}
+		m.result.Fields = append(m.result.Fields, &ThriftFieldDef{ID: f.ID, Name: f.Name, Type: f.Type, Optional: true})
+	}
+	return nil
+}
+
+func (idl *ThriftIDL) resolveFields(fields []*ThriftFieldDef) (err error) {
+	for _, f := range fields {
+		if err = idl.resolveType(f.Type, 0); err != nil {
+			return err
+		}
+		if f.Default, err = idl.resolveConstValue(f.Default, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveType resolves user defined types, and the wire type of base types and containers
+func (idl *ThriftIDL) resolveType(t *ThriftTypeRef, depth int) error {
+	if depth > maxThriftDepth {
+		return &ThriftIDLError{Filename: idl.Filename, Line: t.line, Message: fmt.Sprintf("type %q is too deep or circular", t.Name)}
+	}
+	if tp, ok := thriftBaseTypes[t.Name]; ok {
+		t.wireType = tp
+		return nil
+	}
+	switch t.Name {
+	case "list", "set", "map":
+		t.wireType = map[string]ThriftType{"list": ThriftTypeList, "set": ThriftTypeSet, "map": ThriftTypeMap}[t.Name]
+		if t.KeyType != nil {
+			if err := idl.resolveType(t.KeyType, depth+1); err != nil {
+				return err
+			}
+		}
+		return idl.resolveType(t.ValueType, depth+1)
+	}
+	scope, local := idl.lookup(t.Name)
+	if typedef := scope.Typedefs[local]; typedef != nil {
+		t.Typedef = typedef
+		return scope.resolveType(typedef.Type, depth+1)
+	} else if s := scope.Structs[local]; s != nil {
+		t.Struct, t.wireType = s, ThriftTypeStruct
+		return nil
+	} else if e := scope.Enums[local]; e != nil {
+		t.Enum, t.wireType = e, ThriftTypeI32
+		return nil
+	}
+	return &ThriftIDLError{Filename: idl.Filename, Line: t.line, Message: fmt.Sprintf("unknown type %q", t.Name)}
+}
+
+func (idl *ThriftIDL) resolveConst(c *ThriftConstDef, depth int) (err error) {
+	if err = idl.resolveType(c.Type, 0); err != nil {
+		return err
+	}
+	c.Value, err = idl.resolveConstValue(c.Value, depth)
+	return err
+}
+
+// resolveConstValue replaces identifiers in the value with the values of consts or enums
+func (idl *ThriftIDL) resolveConstValue(value interface{}, depth int) (interface{}, error) {
+	if depth > maxThriftDepth {
+		return nil, fmt.Errorf("%s: const value is too deep or circular", idl.Filename)
+	}
+	var err error
+	switch v := value.(type) {
+	case thriftIdent:
+		scope, local := idl.lookup(string(v))
+		if c := scope.Consts[local]; c != nil {
+			if err = scope.resolveConst(c, depth+1); err != nil {
+				return nil, err
+			}
+			return c.Value, nil
+		}
+		if i := strings.LastIndexByte(local, '.'); i > 0 {
+			if e := scope.Enums[local[:i]]; e != nil {
+				if value, ok := e.Value(local[i+1:]); ok {
+					return int64(value), nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("%s: unknown identifier %q", idl.Filename, string(v))
+	case []interface{}:
+		for i := range v {
+			if v[i], err = idl.resolveConstValue(v[i], depth+1); err != nil {
+				return nil, err
+			}
+		}
+	case []*ThriftMapEntry:
+		for _, entry := range v {
+			if entry.Key, err = idl.resolveConstValue(entry.Key, depth+1); err != nil {
+				return nil, err
+			}
+			if entry.Value, err = idl.resolveConstValue(entry.Value, depth+1); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,239 @@
+package ttheader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testBaseIDL = `
+namespace go base
+
+struct Base {
+	1: string logID
+}
+
+service BaseService {
+	string ping()
+}
+`
+
+const testEchoIDL = `
+include "base.thrift"
+namespace go example.echo
+namespace * example
+
+const i32 MaxSize = 0x400
+const list<string> Names = ["a", 'b']
+const map<string, double> Weights = {"a": 1.5; "b": -2e3}
+const Color DefaultColor = Color.RED
+
+typedef i64 Timestamp
+typedef map<string, list<Item>> ItemGroups
+
+# enum values
+enum Color {
+	RED = 1,
+	GREEN,
+	BLUE = 10 (go.name = "Blue")
+}
+
+/*
+ * all types
+ */
+struct Item {
+	1: required i32 id
+	2: optional string name = "item", // trailing comment
+	3: Color color = Color.GREEN
+	4: binary data
+	5: uuid uid
+	6: map<i32, double> scores
+	7: set<Timestamp> times (api.note = "set")
+	8: base.Base base
+	9: list<Choice> choices
+	10: bool flag
+	11: byte b
+	12: i16 small
+} (api.table = "items")
+
+union Choice {
+	1: i32 num;
+	2: string str;
+}
+
+exception NotFound {
+	1: string message
+}
+
+service Echo extends base.BaseService {
+	Item echo(1: Item item, 2: ItemGroups groups) throws (1: NotFound notFound) (api.get = "/echo")
+	oneway void notify(1: string msg),
+}
+`
+
+// loadTestIDL loads the echo IDL, with base.thrift in a separate include dir
+func loadTestIDL(t *testing.T) *ThriftIDL {
+	dir := t.TempDir()
+	includeDir := filepath.Join(dir, "include")
+	assert(t, os.Mkdir(includeDir, 0o755) == nil)
+	assert(t, os.WriteFile(filepath.Join(includeDir, "base.thrift"), []byte(testBaseIDL), 0o644) == nil)
+	assert(t, os.WriteFile(filepath.Join(dir, "echo.thrift"), []byte(testEchoIDL), 0o644) == nil)
+	idl, err := LoadThriftIDL(filepath.Join(dir, "echo.thrift"), includeDir)
+	assert(t, err == nil, err)
+	return idl
+}
+
+func TestLoadThriftIDL(t *testing.T) {
+	idl := loadTestIDL(t)
+
+	t.Run("header", func(t *testing.T) {
+		assert(t, idl.Namespaces["go"] == "example.echo" && idl.Namespaces["*"] == "example", idl.Namespaces)
+		assert(t, len(idl.IncludePaths) == 1 && idl.IncludePaths[0] == "base.thrift", idl.IncludePaths)
+		assert(t, idl.Includes["base"] != nil && idl.Includes["base"].Namespaces["go"] == "base")
+		assert(t, idl.Struct("base.Base") != nil)
+		assert(t, idl.Service("base.BaseService") != nil)
+	})
+	t.Run("const", func(t *testing.T) {
+		assert(t, idl.Consts["MaxSize"].Value == int64(1024), idl.Consts["MaxSize"].Value)
+		names := idl.Consts["Names"].Value.([]interface{})
+		assert(t, len(names) == 2 && names[0] == "a" && names[1] == "b", names)
+		weights := idl.Consts["Weights"].Value.([]*ThriftMapEntry)
+		assert(t, len(weights) == 2 && weights[1].Key == "b" && weights[1].Value == -2e3, weights)
+		assert(t, idl.Consts["DefaultColor"].Value == int64(1), idl.Consts["DefaultColor"].Value)
+	})
+	t.Run("enum", func(t *testing.T) {
+		color := idl.Enum("Color")
+		assert(t, len(color.Values) == 3)
+		v, ok := color.Value("GREEN")
+		assert(t, ok && v == 2, v)
+		name, ok := color.ValueName(10)
+		assert(t, ok && name == "BLUE", name)
+		assert(t, color.Values[2].Annotations["go.name"] == "Blue", color.Values[2].Annotations)
+	})
+	t.Run("struct", func(t *testing.T) {
+		item := idl.Struct("Item")
+		assert(t, item.Kind == "struct" && len(item.Fields) == 12, item)
+		assert(t, item.Annotations["api.table"] == "items", item.Annotations)
+		assert(t, item.Field("id").Required && item.Field("name").Optional)
+		assert(t, item.Field("name").Default == "item", item.Field("name").Default)
+		assert(t, item.Field("color").Default == int64(2), item.Field("color").Default)
+		assert(t, item.Field("color").Type.Enum == idl.Enum("Color"))
+		assert(t, item.Field("color").Type.WireType() == ThriftTypeI32)
+		assert(t, item.Field("data").Type.WireType() == ThriftTypeString)
+		times := item.Field("times").Type
+		assert(t, times.WireType() == ThriftTypeSet && times.ValueType.WireType() == ThriftTypeI64, times)
+		assert(t, times.ValueType.Typedef == idl.Typedefs["Timestamp"])
+		assert(t, item.Field("times").Annotations["api.note"] == "set", item.Field("times").Annotations)
+		assert(t, item.Field("base").Type.Struct == idl.Struct("base.Base"))
+		assert(t, item.FieldByID(8) == item.Field("base") && item.FieldByID(13) == nil)
+		assert(t, idl.Struct("Choice").Kind == "union" && idl.Struct("NotFound").Kind == "exception")
+	})
+	t.Run("service", func(t *testing.T) {
+		echo := idl.Service("Echo")
+		assert(t, echo.Extends == "base.BaseService" && echo.Base == idl.Service("base.BaseService"))
+		m := echo.Method("echo")
+		assert(t, m.Result.Struct == idl.Struct("Item"), m.Result)
+		assert(t, len(m.Args) == 2 && m.Args[1].Type.WireType() == ThriftTypeMap, m.Args)
+		assert(t, len(m.Throws) == 1 && m.Throws[0].Name == "notFound", m.Throws)
+		assert(t, m.Annotations["api.get"] == "/echo", m.Annotations)
+		notify := echo.Method("notify")
+		assert(t, notify.Oneway && notify.Result == nil, notify)
+		assert(t, echo.Method("ping") != nil, "inherited")
+		assert(t, echo.Method("unknown") == nil)
+	})
+}
+
+func TestLoadThriftIDL_Includes(t *testing.T) {
+	t.Run("shared", func(t *testing.T) {
+		dir := t.TempDir()
+		assert(t, os.WriteFile(filepath.Join(dir, "base.thrift"), []byte(testBaseIDL), 0o644) == nil)
+		assert(t, os.WriteFile(filepath.Join(dir, "a.thrift"), []byte(`include "base.thrift"`), 0o644) == nil)
+		main := "include \"a.thrift\"\ninclude \"base.thrift\"\nstruct S { 1: base.Base b }"
+		assert(t, os.WriteFile(filepath.Join(dir, "main.thrift"), []byte(main), 0o644) == nil)
+		idl, err := LoadThriftIDL(filepath.Join(dir, "main.thrift"))
+		assert(t, err == nil, err)
+		assert(t, idl.Includes["a"].Includes["base"] == idl.Includes["base"], "loaded once")
+	})
+	t.Run("circular", func(t *testing.T) {
+		dir := t.TempDir()
+		assert(t, os.WriteFile(filepath.Join(dir, "a.thrift"), []byte(`include "b.thrift"`), 0o644) == nil)
+		assert(t, os.WriteFile(filepath.Join(dir, "b.thrift"), []byte(`include "a.thrift"`), 0o644) == nil)
+		_, err := LoadThriftIDL(filepath.Join(dir, "a.thrift"))
+		assert(t, err != nil && strings.Contains(err.Error(), "circular include"), err)
+	})
+	t.Run("not-found", func(t *testing.T) {
+		dir := t.TempDir()
+		assert(t, os.WriteFile(filepath.Join(dir, "a.thrift"), []byte(`include "x.thrift"`), 0o644) == nil)
+		_, err := LoadThriftIDL(filepath.Join(dir, "a.thrift"))
+		assert(t, errors.Is(err, os.ErrNotExist), err)
+	})
+}
+
+func TestParseThriftIDL(t *testing.T) {
+	t.Run("auto-id", func(t *testing.T) {
+		idl, err := ParseThriftIDL("a.thrift", []byte("struct S { i32 a, i32 b }"))
+		assert(t, err == nil, err)
+		fields := idl.Structs["S"].Fields
+		assert(t, fields[0].ID == -1 && fields[1].ID == -2, fields[0], fields[1])
+	})
+	t.Run("typedef-chain", func(t *testing.T) {
+		idl, err := ParseThriftIDL("a.thrift", []byte("typedef B A\ntypedef list<i16> B\nstruct S { 1: A a }"))
+		assert(t, err == nil, err)
+		a := idl.Structs["S"].Fields[0].Type
+		assert(t, a.WireType() == ThriftTypeList && a.underlying().ValueType.WireType() == ThriftTypeI16, a)
+	})
+	t.Run("numbers", func(t *testing.T) {
+		idl, err := ParseThriftIDL("a.thrift", []byte("struct S { 010: i32 a }\n"+
+			"const i64 A = 0x1F\nconst i64 B = -0X10\nconst i64 C = +007\nconst double D = 1.5e+3"))
+		assert(t, err == nil, err)
+		assert(t, idl.Structs["S"].Fields[0].ID == 10, "decimal with leading zeros", idl.Structs["S"].Fields[0])
+		assert(t, idl.Consts["A"].Value == int64(31), idl.Consts["A"].Value)
+		assert(t, idl.Consts["B"].Value == int64(-16), idl.Consts["B"].Value)
+		assert(t, idl.Consts["C"].Value == int64(7), idl.Consts["C"].Value)
+		assert(t, idl.Consts["D"].Value == 1500.0, idl.Consts["D"].Value)
+		for _, text := range []string{"0b11", "0o17", "1_000", "0x1p3", "0x"} {
+			_, err = ParseThriftIDL("a.thrift", []byte("const i64 A = "+text))
+			assert(t, err != nil && strings.Contains(err.Error(), "invalid number"), text, err)
+		}
+	})
+	t.Run("const-ref", func(t *testing.T) {
+		idl, err := ParseThriftIDL("a.thrift", []byte("const i32 A = B\nconst i32 B = 1"))
+		assert(t, err == nil, err)
+		assert(t, idl.Consts["A"].Value == int64(1), idl.Consts["A"].Value)
+	})
+
+	errorCases := []struct {
+		name    string
+		content string
+		message string
+	}{
+		{"unknown-type", "struct S {\n 1: Foo foo }", "a.thrift:2: unknown type \"Foo\""},
+		{"duplicate-definition", "struct S {}\nenum S {}", "a.thrift:2: duplicate definition \"S\""},
+		{"duplicate-field", "struct S { 1: i32 a; 1: i32 b }", "a.thrift:1: duplicate field 1: b"},
+		{"syntax", "struct S {\n\n 1: i32 }", "a.thrift:3: expect identifier, got \"}\""},
+		{"eof", "struct S {", "a.thrift:1: expect type, got EOF"},
+		{"unterminated-string", "const string s = \"abc", "a.thrift:1: unterminated string"},
+		{"unterminated-comment", "/* abc", "a.thrift:1: unterminated comment"},
+		{"unexpected-char", "struct S { 1: i32 a @ }", "a.thrift:1: unexpected character '@'"},
+		{"field-id-range", "struct S { 40000: i32 a }", "a.thrift:1: field id 40000 out of range"},
+		{"enum-range", "enum E { A = 0x80000000 }", "a.thrift:1: enum value A out of range"},
+		{"include", "include \"b.thrift\"", "a.thrift: includes are not supported in ParseThriftIDL, use LoadThriftIDL"},
+		{"throws", "struct S {}\nservice X { void f() throws (1: S s) }", "a.thrift:2: \"S\" is not an exception"},
+		{"circular-typedef", "typedef A B\ntypedef B A", "too deep or circular"},
+		{"unknown-ident", "const i32 A = X.Y", "a.thrift: unknown identifier \"X.Y\""},
+		{"unknown-service", "service A extends B {}", "a.thrift: unknown service \"B\""},
+	}
+	for _, c := range errorCases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ParseThriftIDL("a.thrift", []byte(c.content))
+			assert(t, err != nil && strings.Contains(err.Error(), c.message), err)
+		})
+	}
+	t.Run("error-type", func(t *testing.T) {
+		_, err := ParseThriftIDL("a.thrift", []byte("struct S {\n 1: Foo foo }"))
+		var idlErr *ThriftIDLError
+		assert(t, errors.As(err, &idlErr) && idlErr.Line == 2, err)
+	})
+}
@@ -0,0 +1,438 @@
+package ttheader
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// ThriftType is the type of thrift values in binary protocol
+type ThriftType byte
+
+const (
+	ThriftTypeStop   ThriftType = thriftStop
+	ThriftTypeBool   ThriftType = thriftTypeBool
+	ThriftTypeByte   ThriftType = thriftTypeByte
+	ThriftTypeDouble ThriftType = thriftTypeDouble
+	ThriftTypeI16    ThriftType = thriftTypeInt16
+	ThriftTypeI32    ThriftType = thriftTypeInt32
+	ThriftTypeI64    ThriftType = thriftTypeInt64
+	ThriftTypeString ThriftType = thriftTypeBinary
+	ThriftTypeStruct ThriftType = thriftTypeStruct
+	ThriftTypeMap    ThriftType = thriftTypeMap
+	ThriftTypeSet    ThriftType = thriftTypeSet
+	ThriftTypeList   ThriftType = thriftTypeList
+	ThriftTypeUUID   ThriftType = thriftTypeUUID
+)
+
+var thriftTypeNames = map[ThriftType]string{
+	ThriftTypeStop:   "stop",
+	ThriftTypeBool:   "bool",
+	ThriftTypeByte:   "byte",
+	ThriftTypeDouble: "double",
+	ThriftTypeI16:    "i16",
+	ThriftTypeI32:    "i32",
+	ThriftTypeI64:    "i64",
+	ThriftTypeString: "string",
+	ThriftTypeStruct: "struct",
+	ThriftTypeMap:    "map",
+	ThriftTypeSet:    "set",
+	ThriftTypeList:   "list",
+	ThriftTypeUUID:   "uuid",
+}
+
+func (t ThriftType) String() string {
+	if name, ok := thriftTypeNames[t]; ok {
+		return name
+	}
+	return "thrift type " + strconv.Itoa(int(t))
+}
+
+// MarshalText renders the type by its name in JSON
+func (t ThriftType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// ThriftMessage is a thrift message decoded without IDL
+type ThriftMessage struct {
+	MessageBegin
+	Body *ThriftStruct
+}
+
+// ThriftStruct is a thrift struct decoded without IDL, with fields in the encoded order
+type ThriftStruct struct {
+	Fields []*ThriftField
+}
+
+// ThriftField is a field of a thrift struct
+// The Go type of Value depends on Type:
+//
+//	bool: bool; byte: int8; i16: int16; i32: int32; i64: int64; double: float64;
+//	string (or binary): string; uuid: [16]byte;
+//	struct: *ThriftStruct; list/set: *ThriftList; map: *ThriftMap.
+//
+// Elements in containers follow the same rules.
+type ThriftField struct {
+	ID    int16
+	Type  ThriftType
+	Value interface{}
+}
+
+// ThriftList is a thrift list or set
+type ThriftList struct {
+	ElemType ThriftType
+	Elems    []interface{}
+}
+
+// ThriftMap is a thrift map, with entries in the encoded order
+type ThriftMap struct {
+	KeyType   ThriftType
+	ValueType ThriftType
+	Entries   []*ThriftMapEntry
+}
+
+// ThriftMapEntry is an entry of a thrift map
+type ThriftMapEntry struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// Field returns the field with the given id, or nil if not found
+func (s *ThriftStruct) Field(id int16) *ThriftField {
+	for _, field := range s.Fields {
+		if field.ID == id {
+			return field
+		}
+	}
+	return nil
+}
+
+// DecodeThriftMessage decodes a thrift binary message (strict or non-strict) without IDL
+func DecodeThriftMessage(payload []byte) (*ThriftMessage, error) {
+	reader := newBytesReader(payload)
+	msg, err := readBinaryMessageBegin(reader, ProtocolIDThriftBinary)
+	if err != nil {
+		return nil, err
+	}
+	body, err := decodeThriftStruct(reader, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &ThriftMessage{MessageBegin: *msg, Body: body}, nil
+}
+
+// DecodeThriftStruct decodes a thrift binary struct without IDL
+func DecodeThriftStruct(buf []byte) (*ThriftStruct, error) {
+	return decodeThriftStruct(newBytesReader(buf), 0)
+}
+
+// Bytes encodes the message in thrift binary
+func (m *ThriftMessage) Bytes() ([]byte, error) {
+	buf, err := m.MessageBegin.Bytes(ProtocolIDThriftBinary)
+	if err != nil {
+		return nil, err
+	}
+	return appendThriftStruct(buf, m.Body, 0)
+}
+
+// Bytes encodes the struct in thrift binary
+func (s *ThriftStruct) Bytes() ([]byte, error) {
+	return appendThriftStruct(nil, s, 0)
+}
+
+func decodeThriftStruct(reader *bytesReader, depth int) (*ThriftStruct, error) {
+	s := &ThriftStruct{}
+	for {
+		tp, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if tp == thriftStop {
+			return s, nil
+		}
+		id, err := reader.ReadUint16()
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeThriftValue(reader, ThriftType(tp), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		s.Fields = append(s.Fields, &ThriftField{ID: int16(id), Type: ThriftType(tp), Value: value})
+	}
+}
+
+// decodeThriftValue decodes a value of the given type; depth is the nesting level of the value
+func decodeThriftValue(reader *bytesReader, tp ThriftType, depth int) (interface{}, error) {
+	if depth > maxThriftDepth {
+		return nil, ErrThriftDepthExceeded
+	}
+	switch tp {
+	case ThriftTypeBool:
+		b, err := reader.ReadByte()
+		return b != 0, err
+	case ThriftTypeByte:
+		b, err := reader.ReadByte()
+		return int8(b), err
+	case ThriftTypeI16:
+		v, err := reader.ReadUint16()
+		return int16(v), err
+	case ThriftTypeI32:
+		v, err := reader.ReadInt32()
+		return v, err
+	case ThriftTypeI64:
+		v, err := reader.ReadUint64()
+		return int64(v), err
+	case ThriftTypeDouble:
+		v, err := reader.ReadUint64()
+		return math.Float64frombits(v), err
+	case ThriftTypeString:
+		size, err := readThriftSize(reader)
+		if err != nil {
+			return nil, err
+		}
+		return reader.ReadString(size)
+	case ThriftTypeUUID:
+		var uuid [16]byte
+		buf, err := reader.ReadBytes(16)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		copy(uuid[:], buf)
+		return uuid, nil
+	case ThriftTypeStruct:
+		return decodeThriftStruct(reader, depth)
+	case ThriftTypeMap:
+		keyType, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		valueType, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := readThriftSize(reader)
+		if err != nil {
+			return nil, err
+		}
+		m := &ThriftMap{KeyType: ThriftType(keyType), ValueType: ThriftType(valueType)}
+		m.Entries = make([]*ThriftMapEntry, 0, minInt(size, reader.len-reader.idx)) // avoid huge allocation
+		for i := 0; i < size; i++ {
+			entry := &ThriftMapEntry{}
+			if entry.Key, err = decodeThriftValue(reader, m.KeyType, depth+1); err != nil {
+				return nil, err
+			}
+			if entry.Value, err = decodeThriftValue(reader, m.ValueType, depth+1); err != nil {
+				return nil, err
+			}
+			m.Entries = append(m.Entries, entry)
+		}
+		return m, nil
+	case ThriftTypeSet, ThriftTypeList:
+		elemType, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := readThriftSize(reader)
+		if err != nil {
+			return nil, err
+		}
+		l := &ThriftList{ElemType: ThriftType(elemType)}
+		l.Elems = make([]interface{}, 0, minInt(size, reader.len-reader.idx))
+		for i := 0; i < size; i++ {
+			elem, err := decodeThriftValue(reader, l.ElemType, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			l.Elems = append(l.Elems, elem)
+		}
+		return l, nil
+	default:
+		return nil, ErrInvalidThriftType
+	}
+}
+
+func appendThriftStruct(buf []byte, s *ThriftStruct, depth int) ([]byte, error) {
+	if s == nil {
+		return nil, fmt.Errorf("thrift: nil struct")
+	}
+	var err error
+	for _, field := range s.Fields {
+		buf = appendI16(append(buf, byte(field.Type)), field.ID)
+		if buf, err = appendThriftValue(buf, field.Type, field.Value, depth+1); err != nil {
+			return nil, fmt.Errorf("field %d: %w", field.ID, err)
+		}
+	}
+	return append(buf, thriftStop), nil
+}
+
+// appendThriftValue encodes a value of the given type; depth is the nesting level of the value
+func appendThriftValue(buf []byte, tp ThriftType, value interface{}, depth int) ([]byte, error) {
+	if depth > maxThriftDepth {
+		return nil, ErrThriftDepthExceeded
+	}
+	mismatch := func() ([]byte, error) {
+		return nil, fmt.Errorf("thrift: expect %s, got %T", tp, value)
+	}
+	switch tp {
+	case ThriftTypeBool:
+		v, ok := value.(bool)
+		if !ok {
+			return mismatch()
+		}
+		if v {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case ThriftTypeByte:
+		v, ok := value.(int8)
+		if !ok {
+			return mismatch()
+		}
+		return append(buf, byte(v)), nil
+	case ThriftTypeI16:
+		v, ok := value.(int16)
+		if !ok {
+			return mismatch()
+		}
+		return appendI16(buf, v), nil
+	case ThriftTypeI32:
+		v, ok := value.(int32)
+		if !ok {
+			return mismatch()
+		}
+		return appendUint32(buf, uint32(v)), nil
+	case ThriftTypeI64:
+		v, ok := value.(int64)
+		if !ok {
+			return mismatch()
+		}
+		return appendUint64(buf, uint64(v)), nil
+	case ThriftTypeDouble:
+		v, ok := value.(float64)
+		if !ok {
+			return mismatch()
+		}
+		return appendUint64(buf, math.Float64bits(v)), nil
+	case ThriftTypeString:
+		switch v := value.(type) {
+		case string:
+			return append(appendUint32(buf, uint32(len(v))), v...), nil
+		case []byte:
+			return append(appendUint32(buf, uint32(len(v))), v...), nil
+		}
+		return mismatch()
+	case ThriftTypeUUID:
+		v, ok := value.([16]byte)
+		if !ok {
+			return mismatch()
+		}
+		return append(buf, v[:]...), nil
+	case ThriftTypeStruct:
+		v, ok := value.(*ThriftStruct)
+		if !ok {
+			return mismatch()
+		}
+		return appendThriftStruct(buf, v, depth)
+	case ThriftTypeMap:
+		v, ok := value.(*ThriftMap)
+		if !ok || v == nil {
+			return mismatch()
+		}
+		buf = appendUint32(append(buf, byte(v.KeyType), byte(v.ValueType)), uint32(len(v.Entries)))
+		var err error
+		for _, entry := range v.Entries {
+			if buf, err = appendThriftValue(buf, v.KeyType, entry.Key, depth+1); err != nil {
+				return nil, err
+			}
+			if buf, err = appendThriftValue(buf, v.ValueType, entry.Value, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case ThriftTypeSet, ThriftTypeList:
+		v, ok := value.(*ThriftList)
+		if !ok || v == nil {
+			return mismatch()
+		}
+		buf = appendUint32(append(buf, byte(v.ElemType)), uint32(len(v.Elems)))
+		var err error
+		for _, elem := range v.Elems {
+			if buf, err = appendThriftValue(buf, v.ElemType, elem, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	default:
+		return nil, ErrInvalidThriftType
+	}
+}
+
+// MarshalJSON renders the message as {"name", "type", "seqID", "body"}
+func (m *ThriftMessage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"name":  m.Name,
+		"type":  m.Type.String(),
+		"seqID": m.SeqID,
+		"body":  m.Body,
+	})
+}
+
+// MarshalJSON renders the struct as a list of fields: [{"id", "type", "value"}]
+func (s *ThriftStruct) MarshalJSON() ([]byte, error) {
+	fields := make([]interface{}, 0, len(s.Fields))
+	for _, field := range s.Fields {
+		fields = append(fields, map[string]interface{}{
+			"id":    field.ID,
+			"type":  field.Type,
+			"value": jsonThriftValue(field.Value),
+		})
+	}
+	return json.Marshal(fields)
+}
+
+// jsonThriftValue converts the value into a JSON friendly one:
+// (1) strings which are not valid UTF-8 are rendered as {"base64": "..."};
+// (2) uuids are rendered in the canonical form;
+// (3) lists/sets are rendered as {"elemType", "elems"}, and maps as {"keyType", "valueType", "entries"};
+// (4) doubles of NaN and Inf are rendered as strings, see jsonFloat.
+func jsonThriftValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		return jsonFloat(v)
+	case string:
+		if !utf8.ValidString(v) {
+			return map[string]string{"base64": base64.StdEncoding.EncodeToString(stringToByteSlice(v))}
+		}
+		return v
+	case [16]byte:
+		return formatUUID(v)
+	case *ThriftList:
+		elems := make([]interface{}, 0, len(v.Elems))
+		for _, elem := range v.Elems {
+			elems = append(elems, jsonThriftValue(elem))
+		}
+		return map[string]interface{}{"elemType": v.ElemType, "elems": elems}
+	case *ThriftMap:
+		entries := make([]interface{}, 0, len(v.Entries))
+		for _, entry := range v.Entries {
+			entries = append(entries, map[string]interface{}{
+				"key":   jsonThriftValue(entry.Key),
+				"value": jsonThriftValue(entry.Value),
+			})
+		}
+		return map[string]interface{}{"keyType": v.KeyType, "valueType": v.ValueType, "entries": entries}
+	default:
+		return value
+	}
+}
+
+// formatUUID returns the uuid in the canonical form, e.g. 123e4567-e89b-12d3-a456-426614174000
+func formatUUID(uuid [16]byte) string {
+	s := hex.EncodeToString(uuid[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
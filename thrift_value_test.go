@@ -0,0 +1,167 @@
+package ttheader
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestThriftType_String(t *testing.T) {
+	assert(t, ThriftTypeString.String() == "string")
+	assert(t, ThriftTypeI64.String() == "i64")
+	assert(t, ThriftType(1).String() == "thrift type 1")
+}
+
+func TestDecodeThriftStruct(t *testing.T) {
+	t.Run("all-types", func(t *testing.T) {
+		s, err := DecodeThriftStruct(testThriftStruct())
+		assert(t, err == nil, err)
+		assert(t, len(s.Fields) == 12, len(s.Fields))
+		assert(t, s.Field(1).Value == true, s.Field(1))
+		assert(t, s.Field(2).Value == int8(2), s.Field(2))
+		assert(t, s.Field(3).Value == int16(3), s.Field(3))
+		assert(t, s.Field(4).Value == int32(4), s.Field(4))
+		assert(t, s.Field(5).Value == int64(5), s.Field(5))
+		assert(t, s.Field(6).Value == math.Float64frombits(6), s.Field(6))
+		assert(t, s.Field(7).Value == "seven", s.Field(7))
+
+		list := s.Field(8).Value.(*ThriftList)
+		assert(t, list.ElemType == ThriftTypeString && len(list.Elems) == 2, list)
+		assert(t, list.Elems[0] == "a" && list.Elems[1] == "b", list.Elems)
+
+		set := s.Field(9)
+		assert(t, set.Type == ThriftTypeSet, set.Type)
+		assert(t, set.Value.(*ThriftList).Elems[1] == int32(2), set.Value)
+
+		m := s.Field(10).Value.(*ThriftMap)
+		assert(t, m.KeyType == ThriftTypeString && m.ValueType == ThriftTypeStruct, m)
+		assert(t, len(m.Entries) == 1 && m.Entries[0].Key == "key", m.Entries)
+		assert(t, m.Entries[0].Value.(*ThriftStruct).Field(1).Value == int32(1), m.Entries[0].Value)
+
+		nested := s.Field(12).Value.(*ThriftStruct)
+		assert(t, len(nested.Fields) == 0, nested)
+		assert(t, s.Field(13) == nil)
+	})
+	t.Run("truncated", func(t *testing.T) {
+		buf := testThriftStruct()
+		for i := 0; i < len(buf); i++ {
+			_, err := DecodeThriftStruct(buf[:i])
+			assert(t, err != nil, i)
+		}
+	})
+	t.Run("invalid-type", func(t *testing.T) {
+		buf := append(appendFieldBegin(nil, 0x1, 1), thriftStop)
+		_, err := DecodeThriftStruct(buf)
+		assert(t, err == ErrInvalidThriftType, err)
+	})
+	t.Run("huge-size", func(t *testing.T) {
+		buf := append(appendFieldBegin(nil, thriftTypeList, 1), thriftTypeInt32)
+		buf = appendI32(buf, math.MaxInt32)
+		_, err := DecodeThriftStruct(buf)
+		assert(t, err != nil)
+	})
+	t.Run("depth-exceeded", func(t *testing.T) {
+		var buf []byte
+		for i := 0; i <= maxThriftDepth; i++ {
+			buf = appendFieldBegin(buf, thriftTypeStruct, 1)
+		}
+		_, err := DecodeThriftStruct(buf)
+		assert(t, err == ErrThriftDepthExceeded, err)
+	})
+}
+
+func TestDecodeThriftMessage(t *testing.T) {
+	t.Run("strict", func(t *testing.T) {
+		msg, err := DecodeThriftMessage(testThriftMessage(7))
+		assert(t, err == nil, err)
+		assert(t, msg.Name == "method" && msg.Type == MessageTypeCall && msg.SeqID == 7, msg.MessageBegin)
+		assert(t, len(msg.Body.Fields) == 12, msg.Body)
+	})
+	t.Run("non-strict", func(t *testing.T) {
+		buf := append(appendThriftString(nil, "method"), byte(MessageTypeReply))
+		buf = append(appendI32(buf, 8), testThriftStruct()...)
+		msg, err := DecodeThriftMessage(buf)
+		assert(t, err == nil, err)
+		assert(t, msg.NonStrict && msg.Type == MessageTypeReply && msg.SeqID == 8, msg.MessageBegin)
+	})
+	t.Run("invalid-magic", func(t *testing.T) {
+		_, err := DecodeThriftMessage(appendUint32(nil, 0x80020001))
+		assert(t, err == ErrInvalidThriftMagic, err)
+	})
+}
+
+func TestThriftStruct_Bytes(t *testing.T) {
+	t.Run("round-trip", func(t *testing.T) {
+		buf := testThriftStruct()
+		s, err := DecodeThriftStruct(buf)
+		assert(t, err == nil, err)
+		encoded, err := s.Bytes()
+		assert(t, err == nil, err)
+		assert(t, bytes.Equal(encoded, buf), encoded)
+	})
+	t.Run("crafted", func(t *testing.T) {
+		uuid := [16]byte{1, 2, 3}
+		s := &ThriftStruct{Fields: []*ThriftField{
+			{ID: 1, Type: ThriftTypeString, Value: []byte("bin")},
+			{ID: 2, Type: ThriftTypeUUID, Value: uuid},
+			{ID: 3, Type: ThriftTypeList, Value: &ThriftList{ElemType: ThriftTypeBool, Elems: []interface{}{true, false}}},
+		}}
+		buf, err := s.Bytes()
+		assert(t, err == nil, err)
+		decoded, err := DecodeThriftStruct(buf)
+		assert(t, err == nil, err)
+		assert(t, decoded.Field(1).Value == "bin", decoded.Field(1))
+		assert(t, decoded.Field(2).Value == uuid, decoded.Field(2))
+		assert(t, decoded.Field(3).Value.(*ThriftList).Elems[1] == false, decoded.Field(3))
+	})
+	t.Run("type-mismatch", func(t *testing.T) {
+		s := &ThriftStruct{Fields: []*ThriftField{{ID: 1, Type: ThriftTypeI32, Value: 1}}}
+		_, err := s.Bytes()
+		assert(t, err != nil && err.Error() == "field 1: thrift: expect i32, got int", err)
+	})
+	t.Run("nil-container", func(t *testing.T) {
+		s := &ThriftStruct{Fields: []*ThriftField{{ID: 1, Type: ThriftTypeMap, Value: (*ThriftMap)(nil)}}}
+		_, err := s.Bytes()
+		assert(t, err != nil)
+	})
+}
+
+func TestThriftMessage_Bytes(t *testing.T) {
+	buf := testThriftMessage(9)
+	msg, err := DecodeThriftMessage(buf)
+	assert(t, err == nil, err)
+	encoded, err := msg.Bytes()
+	assert(t, err == nil, err)
+	assert(t, bytes.Equal(encoded, buf), encoded)
+}
+
+func TestThriftMessage_MarshalJSON(t *testing.T) {
+	msg := &ThriftMessage{
+		MessageBegin: MessageBegin{Name: "echo", Type: MessageTypeCall, SeqID: 1},
+		Body: &ThriftStruct{Fields: []*ThriftField{
+			{ID: 1, Type: ThriftTypeString, Value: "hello"},
+			{ID: 2, Type: ThriftTypeString, Value: "\xff"},
+			{ID: 3, Type: ThriftTypeUUID, Value: [16]byte{0: 0x12, 15: 0xab}},
+			{ID: 4, Type: ThriftTypeList, Value: &ThriftList{ElemType: ThriftTypeI32, Elems: []interface{}{int32(1)}}},
+			{ID: 5, Type: ThriftTypeMap, Value: &ThriftMap{
+				KeyType: ThriftTypeString, ValueType: ThriftTypeI64,
+				Entries: []*ThriftMapEntry{{Key: "k", Value: int64(2)}},
+			}},
+			{ID: 6, Type: ThriftTypeList, Value: &ThriftList{ElemType: ThriftTypeDouble, Elems: []interface{}{
+				1.5, math.NaN(), math.Inf(1), math.Inf(-1),
+			}}},
+		}},
+	}
+	buf, err := json.Marshal(msg)
+	assert(t, err == nil, err)
+	expected := `{"body":[` +
+		`{"id":1,"type":"string","value":"hello"},` +
+		`{"id":2,"type":"string","value":{"base64":"/w=="}},` +
+		`{"id":3,"type":"uuid","value":"12000000-0000-0000-0000-0000000000ab"},` +
+		`{"id":4,"type":"list","value":{"elemType":"i32","elems":[1]}},` +
+		`{"id":5,"type":"map","value":{"entries":[{"key":"k","value":2}],"keyType":"string","valueType":"i64"}},` +
+		`{"id":6,"type":"list","value":{"elemType":"double","elems":[1.5,"NaN","+Inf","-Inf"]}}` +
+		`],"name":"echo","seqID":1,"type":"call"}`
+	assert(t, string(buf) == expected, string(buf))
+}
@@ -0,0 +1,106 @@
+package ttheader
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// keys in strInfo for the status of a streaming trailer frame
+const (
+	StrKeyStatusCode    = "status-code" // ExceptionType in decimal, absent or "0" for OK, see statusCodeUnknown
+	StrKeyStatusMessage = "status-message"
+)
+
+// statusCodeUnknown is the status code of ExceptionTypeUnknown, whose value (0) is reserved for OK
+const statusCodeUnknown = -1
+
+// The status of a stream is conveyed by its trailer frame:
+// (1) OK: no status keys and an empty payload;
+// (2) business errors: biz-* keys (see BizError), which are not failures of the stream itself;
+// (3) other errors: status-code and status-message keys, together with the same exception
+//     encoded in the payload, so that peers checking the payload (e.g. by PayloadAsException) also work;
+// (4) canceled: status-code of ExceptionTypeCanceled without a payload, see NewCancelFrame.
+
+// NewErrorTrailerFrame creates a trailer frame conveying the error, which can be nil for OK
+// A *BizError (by errors.As) is written as biz-* keys; an *Exception is written as is, with the seqID replaced;
+// other errors are written as ExceptionTypeInternalError with err.Error() as the message.
+// The exception payload is encoded in the given protocol.
+func NewErrorTrailerFrame(seqID int32, protocolID uint8, err error) (*Frame, error) {
+	f := NewTrailerFrame(seqID, nil, nil)
+	h := f.Header()
+	h.SetProtocolID(protocolID)
+	if err == nil {
+		return f, nil
+	}
+	var bizErr *BizError
+	if errors.As(err, &bizErr) {
+		writeBizError(h, bizErr)
+		return f, nil
+	}
+	exc := NewExceptionWithType("", seqID, err.Error(), ExceptionTypeInternalError)
+	var e *Exception
+	if errors.As(err, &e) {
+		exc.MethodName, exc.Message, exc.ExceptionType = e.MethodName, e.Message, e.ExceptionType
+	}
+	payload, err := exc.encode(protocolID)
+	if err != nil {
+		return nil, err
+	}
+	code := exc.ExceptionType
+	if code == int(ExceptionTypeUnknown) {
+		code = statusCodeUnknown
+	}
+	h.SetStrKey(StrKeyStatusCode, strconv.Itoa(code))
+	h.SetStrKey(StrKeyStatusMessage, exc.Message)
+	f.payload = payload
+	return f, nil
+}
+
+// TrailerErr returns the error conveyed by the trailer frame, or nil for OK:
+// (1) an *Exception in the payload or a *BizError, as Frame.Err;
+// (2) an *Exception by the status-code and status-message keys, if the code is non-zero;
+// a code of statusCodeUnknown is ExceptionTypeUnknown.
+// An error decoding the status is returned as is.
+func (f *Frame) TrailerErr() error {
+	if err := f.Err(); err != nil || f.header == nil {
+		return err
+	}
+	status, ok := f.header.GetStrKey(StrKeyStatusCode)
+	if !ok {
+		return nil
+	}
+	code, err := strconv.ParseInt(status, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid status code %q: %w", status, err)
+	}
+	if code == 0 {
+		return nil
+	}
+	if code == statusCodeUnknown {
+		code = int64(ExceptionTypeUnknown)
+	}
+	message, _ := f.header.GetStrKey(StrKeyStatusMessage)
+	return NewException("", f.header.SeqID(), message, int(code))
+}
+
+// NewCancelFrame creates a trailer frame which cancels (resets) the stream, i.e. the sender gives up on it
+// Unlike other trailers, it can be sent even if the send direction has been closed, see Stream.
+func NewCancelFrame(seqID int32, message string) *Frame {
+	if message == "" {
+		message = "stream canceled"
+	}
+	return NewTrailerFrame(seqID, map[string]string{
+		StrKeyStatusCode:    strconv.Itoa(int(ExceptionTypeCanceled)),
+		StrKeyStatusMessage: message,
+	}, nil)
+}
+
+// IsCancel reports whether the frame is a trailer canceling the stream, see NewCancelFrame
+func (f *Frame) IsCancel() bool {
+	if f.header == nil || f.Type() != FrameKindTrailer {
+		return false
+	}
+	status, _ := f.header.GetStrKey(StrKeyStatusCode)
+	return status == strconv.Itoa(int(ExceptionTypeCanceled))
+}
@@ -0,0 +1,112 @@
+package ttheader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestNewErrorTrailerFrame(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		f, err := NewErrorTrailerFrame(1, ProtocolIDThriftBinary, nil)
+		assert(t, err == nil, err)
+		assert(t, f.Type() == FrameKindTrailer && f.Header().IsStreaming(), f.Type())
+		assert(t, len(f.Payload()) == 0 && len(f.Header().StrInfo()) == 0, f.Header().StrInfo())
+		assert(t, f.TrailerErr() == nil)
+	})
+	t.Run("biz-error", func(t *testing.T) {
+		f, err := NewErrorTrailerFrame(1, ProtocolIDThriftBinary, fmt.Errorf("wrapped: %w", NewBizError(100, "biz", nil)))
+		assert(t, err == nil, err)
+		assert(t, len(f.Payload()) == 0, f.Payload())
+		_, ok := f.Header().GetStrKey(StrKeyStatusCode)
+		assert(t, !ok)
+		assert(t, reflect.DeepEqual(f.TrailerErr(), NewBizError(100, "biz", nil)), f.TrailerErr())
+	})
+	t.Run("exception", func(t *testing.T) {
+		for _, protocolID := range []uint8{ProtocolIDThriftBinary, ProtocolIDThriftCompact, ProtocolIDKitexProtobuf} {
+			exc := NewExceptionWithType("echo", 100, "unknown", ExceptionTypeUnknownMethod)
+			f, err := NewErrorTrailerFrame(1, protocolID, exc)
+			assert(t, err == nil, err)
+			assert(t, exc.SeqID == 100, "input is not modified")
+			code, _ := f.Header().GetStrKey(StrKeyStatusCode)
+			message, _ := f.Header().GetStrKey(StrKeyStatusMessage)
+			assert(t, code == "1" && message == "unknown", code, message)
+
+			payloadExc, err := f.PayloadAsException()
+			assert(t, err == nil, err)
+			assert(t, *payloadExc == Exception{MethodName: "echo", SeqID: 1, Message: "unknown", ExceptionType: int(ExceptionTypeUnknownMethod)}, payloadExc)
+			assert(t, errors.Is(f.TrailerErr(), ExceptionTypeUnknownMethod), f.TrailerErr())
+		}
+	})
+	t.Run("unknown-exception", func(t *testing.T) {
+		f, err := NewErrorTrailerFrame(1, ProtocolIDThriftBinary, NewExceptionWithType("", 1, "unknown", ExceptionTypeUnknown))
+		assert(t, err == nil, err)
+		code, _ := f.Header().GetStrKey(StrKeyStatusCode)
+		assert(t, code == "-1", "0 is reserved for OK", code)
+		assert(t, errors.Is(f.TrailerErr(), ExceptionTypeUnknown), f.TrailerErr())
+
+		f = NewTrailerFrame(1, f.Header().StrInfo(), nil) // status keys only
+		assert(t, errors.Is(f.TrailerErr(), ExceptionTypeUnknown), f.TrailerErr())
+	})
+	t.Run("error", func(t *testing.T) {
+		f, err := NewErrorTrailerFrame(1, ProtocolIDThriftBinary, errors.New("failed"))
+		assert(t, err == nil, err)
+		trailerErr := f.TrailerErr()
+		assert(t, errors.Is(trailerErr, ExceptionTypeInternalError) && trailerErr.Error() == "failed", trailerErr)
+	})
+	t.Run("unsupported-protocol", func(t *testing.T) {
+		_, err := NewErrorTrailerFrame(1, 0x01, errors.New("failed")) // unassigned
+		assert(t, err == ErrProtocolNotSupported, err)
+	})
+	t.Run("compact-v2", func(t *testing.T) {
+		f, err := NewErrorTrailerFrame(1, ProtocolIDThriftCompactV2, errors.New("failed"))
+		assert(t, err == nil, err)
+		assert(t, isThriftCompact(f.Payload()), f.Payload())
+		assert(t, errors.Is(f.TrailerErr(), ExceptionTypeInternalError), f.TrailerErr())
+	})
+	t.Run("encoded", func(t *testing.T) {
+		f, err := NewErrorTrailerFrame(1, ProtocolIDThriftBinary, errors.New("failed"))
+		assert(t, err == nil, err)
+		buf, err := f.Bytes()
+		assert(t, err == nil, err)
+		f, err = ReadFrame(bytes.NewReader(buf))
+		assert(t, err == nil, err)
+		assert(t, errors.Is(f.TrailerErr(), ExceptionTypeInternalError), f.TrailerErr())
+	})
+}
+
+func TestFrame_TrailerErr(t *testing.T) {
+	t.Run("status-keys-only", func(t *testing.T) {
+		f := NewTrailerFrame(1, map[string]string{StrKeyStatusCode: "7", StrKeyStatusMessage: "bad"}, nil)
+		err := f.TrailerErr()
+		exc, ok := err.(*Exception)
+		assert(t, ok && exc.Type() == ExceptionTypeProtocolError && exc.Message == "bad" && exc.SeqID == 1, err)
+	})
+	t.Run("zero", func(t *testing.T) {
+		f := NewTrailerFrame(1, map[string]string{StrKeyStatusCode: "0"}, nil)
+		assert(t, f.TrailerErr() == nil)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		f := NewTrailerFrame(1, map[string]string{StrKeyStatusCode: "x"}, nil)
+		err := f.TrailerErr()
+		_, ok := err.(*Exception)
+		assert(t, err != nil && !ok, err)
+	})
+	t.Run("nil-header", func(t *testing.T) {
+		assert(t, NewFrame(nil, nil).TrailerErr() == nil)
+	})
+}
+
+func TestNewCancelFrame(t *testing.T) {
+	f := NewCancelFrame(1, "")
+	assert(t, f.IsCancel() && f.Type() == FrameKindTrailer, f.Header())
+	err := f.TrailerErr()
+	assert(t, errors.Is(err, ExceptionTypeCanceled) && err.Error() == "stream canceled", err)
+	assert(t, NewCancelFrame(1, "timeout").TrailerErr().Error() == "timeout")
+
+	assert(t, !NewTrailerFrame(1, nil, nil).IsCancel())
+	assert(t, !NewMetaFrame(1, map[string]string{StrKeyStatusCode: "1001"}, nil).IsCancel())
+	assert(t, !NewFrame(nil, nil).IsCancel())
+}
@@ -84,14 +84,13 @@ func byteSliceToString(buf []byte) string {
 }
 
 // stringToByteSlice converts a string to a byte slice without a copy.
-func stringToByteSlice(str string) []byte {
-	return *(*[]byte)(unsafe.Pointer(
-		&reflect.SliceHeader{
-			Data: (*reflect.StringHeader)(unsafe.Pointer(&str)).Data,
-			Len:  len(str),
-			Cap:  len(str),
-		},
-	))
+func stringToByteSlice(str string) (buf []byte) {
+	sh := (*reflect.StringHeader)(unsafe.Pointer(&str))
+	bh := (*reflect.SliceHeader)(unsafe.Pointer(&buf))
+	bh.Data = sh.Data
+	bh.Len = sh.Len
+	bh.Cap = sh.Len
+	return buf
 }
 
 func writeByte(buf []byte, value byte) error {
@@ -189,6 +188,52 @@ func writeUint16(buf []byte, u uint16) error {
 	return nil
 }
 
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	return appendUint32(appendUint32(buf, uint32(v>>32)), uint32(v))
+}
+
+func appendI16(buf []byte, v int16) []byte {
+	return append(buf, byte(uint16(v)>>8), byte(v))
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// appendUvarint appends the base 128 varint of v, as used by thrift compact and protobuf
+func appendUvarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+// uvarintSize returns the size of the base 128 varint of v
+func uvarintSize(v uint64) int {
+	size := 1
+	for ; v >= 0x80; v >>= 7 {
+		size++
+	}
+	return size
+}
+
+// zigzag encodes signed integers into unsigned ones, so that small negative numbers have short varints
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func unzigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
 func paddingSize(size, padding int) int {
 	if remain := size % padding; remain != 0 {
 		return padding - remain
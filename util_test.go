@@ -586,3 +586,28 @@ func TestParsePackageServiceMethod(t *testing.T) {
 		assert(t, err != nil, err)
 	})
 }
+
+func Test_appendUvarint(t *testing.T) {
+	for _, v := range []uint64{0, 1, 127, 128, 300, 1<<32 - 1, 1<<64 - 1} {
+		buf := appendUvarint(nil, v)
+		expected := make([]byte, binary.MaxVarintLen64)
+		n := binary.PutUvarint(expected, v)
+		assert(t, reflect.DeepEqual(buf, expected[:n]), v, buf)
+	}
+}
+
+func Test_zigzag(t *testing.T) {
+	for _, tt := range []struct {
+		v        int64
+		expected uint64
+	}{{0, 0}, {-1, 1}, {1, 2}, {-2, 3}, {2147483647, 4294967294}, {-2147483648, 4294967295}} {
+		assert(t, zigzag(tt.v) == tt.expected, tt)
+		assert(t, unzigzag(tt.expected) == tt.v, tt)
+	}
+}
+
+func Test_uvarintSize(t *testing.T) {
+	for _, v := range []uint64{0, 127, 128, 1<<32 - 1, 1<<64 - 1} {
+		assert(t, uvarintSize(v) == len(appendUvarint(nil, v)), v)
+	}
+}